@@ -4,6 +4,7 @@ package main
 import "C"
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"os"
@@ -22,7 +23,7 @@ func NewByteSequence(size int64) *ByteSequence {
 	return &ByteSequence{
 		size:   size,
 		offset: 0,
-		next:   0x490c734ad1ccf6e9, // Initialize with a couple rounds of the generator
+		next:   defaultSeed,
 	}
 }
 
@@ -67,7 +68,12 @@ func (seq *ByteSequence) Fill(buf []byte) {
 	seq.next = uint64(temp)
 }
 
-var patternBlock []byte
+const patternBlockSize = 65536
+
+// patternBlock is shared, read-only fill for the compressible part of a
+// buffer. It is built at init so concurrent PatternFill calls never race
+// to create it.
+var patternBlock = bytes.Repeat([]byte{'A'}, patternBlockSize)
 
 // PatternFill fills buffer with a certain amount of compressibility,
 // ranging from 0 (not compressible) to 100 (completely compressible).
@@ -81,15 +87,7 @@ func (seq *ByteSequence) PatternFill(buf []byte, compressibility int) {
 		return
 	}
 
-	blkSize := 65536
-
-	if patternBlock == nil {
-		patternBlock = make([]byte, blkSize)
-		for i := range patternBlock {
-			patternBlock[i] = byte('A')
-		}
-	}
-
+	blkSize := patternBlockSize
 	blocks := len(buf) / blkSize
 	leftover := len(buf) % blkSize
 	patternBlocks := int(float32(blocks) * float32(compressibility) / float32(100))
@@ -138,6 +136,177 @@ func (seq *ByteSequence) PatternFill(buf []byte, compressibility int) {
 	}
 }
 
+// CompressMode selects how compressibility is produced in generated data.
+type CompressMode int
+
+const (
+	// CompressRuns mixes 64KB runs of a repeated byte with random blocks
+	// (PatternFill). It's what perftest has always done, so it remains the
+	// default, but it's coarse: objects under 64KB are either all random or
+	// all pattern.
+	CompressRuns CompressMode = iota
+
+	// CompressChunk makes each 4KB chunk part random and part zeros, in
+	// proportion to the compressibility. Any compressor that finds runs
+	// (lz4, zstd, gzip) gets close to the target ratio.
+	CompressChunk
+
+	// CompressVaried is like CompressChunk, but the random part of each
+	// chunk varies around the target, so chunks differ in how well they
+	// compress (as in real data) while the average ratio stays on target.
+	CompressVaried
+
+	compressModeCount
+)
+
+// compressChunkSize is the granularity of CompressChunk and CompressVaried.
+const compressChunkSize = 4096
+
+func parseCompressMode(mode string) (CompressMode, error) {
+	switch mode {
+	case "", "runs":
+		return CompressRuns, nil
+	case "chunk":
+		return CompressChunk, nil
+	case "varied":
+		return CompressVaried, nil
+	default:
+		return CompressRuns, fmt.Errorf("unknown compress mode '%s'; use runs, chunk, or varied", mode)
+	}
+}
+
+func (m CompressMode) String() string {
+	switch m {
+	case CompressRuns:
+		return "runs"
+	case CompressChunk:
+		return "chunk"
+	case CompressVaried:
+		return "varied"
+	default:
+		return fmt.Sprintf("mode %d", int(m))
+	}
+}
+
+// CompressFill fills buffer with the given compressibility, ranging from 0
+// (not compressible) to 100 (completely compressible), using mode. For the
+// chunk modes, compressibility is the percentage a compressor should save,
+// i.e. the target ratio is 100/(100-compressibility).
+func (seq *ByteSequence) CompressFill(buf []byte, compressibility int, mode CompressMode) {
+	switch mode {
+	case CompressChunk:
+		seq.ChunkFill(buf, compressibility, false)
+	case CompressVaried:
+		seq.ChunkFill(buf, compressibility, true)
+	default:
+		seq.PatternFill(buf, compressibility)
+	}
+}
+
+// ChunkFill fills each 4KB chunk of buffer (and any partial chunk at the
+// end) with random bytes followed by zeros, the zeros making up
+// compressibility percent of the chunk. If vary is set, each chunk's split
+// is moved by a random amount, up to half the smaller part, in either
+// direction.
+func (seq *ByteSequence) ChunkFill(buf []byte, compressibility int, vary bool) {
+	for len(buf) > 0 {
+		chunk := buf
+		if len(chunk) > compressChunkSize {
+			chunk = chunk[:compressChunkSize]
+		}
+		buf = buf[len(chunk):]
+
+		random := len(chunk) * (100 - compressibility) / 100
+
+		if vary {
+			spread := random
+			if zeros := len(chunk) - random; zeros < spread {
+				spread = zeros
+			}
+			if spread /= 2; spread > 0 {
+				random += int(mixSeed(seq.next, 0)%uint64(2*spread+1)) - spread
+			}
+		}
+
+		// Compressors spend a little encoding each run of zeros (about a
+		// byte per 256 for flate and lz4); without taking that off the
+		// random part, highly compressible data falls well short of its
+		// target ratio.
+		if random > 0 && random < len(chunk) {
+			random -= (len(chunk)-random)/256 + 4
+			if random < 1 {
+				random = 1
+			}
+		}
+
+		seq.Fill(chunk[:random])
+
+		for i := random; i < len(chunk); i++ {
+			chunk[i] = 0
+		}
+	}
+}
+
+// TextFill fills the buffer with random lowercase letters.
+func (seq *ByteSequence) TextFill(buf []byte) {
+	if len(buf) == 0 {
+		return
+	}
+
+	temp := C.fillletters(
+		(*C.uint8_t)(unsafe.Pointer(&buf[0])),
+		C.size_t(len(buf)),
+		C.uint64_t(seq.next))
+	seq.next = uint64(temp)
+}
+
+// ZeroFill fills the buffer with zeros.
+func (seq *ByteSequence) ZeroFill(buf []byte) {
+	for i := range buf {
+		buf[i] = 0
+	}
+}
+
+// RepeatFill fills the buffer with pattern, repeated, starting from a
+// random point in the pattern.
+func (seq *ByteSequence) RepeatFill(buf []byte, pattern []byte) {
+	if len(buf) == 0 || len(pattern) == 0 {
+		return
+	}
+
+	seq.next = seq.next*1664525 + 1013904223
+	start := int(mixSeed(seq.next, 0) % uint64(len(pattern)))
+
+	n := copy(buf, pattern[start:])
+	for n < len(buf) {
+		n += copy(buf[n:], pattern)
+	}
+}
+
+// CorpusFill fills each 4KB chunk of the buffer with data copied from a
+// random offset in corpus, wrapping around at the end of the corpus.
+func (seq *ByteSequence) CorpusFill(buf []byte, corpus []byte) {
+	if len(corpus) == 0 {
+		return
+	}
+
+	for len(buf) > 0 {
+		chunk := buf
+		if len(chunk) > compressChunkSize {
+			chunk = chunk[:compressChunkSize]
+		}
+		buf = buf[len(chunk):]
+
+		seq.next = seq.next*1664525 + 1013904223
+		offset := int(mixSeed(seq.next, 0) % uint64(len(corpus)))
+
+		n := copy(chunk, corpus[offset:])
+		for n < len(chunk) {
+			n += copy(chunk[n:], corpus)
+		}
+	}
+}
+
 // Seed sets the sequence's seed to a given value.
 func (seq *ByteSequence) Seed(seed uint64) {
 	seq.next = seed
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"testing"
+)
+
+func TestByteSequence_CompressRatio(t *testing.T) {
+	flateDefault := func(w io.Writer) (io.WriteCloser, error) { return flate.NewWriter(w, flate.DefaultCompression) }
+	flateFast := func(w io.Writer) (io.WriteCloser, error) { return flate.NewWriter(w, flate.BestSpeed) }
+	gzipDefault := func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriter(w), nil }
+
+	tests := []struct {
+		mode            CompressMode
+		compressibility int
+		size            int
+		tolerance       float64 // fraction of target ratio
+	}{
+		{CompressChunk, 0, 16 << 10, 0.02},
+		{CompressChunk, 25, 16 << 10, 0.05},
+		{CompressChunk, 50, 16 << 10, 0.05},
+		{CompressChunk, 75, 16 << 10, 0.05},
+		{CompressChunk, 90, 16 << 10, 0.10},
+		{CompressChunk, 25, 5000, 0.05}, // partial chunk
+		{CompressChunk, 0, 1 << 20, 0.02},
+		{CompressChunk, 10, 1 << 20, 0.05},
+		{CompressChunk, 25, 1 << 20, 0.05},
+		{CompressChunk, 50, 1 << 20, 0.05},
+		{CompressChunk, 75, 1 << 20, 0.05},
+		{CompressChunk, 90, 1 << 20, 0.05},
+		{CompressChunk, 95, 1 << 20, 0.10},
+		{CompressVaried, 0, 1 << 20, 0.02},
+		{CompressVaried, 25, 1 << 20, 0.05},
+		{CompressVaried, 50, 1 << 20, 0.05},
+		{CompressVaried, 75, 1 << 20, 0.05},
+		{CompressVaried, 90, 1 << 20, 0.05},
+		{CompressRuns, 0, 1 << 20, 0.02},
+		{CompressRuns, 50, 1 << 20, 0.05},
+	}
+
+	compressors := []struct {
+		name   string
+		writer func(w io.Writer) (io.WriteCloser, error)
+	}{
+		{"flate-1", flateFast},
+		{"flate-6", flateDefault},
+		{"gzip", gzipDefault},
+	}
+
+	for _, test := range tests {
+		buf := make([]byte, test.size)
+		seq := NewByteSequence(0)
+		seq.Seed(1234)
+		seq.CompressFill(buf, test.compressibility, test.mode)
+
+		target := targetRatio(test.compressibility)
+
+		for _, c := range compressors {
+			ratio := compressionRatio(buf, c.writer)
+
+			if ratio < target*(1-test.tolerance) || ratio > target*(1+test.tolerance) {
+				t.Errorf("%s %d%% (%d bytes) under %s: ratio %.2f, expected %.2f ±%.0f%%",
+					test.mode, test.compressibility, test.size, c.name, ratio, target, test.tolerance*100)
+			}
+		}
+	}
+}
+
+func TestByteSequence_CompressVaried(t *testing.T) {
+	buf := make([]byte, 64*compressChunkSize)
+	seq := NewByteSequence(0)
+	seq.Seed(1234)
+	seq.CompressFill(buf, 50, CompressVaried)
+
+	// Chunks should differ in how much of them is random.
+	zeros := make(map[int]bool)
+
+	for offset := 0; offset < len(buf); offset += compressChunkSize {
+		chunk := buf[offset : offset+compressChunkSize]
+		zeros[(len(chunk)-len(bytes.TrimRight(chunk, "\x00")))/64] = true
+	}
+
+	if len(zeros) < 8 {
+		t.Errorf("expected chunks to vary, got %d distinct zero-run lengths", len(zeros))
+	}
+}
+
+func TestByteSequence_CompressFillRepeatable(t *testing.T) {
+	for mode := CompressRuns; mode < compressModeCount; mode++ {
+		a := make([]byte, 100000)
+		b := make([]byte, 100000)
+
+		seq := NewByteSequence(0)
+		seq.Seed(99)
+		seq.CompressFill(a, 60, mode)
+		seq.Seed(99)
+		seq.CompressFill(b, 60, mode)
+
+		if !bytes.Equal(a, b) {
+			t.Errorf("%s: same seed gave different data", mode)
+		}
+	}
+}
+
+func TestParseCompressMode(t *testing.T) {
+	tests := []struct {
+		in   string
+		mode CompressMode
+	}{
+		{"", CompressRuns},
+		{"runs", CompressRuns},
+		{"chunk", CompressChunk},
+		{"varied", CompressVaried},
+	}
+
+	for _, test := range tests {
+		mode, err := parseCompressMode(test.in)
+		AbortOnError(t, err)
+
+		if mode != test.mode {
+			t.Errorf("'%s': expected %s, got %s", test.in, test.mode, mode)
+		}
+	}
+
+	if _, err := parseCompressMode("zstd"); err == nil {
+		t.Errorf("expected error for unknown mode")
+	}
+}
+
+func TestByteSequence_Patterns(t *testing.T) {
+	seq := NewByteSequence(0)
+	buf := make([]byte, 3*compressChunkSize+100)
+
+	seq.TextFill(buf)
+	for i, b := range buf {
+		if b < 'a' || b > 'z' {
+			t.Fatalf("text: byte %d is 0x%02x", i, b)
+		}
+	}
+
+	seq.ZeroFill(buf)
+	if len(bytes.Trim(buf, "\x00")) != 0 {
+		t.Errorf("zeros: found non-zero data")
+	}
+
+	pattern := []byte("abcdefg")
+	seq.RepeatFill(buf, pattern)
+	start := bytes.IndexByte(pattern, buf[0])
+	for i, b := range buf {
+		if want := pattern[(start+i)%len(pattern)]; b != want {
+			t.Fatalf("repeat: byte %d is '%c', expected '%c'", i, b, want)
+		}
+	}
+
+	corpus := []byte("0123456789abcdefghijklmnopqrstuvwxyz")
+	doubled := append(append([]byte{}, corpus...), corpus...)
+	seq.CorpusFill(buf, corpus)
+	offsets := make(map[byte]bool)
+	for offset := 0; offset < len(buf); offset += compressChunkSize {
+		chunk := buf[offset:]
+		if len(chunk) > compressChunkSize {
+			chunk = chunk[:compressChunkSize]
+		}
+		if !bytes.Contains(bytes.Repeat(corpus, len(chunk)/len(corpus)+2), chunk) {
+			t.Fatalf("corpus: chunk at %d isn't from the corpus", offset)
+		}
+		if !bytes.Contains(doubled, chunk[:len(corpus)]) {
+			t.Fatalf("corpus: chunk at %d doesn't start in the corpus", offset)
+		}
+		offsets[chunk[0]] = true
+	}
+	if len(offsets) < 2 {
+		t.Errorf("corpus: expected chunks to start at different offsets")
+	}
+}
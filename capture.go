@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// CaptureCommand is a command whose output is saved in the run directory,
+// e.g. df or iostat, to record the system's state alongside the results.
+type CaptureCommand struct {
+	Set     string // before, after or periodic; empty for a top-level entry
+	File    string // name of the output file
+	Command *Command
+}
+
+// CaptureConfig are the commands to capture before the run starts, after
+// it stops, and every Interval while it runs.
+type CaptureConfig struct {
+	Before   []CaptureCommand
+	After    []CaptureCommand
+	Periodic []CaptureCommand
+	Interval time.Duration // for Periodic
+}
+
+// captureDir is the run directory's subdirectory for the output of the
+// before, after and periodic commands.
+const captureDir = "capture"
+
+// captureTimeFormat timestamps the output files.
+const captureTimeFormat = "2006-01-02-15-04-05"
+
+// parseCaptureConfig parses reporter.capture. Top-level entries map file
+// names to commands run before the run, as they always have; "before",
+// "after" and "periodic" (which also takes an interval) hold more.
+// "timeout" is the default for all of them. A command may be given as
+// {"command": ..., "timeout": ...} to give it its own timeout.
+//
+//	"capture": {
+//	    "uname.txt": "uname -a",
+//	    "timeout": "10s",
+//	    "after": {"df.txt": "df -h /mnt"},
+//	    "periodic": {"interval": "30s", "commands": {"iostat.txt": "iostat -x"}}
+//	}
+func parseCaptureConfig(raw interface{}) (*CaptureConfig, error) {
+	c := &CaptureConfig{}
+
+	if raw == nil {
+		return c, nil
+	}
+
+	settings, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("reporter.capture must map file names to commands")
+	}
+
+	timeout, err := parseCommandTimeout("reporter.capture.timeout", settings["timeout"])
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range sortedKeys(settings) {
+		value := settings[name]
+
+		switch name {
+		case "timeout":
+
+		case "before", "after":
+			commands, err := parseCaptureCommands(name, value, timeout)
+			if err != nil {
+				return nil, err
+			}
+
+			if name == "before" {
+				c.Before = append(c.Before, commands...)
+			} else {
+				c.After = commands
+			}
+
+		case "periodic":
+			periodic, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("reporter.capture.periodic needs an interval and commands")
+			}
+
+			for key := range periodic {
+				if key != "interval" && key != "commands" {
+					return nil, fmt.Errorf("unknown setting 'reporter.capture.periodic.%s'; use interval and commands", key)
+				}
+			}
+
+			s, _ := periodic["interval"].(string)
+			if c.Interval, err = time.ParseDuration(s); err != nil || c.Interval <= 0 {
+				return nil, fmt.Errorf("reporter.capture.periodic needs an interval such as 30s")
+			}
+
+			if c.Periodic, err = parseCaptureCommands("periodic", periodic["commands"], timeout); err != nil {
+				return nil, err
+			}
+
+		default:
+			command, err := parseCaptureCommand("", name, value, timeout)
+			if err != nil {
+				return nil, err
+			}
+			c.Before = append(c.Before, command)
+		}
+	}
+
+	return c, nil
+}
+
+// parseCaptureCommands parses a set of commands, by file name.
+func parseCaptureCommands(set string, raw interface{}, timeout time.Duration) ([]CaptureCommand, error) {
+	settings, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("reporter.capture.%s must map file names to commands", set)
+	}
+
+	var commands []CaptureCommand
+
+	for _, file := range sortedKeys(settings) {
+		command, err := parseCaptureCommand(set, file, settings[file], timeout)
+		if err != nil {
+			return nil, err
+		}
+		commands = append(commands, command)
+	}
+
+	return commands, nil
+}
+
+func parseCaptureCommand(set, file string, raw interface{}, timeout time.Duration) (c CaptureCommand, err error) {
+	c = CaptureCommand{Set: set, File: file}
+	name := "reporter.capture." + file
+	if len(set) > 0 {
+		name = fmt.Sprintf("reporter.capture.%s.%s", set, file)
+	}
+
+	if filepath.Base(file) != file || file == "." || file == ".." {
+		return c, fmt.Errorf("%s: the file name can't be a path", name)
+	}
+
+	if c.Command, err = parseCommand(name, raw, timeout); err != nil {
+		return c, err
+	}
+
+	if c.Command == nil {
+		return c, fmt.Errorf("%s has no command", name)
+	}
+
+	return c, nil
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// path returns where the command's output goes when run at t. Top-level
+// entries keep the file name they're given; the rest are timestamped, in
+// the capture directory.
+func (c *CaptureCommand) path(dir string, t time.Time) string {
+	if len(c.Set) == 0 {
+		return filepath.Join(dir, c.File)
+	}
+
+	return filepath.Join(dir, captureDir, fmt.Sprintf("%s-%s-%s", c.Set, t.Format(captureTimeFormat), c.File))
+}
+
+// capture runs commands one after another, saving their stdout, and their
+// stderr (if any) alongside it with .stderr added to the name. A command
+// that fails or times out is logged, and whatever output it gave saved
+// along with the error, rather than stopping the run. Commands still
+// running when ctx is done are killed.
+func (r *Reporter) capture(ctx context.Context, phase string, commands []CaptureCommand) {
+	for i := range commands {
+		c := &commands[i]
+		start := time.Now()
+
+		out, stderr, e := c.Command.Run(ctx, phase)
+
+		if ctx.Err() != nil {
+			return // the run has stopped
+		}
+
+		if e != nil {
+			r.Warnf("capture %s: %s", c.File, e)
+			out = append(out, fmt.Sprintf("\n(capture failed: %s)\n", e)...)
+		}
+
+		path := c.path(r.dir, start)
+
+		if e := os.MkdirAll(filepath.Dir(path), 0750); e != nil {
+			r.Warnf("capture %s: %s", c.File, e)
+			continue
+		}
+
+		if e := os.WriteFile(path, out, 0664); e != nil {
+			r.Warnf("capture %s: cannot write %s: %s", c.File, path, e)
+		}
+
+		if len(stderr) > 0 {
+			if e := os.WriteFile(path+".stderr", stderr, 0664); e != nil {
+				r.Warnf("capture %s: cannot write %s.stderr: %s", c.File, path, e)
+			}
+		}
+	}
+}
+
+// capturePeriodic runs the periodic commands every interval while the run
+// goes on. If they take longer than the interval, the next run of them
+// waits for the following tick.
+func (r *Reporter) capturePeriodic(ctx context.Context) {
+	config := r.config.Capture
+
+	if config == nil || len(config.Periodic) == 0 {
+		return
+	}
+
+	select {
+	case <-ctx.Done():
+		return
+	case <-global.Start:
+	}
+
+	t := time.NewTicker(config.Interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			r.capture(ctx, "periodic", config.Periodic)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCaptureConfig(t *testing.T) {
+	c, err := parseCaptureConfig(map[string]interface{}{
+		"uname.txt": "uname -a",
+		"timeout":   "10s",
+		"before":    map[string]interface{}{"df.txt": "df -h"},
+		"after": map[string]interface{}{
+			"df.txt":    "df -h",
+			"dmesg.txt": map[string]interface{}{"command": "dmesg", "timeout": "1s"},
+		},
+		"periodic": map[string]interface{}{
+			"interval": "30s",
+			"commands": map[string]interface{}{"iostat.txt": "iostat -x"},
+		},
+	})
+	AbortOnError(t, err)
+
+	expect := func(set, file, command string, timeout time.Duration, c CaptureCommand) {
+		t.Helper()
+		ExpectEqual(t, set, c.Set)
+		ExpectEqual(t, file, c.File)
+		ExpectEqual(t, command, c.Command.String())
+		ExpectEqual(t, timeout, c.Command.Timeout)
+	}
+
+	ExpectEqual(t, 2, len(c.Before))
+	expect("before", "df.txt", "df -h", 10*time.Second, c.Before[0])
+	expect("", "uname.txt", "uname -a", 10*time.Second, c.Before[1])
+	ExpectEqual(t, 2, len(c.After))
+	expect("after", "dmesg.txt", "dmesg", time.Second, c.After[1])
+	ExpectEqual(t, 1, len(c.Periodic))
+	expect("periodic", "iostat.txt", "iostat -x", 10*time.Second, c.Periodic[0])
+	ExpectEqual(t, 30*time.Second, c.Interval)
+
+	c, err = parseCaptureConfig(nil)
+	AbortOnError(t, err)
+	ExpectEqual(t, 0, len(c.Before)+len(c.After)+len(c.Periodic))
+
+	for _, c := range []struct {
+		raw      interface{}
+		expected string
+	}{
+		{"df -h", "reporter.capture must map file names to commands"},
+		{map[string]interface{}{"timeout": "soon"}, "invalid reporter.capture.timeout 'soon': expected a duration such as 10s"},
+		{map[string]interface{}{"after": "df -h"}, "reporter.capture.after must map file names to commands"},
+		{map[string]interface{}{"df.txt": 12}, "reporter.capture.df.txt must be a command string or a list of strings"},
+		{map[string]interface{}{"df.txt": ""}, "reporter.capture.df.txt has no command"},
+		{map[string]interface{}{"../df.txt": "df"}, "reporter.capture.../df.txt: the file name can't be a path"},
+		{map[string]interface{}{"before": map[string]interface{}{"df.txt": map[string]interface{}{"cmd": "df"}}},
+			"unknown setting 'reporter.capture.before.df.txt.cmd'; use command and timeout"},
+		{map[string]interface{}{"after": map[string]interface{}{"df.txt": map[string]interface{}{"command": "df", "timeout": "-1s"}}},
+			"invalid reporter.capture.after.df.txt.timeout '-1s': expected a duration such as 10s"},
+		{map[string]interface{}{"periodic": "df"}, "reporter.capture.periodic needs an interval and commands"},
+		{map[string]interface{}{"periodic": map[string]interface{}{"commands": map[string]interface{}{}}},
+			"reporter.capture.periodic needs an interval such as 30s"},
+		{map[string]interface{}{"periodic": map[string]interface{}{"interval": "1s", "every": "1s"}},
+			"unknown setting 'reporter.capture.periodic.every'; use interval and commands"},
+		{map[string]interface{}{"periodic": map[string]interface{}{"interval": "1s"}},
+			"reporter.capture.periodic must map file names to commands"},
+	} {
+		_, err := parseCaptureConfig(c.raw)
+		if err == nil || err.Error() != c.expected {
+			t.Errorf("%v: expected %q, got %v", c.raw, c.expected, err)
+		}
+	}
+}
+
+func TestReporter_Capture(t *testing.T) {
+	r := &Reporter{SugaredLogger: Logger(), dir: t.TempDir()}
+
+	r.capture(context.Background(), "after", []CaptureCommand{
+		{File: "echo.txt", Command: &Command{Shell: "echo hello; echo oops >&2"}},
+		{Set: "after", File: "fails.txt", Command: &Command{Argv: []string{"false"}}},
+		{Set: "after", File: "slow.txt", Command: &Command{Shell: "sleep 10", Timeout: 50 * time.Millisecond}},
+	})
+
+	out, err := os.ReadFile(filepath.Join(r.dir, "echo.txt"))
+	AbortOnError(t, err)
+	ExpectEqual(t, "hello\n", string(out))
+
+	out, err = os.ReadFile(filepath.Join(r.dir, "echo.txt.stderr"))
+	AbortOnError(t, err)
+	ExpectEqual(t, "oops\n", string(out))
+
+	for file, expected := range map[string]string{
+		"fails.txt": "(capture failed: running 'false': exit status 1)",
+		"slow.txt":  "(capture failed: running 'sleep 10': timed out after 50ms)",
+	} {
+		paths, _ := filepath.Glob(filepath.Join(r.dir, captureDir, "after-*-"+file))
+		if len(paths) != 1 {
+			t.Errorf("expected one capture of %s, got %v", file, paths)
+			continue
+		}
+
+		out, err := os.ReadFile(paths[0])
+		AbortOnError(t, err)
+
+		if !strings.Contains(string(out), expected) {
+			t.Errorf("%s: expected %q, got %q", file, expected, out)
+		}
+	}
+
+	// Nothing is saved once the run has stopped
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r.capture(ctx, "periodic", []CaptureCommand{{Set: "periodic", File: "late.txt", Command: &Command{Shell: "echo late"}}})
+
+	if paths, _ := filepath.Glob(filepath.Join(r.dir, captureDir, "periodic-*")); len(paths) > 0 {
+		t.Errorf("expected no capture after stopping, got %v", paths)
+	}
+}
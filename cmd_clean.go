@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// subdirName matches the subdirectories a store makes for its objects.
+var subdirName = regexp.MustCompile(`^dir-[0-9]+$`)
+
+// cleanCommand implements "perftest clean": delete the objects that runs
+// left under the config's paths (or the paths given). Only files named like
+// objects are deleted, and then the store's subdirectories if that leaves
+// them empty, so anything else on the paths is safe.
+func cleanCommand(args []string) int {
+	flags := pflag.NewFlagSet("clean", pflag.ContinueOnError)
+	config := addConfigFlags(flags)
+	dryRun := flags.Bool("dry-run", false, "show what would be deleted without deleting it")
+	flags.Usage = func() {
+		fmt.Printf("usage: perftest clean [flags] [path...]\n")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	paths := flags.Args()
+
+	if len(paths) == 0 {
+		if err := config.load(nil); err != nil {
+			fmt.Printf("%s\n", err)
+			return 1
+		}
+
+		var err error
+		if paths, err = configPaths(); err != nil {
+			fmt.Printf("%s: %s\n", viper.ConfigFileUsed(), err)
+			return 1
+		}
+
+		if len(paths) == 0 {
+			fmt.Printf("%s: no paths to clean\n", viper.ConfigFileUsed())
+			return 1
+		}
+	}
+
+	failed := 0
+
+	for _, path := range paths {
+		objects, bytes, err := cleanPath(path, *dryRun)
+
+		if *dryRun {
+			fmt.Printf("%s: would delete %d objects (%s)\n", path, objects, SprintSize(bytes))
+		} else {
+			fmt.Printf("%s: deleted %d objects (%s)\n", path, objects, SprintSize(bytes))
+		}
+
+		if err != nil {
+			fmt.Printf("%s: %s\n", path, err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return 1
+	}
+
+	return 0
+}
+
+// cleanPath deletes the objects under path (unless dryRun), returning how
+// many there were and their total size.
+func cleanPath(path string, dryRun bool) (objects int, bytes int64, err error) {
+	var failures []error
+
+	err = walkObjects(path, func(object string, info os.FileInfo) {
+		if !dryRun {
+			if e := os.Remove(object); e != nil {
+				failures = append(failures, e)
+				return
+			}
+		}
+
+		objects++
+		bytes += info.Size()
+	})
+
+	if err != nil {
+		return objects, bytes, err
+	}
+
+	if len(failures) > 0 {
+		return objects, bytes, fmt.Errorf("cannot delete %d objects, e.g. %s", len(failures), failures[0])
+	}
+
+	if !dryRun {
+		entries, _ := os.ReadDir(path)
+
+		for _, entry := range entries {
+			if entry.IsDir() && subdirName.MatchString(entry.Name()) {
+				_ = os.Remove(filepath.Join(path, entry.Name())) // fails unless empty
+			}
+		}
+	}
+
+	return objects, bytes, nil
+}
+
+// configPaths returns every path that the config's jobs (in any phase) or
+// trace replay write to.
+func configPaths() ([]string, error) {
+	phases, err := parsePhases()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(phases) == 0 {
+		phases = []*Phase{nil}
+	}
+
+	var paths []string
+	seen := make(map[string]bool)
+
+	add := func(path string) {
+		if len(path) > 0 && !seen[path] {
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+
+	for _, phase := range phases {
+		configs, err := jobConfigs(phase)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, v := range configs {
+			for _, path := range v.GetStringSlice("file.paths") {
+				add(path)
+			}
+		}
+	}
+
+	add(viper.GetString("replay.path"))
+	return paths, nil
+}
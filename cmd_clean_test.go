@@ -0,0 +1,72 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestCleanPath(t *testing.T) {
+	dir := t.TempDir()
+	AbortOnError(t, os.MkdirAll(filepath.Join(dir, "dir-0"), 0755))
+	AbortOnError(t, os.MkdirAll(filepath.Join(dir, "dir-1"), 0755))
+
+	for _, name := range []string{
+		"01ARZ3NDEKTSV4RRFFQ69G5FAV.dat",
+		"dir-0/01BX5ZZKBKACTAV9WEVGEMMVRZ.txt",
+		"dir-1/01BX5ZZKBKACTAV9WEVGEMMVS0",
+		"dir-1/notes.txt",
+		"results.csv",
+	} {
+		AbortOnError(t, os.WriteFile(filepath.Join(dir, name), []byte("1234"), 0644))
+	}
+
+	objects, bytes, err := cleanPath(dir, true)
+	AbortOnError(t, err)
+	ExpectEqual(t, 3, objects)
+	ExpectEqual(t, int64(12), bytes)
+
+	_, err = os.Stat(filepath.Join(dir, "01ARZ3NDEKTSV4RRFFQ69G5FAV.dat"))
+	AbortOnErrorf(t, err, "dry run deleted an object")
+
+	objects, bytes, err = cleanPath(dir, false)
+	AbortOnError(t, err)
+	ExpectEqual(t, 3, objects)
+	ExpectEqual(t, int64(12), bytes)
+
+	// Only objects go, and then only the subdirectories left empty
+	for name, exists := range map[string]bool{
+		"01ARZ3NDEKTSV4RRFFQ69G5FAV.dat":   false,
+		"dir-0":                            false,
+		"dir-1":                            true,
+		"dir-1/01BX5ZZKBKACTAV9WEVGEMMVS0": false,
+		"dir-1/notes.txt":                  true,
+		"results.csv":                      true,
+	} {
+		if _, err = os.Stat(filepath.Join(dir, name)); (err == nil) != exists {
+			t.Errorf("%s: expected exists %v, got %v", name, exists, err == nil)
+		}
+	}
+
+	_, _, err = cleanPath(filepath.Join(dir, "missing"), false)
+	ExpectError(t, err)
+}
+
+func TestConfigPaths(t *testing.T) {
+	defer viper.Reset()
+
+	readTestConfig(t, `{
+		"file": {"paths": ["/mnt/a"]},
+		"jobs": [{"name": "one"}, {"name": "two", "file": {"paths": ["/mnt/b", "/mnt/a"]}}],
+		"phases": [{"name": "fill", "bytes": "1GB"}, {"name": "more", "file": {"paths": ["/mnt/c"]}}]
+	}`)
+
+	paths, err := configPaths()
+	AbortOnError(t, err)
+	ExpectEqual(t, 3, len(paths))
+	ExpectEqual(t, "/mnt/a", paths[0])
+	ExpectEqual(t, "/mnt/b", paths[1])
+	ExpectEqual(t, "/mnt/c", paths[2])
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// compareLimits decide which changes count as regressions.
+type compareLimits struct {
+	Throughput float64 // percent drop in bandwidth or IOPS
+	Latency    float64 // percent rise in latency
+	Alpha      float64 // p-value below which a change is significant
+}
+
+// comparison is one metric of one op in two runs.
+type comparison struct {
+	Op         string
+	Metric     string
+	A, B       float64
+	Change     float64 // percent, B relative to A; NaN if A is 0
+	P          float64 // NaN if there aren't interval samples to test
+	Regression bool
+	format     func(float64) string
+}
+
+// compareCommand implements "perftest compare <runA> <runB>": show how the
+// configs differ and how B's results changed from A's, exiting with 1 if
+// any change is a regression beyond the limits (e.g. to gate a release).
+func compareCommand(args []string) int {
+	flags := pflag.NewFlagSet("compare", pflag.ContinueOnError)
+	limits := compareLimits{}
+	flags.Float64Var(&limits.Throughput, "threshold", 5, "percent drop in bandwidth or IOPS that counts as a regression")
+	flags.Float64Var(&limits.Latency, "latency-threshold", 10, "percent rise in latency that counts as a regression")
+	flags.Float64Var(&limits.Alpha, "alpha", 0.05, "significance level for bandwidth and IOPS changes")
+	flags.Usage = func() {
+		fmt.Printf("usage: perftest compare [flags] <runA> <runB>\n")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return 2
+	}
+
+	dirA, dirB := flags.Arg(0), flags.Arg(1)
+	var runs [2]*RunSummary
+
+	for i, dir := range []string{dirA, dirB} {
+		var err error
+		if runs[i], err = ReadRunSummary(filepath.Join(dir, "summary.json")); err != nil {
+			fmt.Printf("%s (was %s a complete run?)\n", err, dir)
+			return 2
+		}
+	}
+
+	fmt.Printf("A: %s (%.1f sec, %s)\n", dirA, runs[0].Duration, runs[0].End)
+	fmt.Printf("B: %s (%.1f sec, %s)\n", dirB, runs[1].Duration, runs[1].End)
+
+	if diffs, err := diffConfigs(filepath.Join(dirA, "config.json"), filepath.Join(dirB, "config.json")); err != nil {
+		fmt.Printf("cannot compare configs: %s\n", err)
+	} else if len(diffs) == 0 {
+		fmt.Printf("\nconfigs are the same\n")
+	} else {
+		fmt.Printf("\nconfig differences:\n")
+		for _, d := range diffs {
+			fmt.Printf("  %s\n", d)
+		}
+	}
+
+	for _, op := range []string{opName(Read), opName(Write), opName(Delete)} {
+		_, inA := runs[0].Ops[op]
+		_, inB := runs[1].Ops[op]
+
+		if inA && !inB {
+			fmt.Printf("\n%s: only in A\n", op)
+		} else if inB && !inA {
+			fmt.Printf("\n%s: only in B\n", op)
+		}
+	}
+
+	results := compareRuns(runs[0], runs[1], limits)
+	regressions := 0
+
+	fmt.Printf("\n")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "op\tmetric\tA\tB\tchange\tp\t\n")
+
+	for _, c := range results {
+		change, p, flag := "n/a", "", ""
+
+		if !math.IsNaN(c.Change) {
+			change = fmt.Sprintf("%+.1f%%", c.Change)
+		}
+		if !math.IsNaN(c.P) {
+			p = fmt.Sprintf("%.3f", c.P)
+		}
+		if c.Regression {
+			flag = "REGRESSION"
+			regressions++
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", c.Op, c.Metric, c.format(c.A), c.format(c.B), change, p, flag)
+	}
+
+	_ = w.Flush()
+
+	if regressions > 0 {
+		fmt.Printf("\n%d regressions (thresholds: %g%% throughput, %g%% latency)\n", regressions, limits.Throughput, limits.Latency)
+		return 1
+	}
+
+	fmt.Printf("\nno regressions\n")
+	return 0
+}
+
+// compareRuns compares each op's bandwidth, IOPS and latencies in two
+// runs. Bandwidth and IOPS are tested for significance over the runs'
+// intervals, so a drop only counts as a regression if it's beyond the
+// threshold and not likely to be noise; latency percentiles are summaries
+// of every op, so only the threshold applies.
+func compareRuns(a, b *RunSummary, limits compareLimits) []comparison {
+	var results []comparison
+
+	for _, op := range []string{opName(Read), opName(Write), opName(Delete)} {
+		oa, okA := a.Ops[op]
+		ob, okB := b.Ops[op]
+
+		if !okA || !okB {
+			continue
+		}
+
+		if oa.Bytes > 0 || ob.Bytes > 0 {
+			c := newComparison(op, "bandwidth", float64(oa.BandwidthMean), float64(ob.BandwidthMean), formatBandwidth)
+			c.test(int64sToFloats(oa.BandwidthIntervals), int64sToFloats(ob.BandwidthIntervals))
+			c.Regression = c.Change < -limits.Throughput && (math.IsNaN(c.P) || c.P < limits.Alpha)
+			results = append(results, c)
+		}
+
+		c := newComparison(op, "iops", oa.IOPS, ob.IOPS, formatIOPS)
+		c.test(oa.IOPSIntervals, ob.IOPSIntervals)
+		c.Regression = c.Change < -limits.Throughput && (math.IsNaN(c.P) || c.P < limits.Alpha)
+		results = append(results, c)
+
+		latency := func(metric string, a, b float64) {
+			c := newComparison(op, metric, a, b, formatLatency)
+			c.Regression = c.Change > limits.Latency
+			results = append(results, c)
+		}
+
+		latency("latency mean", oa.LatencyMean, ob.LatencyMean)
+
+		for _, p := range Percentiles {
+			name := percentileName(p)
+			latency("latency "+name, oa.Latency[name], ob.Latency[name])
+		}
+	}
+
+	return results
+}
+
+func newComparison(op, metric string, a, b float64, format func(float64) string) comparison {
+	c := comparison{Op: op, Metric: metric, A: a, B: b, Change: math.NaN(), P: math.NaN(), format: format}
+
+	if a != 0 {
+		c.Change = (b - a) / a * 100
+	}
+
+	return c
+}
+
+// test sets the p-value of the change from the runs' interval samples.
+func (c *comparison) test(a, b []float64) {
+	if p, ok := welchTTest(a, b); ok {
+		c.P = p
+	}
+}
+
+func int64sToFloats(data []int64) []float64 {
+	f := make([]float64, len(data))
+	for i, d := range data {
+		f[i] = float64(d)
+	}
+	return f
+}
+
+func formatBandwidth(f float64) string {
+	return SprintSize(int64(f)) + "/sec"
+}
+
+func formatIOPS(f float64) string {
+	return fmt.Sprintf("%.0f", f)
+}
+
+func formatLatency(f float64) string {
+	return SprintDuration(time.Duration(f * float64(time.Second)))
+}
+
+// diffConfigs lists the settings that differ between two config files,
+// e.g. `iosize: "64KB" -> "1MB"`.
+func diffConfigs(pathA, pathB string) ([]string, error) {
+	var settings [2]map[string]string
+
+	for i, path := range []string{pathA, pathB} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		config := make(map[string]interface{})
+		if err = json.Unmarshal(data, &config); err != nil {
+			return nil, fmt.Errorf("cannot parse %s: %s", path, err)
+		}
+
+		settings[i] = make(map[string]string)
+		flattenConfig(config, "", settings[i])
+	}
+
+	keys := make(map[string]bool)
+	for _, s := range settings {
+		for key := range s {
+			keys[key] = true
+		}
+	}
+
+	var diffs []string
+
+	for key := range keys {
+		a, inA := settings[0][key]
+		b, inB := settings[1][key]
+
+		switch {
+		case !inA:
+			a = "(unset)"
+		case !inB:
+			b = "(unset)"
+		case a == b:
+			continue
+		}
+
+		diffs = append(diffs, fmt.Sprintf("%s: %s -> %s", key, a, b))
+	}
+
+	sort.Strings(diffs)
+	return diffs, nil
+}
+
+// flattenConfig adds each setting in config to settings by its dotted,
+// lowercase key (as viper names it), with its value as JSON.
+func flattenConfig(config map[string]interface{}, prefix string, settings map[string]string) {
+	for key, value := range config {
+		key = prefix + strings.ToLower(key)
+
+		if section, ok := value.(map[string]interface{}); ok && len(section) > 0 {
+			flattenConfig(section, key+".", settings)
+			continue
+		}
+
+		data, _ := json.Marshal(value)
+		settings[key] = string(data)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testOpSummary(bandwidth []int64, iops []float64, p99 float64) *OpSummary {
+	s := &OpSummary{
+		Bytes:              1,
+		BandwidthMean:      Mean(bandwidth),
+		BandwidthIntervals: bandwidth,
+		IOPSIntervals:      iops,
+		LatencyMean:        p99 / 2,
+		Latency:            map[string]float64{"p99": p99},
+	}
+	s.IOPS, _ = meanVariance(iops)
+	return s
+}
+
+func findComparison(t *testing.T, results []comparison, op, metric string) comparison {
+	t.Helper()
+	for _, c := range results {
+		if c.Op == op && c.Metric == metric {
+			return c
+		}
+	}
+	t.Fatalf("no comparison of %s %s", op, metric)
+	return comparison{}
+}
+
+func TestCompareRuns(t *testing.T) {
+	limits := compareLimits{Throughput: 5, Latency: 10, Alpha: 0.05}
+
+	a := &RunSummary{Ops: map[string]*OpSummary{
+		"read":  testOpSummary([]int64{100, 102, 98, 101, 99}, []float64{10, 11, 9, 10, 10}, 0.010),
+		"write": testOpSummary([]int64{100, 150, 50, 120, 80}, []float64{10, 10, 10, 10, 10}, 0.010),
+	}}
+	b := &RunSummary{Ops: map[string]*OpSummary{
+		// A consistent 10% drop, and latency up 20%
+		"read": testOpSummary([]int64{90, 92, 88, 91, 89}, []float64{10, 11, 9, 10, 10}, 0.012),
+		// A 10% drop that's within the noise
+		"write":  testOpSummary([]int64{90, 140, 40, 110, 70}, []float64{10, 10, 10, 10, 10}, 0.0105),
+		"delete": testOpSummary(nil, nil, 0),
+	}}
+
+	results := compareRuns(a, b, limits)
+
+	c := findComparison(t, results, "read", "bandwidth")
+	expectNear(t, "read change", -10, c.Change, 0.01)
+	ExpectEqual(t, true, c.P < 0.001)
+	ExpectEqual(t, true, c.Regression)
+
+	c = findComparison(t, results, "read", "iops")
+	ExpectEqual(t, false, c.Regression)
+
+	c = findComparison(t, results, "read", "latency p99")
+	expectNear(t, "p99 change", 20, c.Change, 0.01)
+	ExpectEqual(t, true, math.IsNaN(c.P))
+	ExpectEqual(t, true, c.Regression)
+
+	c = findComparison(t, results, "write", "bandwidth")
+	expectNear(t, "write change", -10, c.Change, 0.01)
+	ExpectEqual(t, true, c.P > 0.05)
+	ExpectEqual(t, false, c.Regression)
+
+	ExpectEqual(t, false, findComparison(t, results, "write", "latency p99").Regression)
+
+	// Ops in only one run aren't compared
+	for _, c := range results {
+		if c.Op == "delete" {
+			t.Errorf("compared delete, which is only in one run")
+		}
+	}
+}
+
+func TestDiffConfigs(t *testing.T) {
+	dir := t.TempDir()
+	pathA := filepath.Join(dir, "a.json")
+	pathB := filepath.Join(dir, "b.json")
+
+	AbortOnError(t, os.WriteFile(pathA, []byte(`{"iosize": "64KB", "File": {"paths": ["/a"], "sync": "none"}, "read": 0}`), 0644))
+	AbortOnError(t, os.WriteFile(pathB, []byte(`{"iosize": "1MB", "file": {"paths": ["/a"]}, "read": 0, "seed": 7}`), 0644))
+
+	diffs, err := diffConfigs(pathA, pathB)
+	AbortOnError(t, err)
+
+	ExpectEqual(t, `file.sync: "none" -> (unset)|iosize: "64KB" -> "1MB"|seed: (unset) -> 7`, strings.Join(diffs, "|"))
+
+	_, err = diffConfigs(pathA, filepath.Join(dir, "missing.json"))
+	ExpectError(t, err)
+}
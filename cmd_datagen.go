@@ -0,0 +1,219 @@
+package main
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/pflag"
+)
+
+// datagenCommand implements "perftest datagen": write generated data to a
+// file (to try with other compressors or storage), or with --check, report
+// the compression ratios each mode actually achieves under the standard
+// library's compressors.
+func datagenCommand(args []string) int {
+	flags := pflag.NewFlagSet("datagen", pflag.ContinueOnError)
+	check := flags.Bool("check", false, "report achieved compression ratios instead of writing data")
+	modeName := flags.String("mode", "runs", "compress mode: runs, chunk, or varied")
+	patternName := flags.String("pattern", "random", "data pattern: random, zeros, text, repeat, or corpus")
+	repeat := flags.String("repeat", "", "string to repeat for the repeat pattern")
+	corpus := flags.String("corpus", "", "file to sample for the corpus pattern")
+	compressibility := flags.Int("compressibility", 50, "compressibility (0-100)")
+	sizeStr := flags.String("size", "16MB", "amount of data to generate")
+	output := flags.String("output", "", "file to write data to ('-' for stdout)")
+	seed := flags.Uint64("seed", defaultSeed, "data seed")
+	flags.Usage = func() {
+		fmt.Printf("usage: perftest datagen --output <file> [flags]\n")
+		fmt.Printf("       perftest datagen --check [flags]\n")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	mode, err := parseCompressMode(*modeName)
+	if err != nil {
+		fmt.Printf("%s\n", err)
+		return 2
+	}
+
+	pattern, err := parseDataPattern(*patternName)
+	if err != nil {
+		fmt.Printf("%s\n", err)
+		return 2
+	}
+
+	header := &ObjectHeader{
+		Compressibility: uint32(*compressibility),
+		CompressMode:    uint8(mode),
+		Pattern:         uint8(pattern),
+	}
+
+	switch {
+	case pattern == PatternRepeat && len(*repeat) == 0:
+		err = fmt.Errorf("repeat pattern needs --repeat")
+	case pattern == PatternRepeat:
+		header.PatternSource = registerPatternSource([]byte(*repeat))
+	case pattern == PatternCorpus && len(*corpus) == 0:
+		err = fmt.Errorf("corpus pattern needs --corpus")
+	case pattern == PatternCorpus:
+		header.PatternSource, err = loadCorpus(*corpus)
+	}
+
+	if err != nil {
+		fmt.Printf("%s\n", err)
+		return 2
+	}
+
+	if *compressibility < 0 || *compressibility > 100 {
+		fmt.Printf("compressibility must be between 0 and 100\n")
+		return 2
+	}
+
+	size, err := parseSizeInBytes(*sizeStr)
+	if err != nil || size <= 0 {
+		fmt.Printf("bad size '%s'\n", *sizeStr)
+		return 2
+	}
+
+	if *check && pattern != PatternRandom {
+		checkPattern(os.Stdout, header, int(size), *seed)
+		return 0
+	}
+
+	if *check {
+		// Unless asked about one in particular, check every mode and a
+		// spread of compressibility levels.
+		modes := []CompressMode{mode}
+		if !flags.Changed("mode") {
+			modes = []CompressMode{CompressRuns, CompressChunk, CompressVaried}
+		}
+
+		levels := []int{*compressibility}
+		if !flags.Changed("compressibility") {
+			levels = []int{0, 25, 50, 75, 90}
+		}
+
+		checkCompression(os.Stdout, modes, levels, int(size), *seed)
+		return 0
+	}
+
+	if len(*output) == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	buf := make([]byte, size)
+	seq := NewByteSequence(0)
+	seq.Seed(*seed)
+	fillData(header, buf, seq)
+
+	if *output == "-" {
+		_, err = os.Stdout.Write(buf)
+	} else {
+		err = os.WriteFile(*output, buf, 0664)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cannot write data: %s\n", err)
+		return 1
+	}
+
+	return 0
+}
+
+// compressors are the ones checkCompression reports on; all are in the
+// standard library so the check needs nothing installed.
+var compressors = []struct {
+	name   string
+	writer func(w io.Writer) (io.WriteCloser, error)
+}{
+	{"flate-1", func(w io.Writer) (io.WriteCloser, error) { return flate.NewWriter(w, flate.BestSpeed) }},
+	{"flate-6", func(w io.Writer) (io.WriteCloser, error) { return flate.NewWriter(w, flate.DefaultCompression) }},
+	{"flate-9", func(w io.Writer) (io.WriteCloser, error) { return flate.NewWriter(w, flate.BestCompression) }},
+	{"gzip", func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriter(w), nil }},
+}
+
+// checkCompression prints a table of target vs. achieved compression ratio
+// for each mode and compressibility level.
+func checkCompression(out io.Writer, modes []CompressMode, levels []int, size int, seed uint64) {
+	buf := make([]byte, size)
+	seq := NewByteSequence(0)
+
+	fmt.Fprintf(out, "%-8s %8s %8s", "mode", "compress", "target")
+	for _, c := range compressors {
+		fmt.Fprintf(out, " %8s", c.name)
+	}
+	fmt.Fprintf(out, "\n")
+
+	for _, mode := range modes {
+		for _, level := range levels {
+			seq.Seed(seed)
+			seq.CompressFill(buf, level, mode)
+
+			fmt.Fprintf(out, "%-8s %7d%% %8s", mode, level, sprintRatio(targetRatio(level)))
+			for _, c := range compressors {
+				fmt.Fprintf(out, " %8s", sprintRatio(compressionRatio(buf, c.writer)))
+			}
+			fmt.Fprintf(out, "\n")
+		}
+	}
+}
+
+// checkPattern prints the compression ratios achieved for a data pattern
+// other than random, which has no target.
+func checkPattern(out io.Writer, h *ObjectHeader, size int, seed uint64) {
+	buf := make([]byte, size)
+	seq := NewByteSequence(0)
+	seq.Seed(seed)
+	fillData(h, buf, seq)
+
+	fmt.Fprintf(out, "%-8s", "pattern")
+	for _, c := range compressors {
+		fmt.Fprintf(out, " %8s", c.name)
+	}
+	fmt.Fprintf(out, "\n%-8s", DataPattern(h.Pattern))
+	for _, c := range compressors {
+		fmt.Fprintf(out, " %8s", sprintRatio(compressionRatio(buf, c.writer)))
+	}
+	fmt.Fprintf(out, "\n")
+}
+
+// targetRatio is the compression ratio a compressibility level aims for.
+func targetRatio(compressibility int) float64 {
+	return 100 / float64(100-compressibility)
+}
+
+func sprintRatio(ratio float64) string {
+	if ratio > 1000 {
+		return ">1000"
+	}
+	return fmt.Sprintf("%.2f", ratio)
+}
+
+// compressionRatio returns the ratio of len(data) to its compressed size.
+func compressionRatio(data []byte, writer func(w io.Writer) (io.WriteCloser, error)) float64 {
+	var counter byteCounter
+
+	w, err := writer(&counter)
+	if err != nil {
+		panic(err) // only for invalid levels
+	}
+
+	_, _ = w.Write(data)
+	_ = w.Close()
+
+	return float64(len(data)) / float64(counter)
+}
+
+// byteCounter is an io.Writer that only counts what's written to it.
+type byteCounter int64
+
+func (c *byteCounter) Write(p []byte) (int, error) {
+	*c += byteCounter(len(p))
+	return len(p), nil
+}
@@ -0,0 +1,504 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// reportData is everything that goes into a run's HTML report.
+type reportData struct {
+	RunId     string
+	Generated string
+	Summary   *RunSummary
+	Ops       []reportOp
+	Charts    []template.HTML
+	Captures  []reportFile
+	Config    string
+	Notes     []string // about anything missing
+}
+
+type reportOp struct {
+	Name    string
+	Summary *OpSummary
+}
+
+type reportFile struct {
+	Name     string
+	Command  string
+	Contents string
+}
+
+// reportCommand implements "perftest report <rundir>": write a single HTML
+// file, with no external assets, showing a run's results.
+func reportCommand(args []string) int {
+	flags := pflag.NewFlagSet("report", pflag.ContinueOnError)
+	output := flags.String("output", "", "file to write (default report.html in the run directory)")
+	flags.Usage = func() {
+		fmt.Printf("usage: perftest report [flags] <rundir>\n")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	dir := flags.Arg(0)
+
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		fmt.Printf("%s isn't a run directory\n", dir)
+		return 2
+	}
+
+	if len(*output) == 0 {
+		*output = filepath.Join(dir, "report.html")
+	}
+
+	data, err := loadReport(dir)
+	if err != nil {
+		fmt.Printf("%s\n", err)
+		return 2
+	}
+
+	f, err := os.Create(*output)
+	if err != nil {
+		fmt.Printf("cannot write report: %s\n", err)
+		return 1
+	}
+
+	if err = reportTemplate.Execute(f, data); err != nil {
+		_ = f.Close()
+		fmt.Printf("cannot write report: %s\n", err)
+		return 1
+	}
+
+	if err = f.Close(); err != nil {
+		fmt.Printf("cannot write report: %s\n", err)
+		return 1
+	}
+
+	fmt.Printf("wrote %s\n", *output)
+	return 0
+}
+
+// loadReport gathers what a run left in its directory. Only the config is
+// required; anything else missing (e.g. from a run that was killed, or
+// without reporter.logbandwidth) is left out of the report with a note.
+func loadReport(dir string) (*reportData, error) {
+	data := &reportData{
+		RunId:     filepath.Base(filepath.Clean(dir)),
+		Generated: time.Now().Format("2006-01-02 15:04:05"),
+	}
+
+	configPath := filepath.Join(dir, "config.json")
+	raw, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read config: %s", err)
+	}
+
+	config := make(map[string]interface{})
+	if err = json.Unmarshal(raw, &config); err != nil {
+		return nil, fmt.Errorf("cannot parse %s: %s", configPath, err)
+	}
+
+	// Show the resolved config, with the defaults the run used as well, if
+	// the run saved it
+	if resolved, err := os.ReadFile(filepath.Join(dir, "config-resolved.json")); err == nil {
+		raw = resolved
+	}
+
+	data.Config = string(raw)
+
+	if data.Summary, err = ReadRunSummary(filepath.Join(dir, "summary.json")); err != nil {
+		data.Notes = append(data.Notes, "No summary.json; the run may not have finished.")
+		data.Summary = &RunSummary{RunId: data.RunId}
+	} else {
+		data.RunId = data.Summary.RunId
+	}
+
+	for _, op := range []int{Read, Write, Delete} {
+		if s, ok := data.Summary.Ops[opName(op)]; ok {
+			data.Ops = append(data.Ops, reportOp{opName(op), s})
+		}
+	}
+
+	interval := time.Second
+	if s, ok := lookupKey(config, "reporter.interval").(string); ok {
+		if d, e := time.ParseDuration(s); e == nil && d > 0 {
+			interval = d
+		}
+	}
+
+	bandwidth, markers, err := readBandwidthLog(filepath.Join(dir, "bandwidth.csv"))
+	if err != nil {
+		// Every interval is in the summary too, just without exact times
+		bandwidth = nil
+		for _, op := range data.Ops {
+			if len(op.Summary.BandwidthIntervals) > 0 {
+				bandwidth = append(bandwidth, intervalSeries(op.Name, interval, int64sToFloats(op.Summary.BandwidthIntervals)))
+			}
+		}
+	}
+
+	for i := range bandwidth {
+		for j := range bandwidth[i].Y {
+			bandwidth[i].Y[j] /= 1 << 20
+		}
+	}
+
+	data.addChart(&lineChart{Title: "Bandwidth (MiB/sec)", XLabel: "seconds", Series: bandwidth, Markers: markers, YZero: true},
+		"No bandwidth data.")
+
+	var iops []chartSeries
+	for _, op := range data.Ops {
+		if len(op.Summary.IOPSIntervals) > 0 {
+			iops = append(iops, intervalSeries(op.Name, interval, op.Summary.IOPSIntervals))
+		}
+	}
+
+	data.addChart(&lineChart{Title: "IOPS", XLabel: "seconds", Series: iops, Markers: markers, YZero: true},
+		"No IOPS data.")
+
+	data.addChart(latencyCurveChart(data.Ops), "No latency data.")
+
+	if log, err := os.Open(filepath.Join(dir, "log.txt")); err == nil {
+		for _, h := range readSyncHistograms(log) {
+			data.Charts = append(data.Charts, template.HTML(h.SVG()))
+		}
+		_ = log.Close()
+	}
+
+	if captures, err := parseCaptureConfig(lookupKey(config, "reporter.capture")); err != nil {
+		data.Notes = append(data.Notes, fmt.Sprintf("Cannot show captured output: %s.", err))
+	} else {
+		for _, sets := range [][]CaptureCommand{captures.Before, captures.Periodic, captures.After} {
+			for _, c := range sets {
+				data.Captures = append(data.Captures, readCaptures(dir, c)...)
+			}
+		}
+
+		sort.Slice(data.Captures, func(i, j int) bool { return data.Captures[i].Name < data.Captures[j].Name })
+	}
+
+	return data, nil
+}
+
+// readCaptures reads the output a capture command saved: one file for a
+// top-level entry, or each timestamped one for the rest.
+func readCaptures(dir string, c CaptureCommand) []reportFile {
+	paths := []string{c.path(dir, time.Time{})}
+
+	if len(c.Set) > 0 {
+		paths, _ = filepath.Glob(filepath.Join(dir, captureDir, fmt.Sprintf("%s-????-??-??-??-??-??-%s", c.Set, c.File)))
+	}
+
+	if len(paths) == 0 {
+		return []reportFile{{Name: c.File, Command: c.Command.String(), Contents: "(not captured)"}}
+	}
+
+	files := make([]reportFile, len(paths))
+
+	for i, path := range paths {
+		name, _ := filepath.Rel(dir, path)
+		files[i] = reportFile{Name: name, Command: c.Command.String()}
+
+		if contents, err := os.ReadFile(path); err != nil {
+			files[i].Contents = fmt.Sprintf("(not captured: %s)", err)
+		} else {
+			files[i].Contents = string(contents)
+		}
+	}
+
+	return files
+}
+
+// addChart adds a chart, or note if it has nothing to show.
+func (data *reportData) addChart(c *lineChart, note string) {
+	if svg := c.SVG(); len(svg) > 0 {
+		data.Charts = append(data.Charts, template.HTML(svg))
+	} else {
+		data.Notes = append(data.Notes, note)
+	}
+}
+
+// intervalSeries places reporter interval values at the end of each
+// interval.
+func intervalSeries(name string, interval time.Duration, values []float64) chartSeries {
+	s := chartSeries{Name: name, Y: values}
+
+	for i := range values {
+		s.X = append(s.X, float64(i+1)*interval.Seconds())
+	}
+
+	return s
+}
+
+// readBandwidthLog reads bandwidth.csv: a line per op per interval, and a
+// comment marking where each phase started.
+func readBandwidthLog(path string) ([]chartSeries, []chartMarker, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+
+	series := make(map[int]*chartSeries)
+	var markers []chartMarker
+
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, nil, fmt.Errorf("cannot parse %s: %s", path, err)
+		}
+
+		if strings.HasPrefix(record[0], "#") {
+			if strings.TrimSpace(strings.TrimPrefix(record[0], "#")) == "phase" && len(record) >= 3 {
+				if t, e := strconv.ParseFloat(record[1], 64); e == nil {
+					markers = append(markers, chartMarker{t, record[2]})
+				}
+			}
+			continue
+		}
+
+		if len(record) < 3 {
+			continue
+		}
+
+		t, e1 := strconv.ParseFloat(record[0], 64)
+		op, e2 := strconv.Atoi(record[1])
+		bw, e3 := strconv.ParseFloat(record[2], 64)
+
+		if e1 != nil || e2 != nil || e3 != nil {
+			return nil, nil, fmt.Errorf("cannot parse %s: bad line '%s'", path, strings.Join(record, ", "))
+		}
+
+		s, ok := series[op]
+		if !ok {
+			s = &chartSeries{Name: opName(op)}
+			series[op] = s
+		}
+
+		s.X = append(s.X, t)
+		s.Y = append(s.Y, bw)
+	}
+
+	var result []chartSeries
+
+	for _, op := range []int{Read, Write} {
+		// An op that was never done is all zeros
+		if s, ok := series[op]; ok && maxOf(s.Y) > 0 {
+			result = append(result, *s)
+		}
+	}
+
+	return result, markers, nil
+}
+
+func maxOf(data []float64) float64 {
+	m := math.Inf(-1)
+	for _, d := range data {
+		m = math.Max(m, d)
+	}
+	return m
+}
+
+// latencyCurveChart plots each op's latency against percentile, on log
+// scales so the tail is visible: each x tick is another nine.
+func latencyCurveChart(ops []reportOp) *lineChart {
+	c := &lineChart{
+		Title:  "Latency by percentile",
+		XLabel: "percentile",
+		XTicks: []float64{0, 1, 2, 3, 4, 5},
+		XFormat: func(x float64) string {
+			return percentileName(100 - 100*math.Pow(10, -x))
+		},
+		YFormat: func(y float64) string {
+			return SprintDuration(time.Duration(math.Pow(10, y) * float64(time.Second)))
+		},
+	}
+
+	minY, maxY := math.Inf(1), math.Inf(-1)
+
+	for _, op := range ops {
+		s := chartSeries{Name: op.Name}
+
+		for _, p := range op.Summary.LatencyCurve {
+			if p.Latency <= 0 {
+				continue
+			}
+			s.X = append(s.X, -math.Log10(1-p.Percentile/100))
+			s.Y = append(s.Y, math.Log10(p.Latency))
+			minY, maxY = math.Min(minY, s.Y[len(s.Y)-1]), math.Max(maxY, s.Y[len(s.Y)-1])
+		}
+
+		if len(s.X) > 0 {
+			c.Series = append(c.Series, s)
+		}
+	}
+
+	for y := math.Floor(minY); y <= math.Ceil(maxY); y++ {
+		c.YTicks = append(c.YTicks, y)
+	}
+
+	return c
+}
+
+// readSyncHistograms totals the sync time histograms the syncers log
+// (see Histogram), one chart for each kind of syncer.
+func readSyncHistograms(log io.Reader) []*barChart {
+	titles := map[string]string{
+		"inline sync times":                            "Inline sync times",
+		"batch sync times (sync only, then wait+sync)": "Batch sync times",
+	}
+	names := map[string][]string{
+		"inline sync times":                            {"sync"},
+		"batch sync times (sync only, then wait+sync)": {"sync", "wait+sync"},
+	}
+
+	charts := make(map[string]*barChart)
+	var order []string
+	var current string
+	row := 0
+
+	scanner := bufio.NewScanner(log)
+
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), "\t", 3)
+		if len(fields) < 3 {
+			current = ""
+			continue
+		}
+		message := fields[2]
+
+		if _, ok := titles[message]; ok {
+			current, row = message, -1
+			continue
+		}
+
+		if len(current) == 0 {
+			continue
+		}
+
+		if row == -1 {
+			// The bucket headers
+			c, ok := charts[current]
+			if !ok {
+				c = &barChart{Title: titles[current]}
+				for _, b := range strings.Split(message, ",") {
+					c.Buckets = append(c.Buckets, strings.TrimSpace(b))
+				}
+				for _, name := range names[current] {
+					c.Series = append(c.Series, chartSeries{Name: name, Y: make([]float64, len(c.Buckets))})
+				}
+				charts[current] = c
+				order = append(order, current)
+			}
+			row = 0
+			continue
+		}
+
+		c := charts[current]
+		counts := strings.Split(message, ",")
+
+		if row >= len(c.Series) || len(counts) != len(c.Buckets) {
+			current = ""
+			continue
+		}
+
+		for i, count := range counts {
+			n, err := strconv.ParseFloat(strings.TrimSpace(count), 64)
+			if err != nil {
+				break
+			}
+			c.Series[row].Y[i] += n
+		}
+
+		if row++; row == len(c.Series) {
+			current = ""
+		}
+	}
+
+	result := make([]*barChart, len(order))
+	for i, key := range order {
+		result[i] = charts[key]
+	}
+
+	return result
+}
+
+func reportPercentiles() []string {
+	names := make([]string, len(Percentiles))
+	for i, p := range Percentiles {
+		names[i] = percentileName(p)
+	}
+	return names
+}
+
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"size":        SprintSize,
+	"latency":     func(s *OpSummary, name string) string { return formatLatency(s.Latency[name]) },
+	"seconds":     formatLatency,
+	"percentiles": reportPercentiles,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>perftest run {{.RunId}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: 4px 10px; text-align: right; }
+th:first-child, td:first-child { text-align: left; }
+pre { background: #f6f6f6; padding: 1em; overflow-x: auto; font-size: 12px; }
+svg { display: block; margin: 1em 0; }
+.note { color: #a60; }
+</style>
+</head>
+<body>
+<h1>Run {{.RunId}}</h1>
+<p>Report generated {{.Generated}}.{{with .Summary}}{{if .End}} Ran {{printf "%.1f" .Duration}} seconds; ended: {{.End}}.{{end}}{{if .Seed}} Seed {{.Seed}}.{{end}}{{end}}</p>
+{{with .Summary.Error}}<p class="note">Error: {{.}}</p>{{end}}
+{{range .Notes}}<p class="note">{{.}}</p>
+{{end}}
+{{if .Ops}}<h2>Results</h2>
+<table>
+<tr><th>op</th><th>ops</th><th>IOPS</th><th>total</th><th>bandwidth (mean)</th><th>bandwidth (median)</th><th>latency (mean)</th>{{range percentiles}}<th>{{.}}</th>{{end}}<th>max</th></tr>
+{{range .Ops}}<tr><td>{{.Name}}</td><td>{{.Summary.Ops}}</td><td>{{printf "%.0f" .Summary.IOPS}}</td><td>{{size .Summary.Bytes}}</td><td>{{size .Summary.BandwidthMean}}/sec</td><td>{{size .Summary.BandwidthMedian}}/sec</td><td>{{seconds .Summary.LatencyMean}}</td>{{$s := .Summary}}{{range percentiles}}<td>{{latency $s .}}</td>{{end}}<td>{{seconds .Summary.LatencyMax}}</td></tr>
+{{end}}</table>
+{{end}}
+<h2>Charts</h2>
+{{range .Charts}}{{.}}
+{{end}}
+{{if .Captures}}<h2>Captured output</h2>
+{{range .Captures}}<h3>{{.Name}}</h3>
+<p><code>{{.Command}}</code></p>
+<pre>{{.Contents}}</pre>
+{{end}}{{end}}
+<h2>Config</h2>
+<pre>{{.Config}}</pre>
+</body>
+</html>
+`))
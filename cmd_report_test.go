@@ -0,0 +1,171 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadBandwidthLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bandwidth.csv")
+	AbortOnError(t, os.WriteFile(path, []byte(`# Time(sec), Rate(bytes/sec)
+# phase, 0.000, prefill
+1.000, 0, 0
+1.000, 1, 1048576
+# phase, 1.500, mixed
+2.000, 0, 524288
+2.000, 1, 2097152
+`), 0644))
+
+	series, markers, err := readBandwidthLog(path)
+	AbortOnError(t, err)
+
+	ExpectEqual(t, 2, len(series))
+	ExpectEqual(t, "read", series[0].Name)
+	ExpectEqual(t, 524288.0, series[0].Y[1])
+	ExpectEqual(t, "write", series[1].Name)
+	ExpectEqual(t, 2.0, series[1].X[1])
+
+	ExpectEqual(t, 2, len(markers))
+	ExpectEqual(t, chartMarker{1.5, "mixed"}, markers[1])
+
+	// Reads that never happened aren't charted
+	AbortOnError(t, os.WriteFile(path, []byte("1.000, 0, 0\n1.000, 1, 10\n"), 0644))
+	series, _, err = readBandwidthLog(path)
+	AbortOnError(t, err)
+	ExpectEqual(t, 1, len(series))
+
+	AbortOnError(t, os.WriteFile(path, []byte("1.000, read, 0\n"), 0644))
+	_, _, err = readBandwidthLog(path)
+	ExpectError(t, err)
+}
+
+func TestReadBandwidthLog_PhaseNames(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bandwidth.csv")
+	f, err := os.Create(path)
+	AbortOnError(t, err)
+
+	// Written as the reporter writes them, phase names come back intact
+	names := []string{"prefill", `say "hi", twice`, " padded", "a,b,c", ""}
+	r := &Reporter{SugaredLogger: Logger(), bwlog: f}
+	for _, name := range names {
+		r.BeginPhase(name, 0, 0)
+	}
+	_, err = f.WriteString("1.000, 1, 1048576\n")
+	AbortOnError(t, err)
+	AbortOnError(t, f.Close())
+
+	series, markers, err := readBandwidthLog(path)
+	AbortOnError(t, err)
+	ExpectEqual(t, 1, len(series))
+	ExpectEqual(t, len(names), len(markers))
+
+	for i, name := range names {
+		ExpectEqual(t, chartMarker{0, name}, markers[i])
+	}
+
+	ExpectEqual(t, "prefill", csvField("prefill"))
+	ExpectEqual(t, `"say ""hi"", twice"`, csvField(`say "hi", twice`))
+}
+
+func TestReadSyncHistograms(t *testing.T) {
+	log := `12:00:00	INFO	running
+12:00:10	INFO	batch sync times (sync only, then wait+sync)
+12:00:10	INFO	< 1ms,  5ms,  10ms,  20ms,  50ms, 100ms, 250ms, 1sec, 2sec, >2sec
+12:00:10	INFO	    1,    2,     0,     0,     0,     0,     0,    0,    0,     0
+12:00:10	INFO	    0,    1,     2,     0,     0,     0,     0,    0,    0,     0
+12:00:10	INFO	read bandwidth:  3.0 MiB/sec
+12:00:20	INFO	batch sync times (sync only, then wait+sync)
+12:00:20	INFO	< 1ms,  5ms,  10ms,  20ms,  50ms, 100ms, 250ms, 1sec, 2sec, >2sec
+12:00:20	INFO	    4,    0,     0,     0,     0,     0,     0,    0,    0,     1
+12:00:20	INFO	    0,    0,     4,     0,     0,     0,     0,    0,    0,     1
+12:00:20	INFO	inline sync times
+12:00:20	INFO	< 1ms,  5ms,  10ms,  20ms,  50ms, 100ms, 250ms, 1sec, 2sec, >2sec
+12:00:20	INFO	    7,    0,     0,     0,     0,     0,     0,    0,    0,     0
+`
+
+	charts := readSyncHistograms(strings.NewReader(log))
+	ExpectEqual(t, 2, len(charts))
+
+	batch := charts[0]
+	ExpectEqual(t, "Batch sync times", batch.Title)
+	ExpectEqual(t, 10, len(batch.Buckets))
+	ExpectEqual(t, "< 1ms", batch.Buckets[0])
+	ExpectEqual(t, 5.0, batch.Series[0].Y[0])
+	ExpectEqual(t, 1.0, batch.Series[0].Y[9])
+	ExpectEqual(t, "wait+sync", batch.Series[1].Name)
+	ExpectEqual(t, 6.0, batch.Series[1].Y[2])
+
+	ExpectEqual(t, "Inline sync times", charts[1].Title)
+	ExpectEqual(t, 7.0, charts[1].Series[0].Y[0])
+}
+
+func TestLoadReport(t *testing.T) {
+	dir := t.TempDir()
+
+	write := func(name, contents string) {
+		AbortOnError(t, os.WriteFile(filepath.Join(dir, name), []byte(contents), 0644))
+	}
+
+	write("config.json", `{"reporter": {"interval": "2s", "capture": {"df.txt": "df -h", "missing.txt": "true",
+		"periodic": {"interval": "1s", "commands": {"load.txt": "cat /proc/loadavg"}}}}}`)
+	write("df.txt", "Filesystem <and> such\n")
+	AbortOnError(t, os.Mkdir(filepath.Join(dir, captureDir), 0755))
+	write("capture/periodic-2026-10-18-10-00-01-load.txt", "0.50\n")
+	write("capture/periodic-2026-10-18-10-00-02-load.txt", "0.75\n")
+
+	summary := &RunSummary{RunId: "run1", Duration: 4, End: "ran for 4s", Ops: map[string]*OpSummary{
+		"write": {
+			Ops: 10, Bytes: 1 << 20, Latency: map[string]float64{"p99": 0.002},
+			LatencyCurve:       []LatencyPoint{{50, 0.001}, {99, 0.002}},
+			BandwidthIntervals: []int64{1 << 19, 1 << 19},
+			IOPSIntervals:      []float64{5, 5},
+		},
+	}}
+	AbortOnError(t, summary.Write(filepath.Join(dir, "summary.json")))
+
+	data, err := loadReport(dir)
+	AbortOnError(t, err)
+
+	ExpectEqual(t, "run1", data.RunId)
+	ExpectEqual(t, 1, len(data.Ops))
+	ExpectEqual(t, 0, len(data.Notes))
+	ExpectEqual(t, 3, len(data.Charts)) // bandwidth, IOPS and latency
+
+	ExpectEqual(t, 4, len(data.Captures))
+	ExpectEqual(t, "capture/periodic-2026-10-18-10-00-01-load.txt", data.Captures[0].Name)
+	ExpectEqual(t, "cat /proc/loadavg", data.Captures[0].Command)
+	ExpectEqual(t, "0.75\n", data.Captures[1].Contents)
+	ExpectEqual(t, "df.txt", data.Captures[2].Name)
+	ExpectEqual(t, "df -h", data.Captures[2].Command)
+	ExpectEqual(t, true, strings.HasPrefix(data.Captures[3].Contents, "(not captured"))
+
+	var html strings.Builder
+	AbortOnError(t, reportTemplate.Execute(&html, data))
+
+	// Captured output is escaped, and nothing is loaded from elsewhere
+	ExpectEqual(t, true, strings.Contains(html.String(), "Filesystem &lt;and&gt; such"))
+	ExpectEqual(t, false, strings.Contains(html.String(), "src="))
+	ExpectEqual(t, false, strings.Contains(html.String(), "href="))
+
+	// Without a summary there's still a report, saying what's missing
+	AbortOnError(t, os.Remove(filepath.Join(dir, "summary.json")))
+	data, err = loadReport(dir)
+	AbortOnError(t, err)
+	ExpectEqual(t, 0, len(data.Charts))
+	ExpectEqual(t, true, len(data.Notes) > 0)
+
+	_, err = loadReport(t.TempDir())
+	ExpectError(t, err)
+}
+
+func TestNiceTicks(t *testing.T) {
+	ticks := niceTicks(0, 97)
+	ExpectEqual(t, 0.0, ticks[0])
+	ExpectEqual(t, 100.0, ticks[len(ticks)-1])
+	ExpectEqual(t, 6, len(ticks))
+
+	ticks = niceTicks(3, 3)
+	ExpectEqual(t, true, ticks[len(ticks)-1] >= 4)
+}
@@ -0,0 +1,482 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// sweepParam is one setting swept over, e.g. "file.runners_per_path".
+type sweepParam struct {
+	Key    string
+	Values []interface{}
+}
+
+// sweepPoint is the result of running one combination of values.
+type sweepPoint struct {
+	Dir     string                 `json:"dir"`
+	Params  map[string]interface{} `json:"params"`
+	Error   string                 `json:"error,omitempty"`
+	Summary *RunSummary            `json:"summary,omitempty"`
+}
+
+// sweepCommand implements "perftest sweep": run the config once for every
+// combination of the values in its "sweep.matrix" section, each as a
+// separate run in a directory of its own, and collect the results of all
+// of them in sweep.csv and sweep.json.
+func sweepCommand(args []string) int {
+	flags := pflag.NewFlagSet("sweep", pflag.ContinueOnError)
+	configPath := flags.String("config", "config.json", "base config, with a 'sweep' section")
+	output := flags.String("output", "", "directory for the runs and results (default sweep-<time>)")
+	dryRun := flags.Bool("dry-run", false, "list the points without running them")
+	flags.Usage = func() {
+		fmt.Printf("usage: perftest sweep [flags]\n")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return 2
+	}
+
+	base, params, err := readSweepConfig(*configPath)
+	if err != nil {
+		fmt.Printf("%s\n", err)
+		return 2
+	}
+
+	if len(*output) == 0 {
+		*output = "sweep-" + time.Now().Format("2006-01-02-15-04-05")
+	}
+
+	points := sweepCombinations(params)
+	fmt.Printf("%d points\n", len(points))
+
+	if *dryRun {
+		for i, values := range points {
+			fmt.Printf("%s\n", sweepPointDir(i, params, values))
+		}
+		return 0
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		fmt.Printf("cannot find perftest executable: %s\n", err)
+		return 2
+	}
+
+	if err = os.MkdirAll(*output, 0750); err != nil {
+		fmt.Printf("cannot make output directory: %s\n", err)
+		return 2
+	}
+
+	// Control-C is passed on to the current point, which finishes as
+	// usual, and the sweep stops after it.
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	defer signal.Stop(sig)
+
+	results := make([]*sweepPoint, 0, len(points))
+	failed := 0
+
+	for i, values := range points {
+		point := &sweepPoint{
+			Dir:    filepath.Join(*output, sweepPointDir(i, params, values)),
+			Params: make(map[string]interface{}),
+		}
+
+		for j, p := range params {
+			point.Params[p.Key] = values[j]
+		}
+
+		fmt.Printf("point %d of %d: %s\n", i+1, len(points), point.Dir)
+		interrupted := false
+
+		if err = runSweepPoint(exe, base, params, values, point.Dir, sig, &interrupted); err == nil {
+			point.Summary, err = ReadRunSummary(filepath.Join(point.Dir, "summary.json"))
+		} else if s, e := ReadRunSummary(filepath.Join(point.Dir, "summary.json")); e == nil && len(s.Error) > 0 {
+			// A run that stopped on an error exits 1; its summary says why
+			point.Summary, err = s, nil
+		}
+
+		if err == nil && len(point.Summary.Error) > 0 {
+			err = fmt.Errorf("%s", point.Summary.Error)
+		}
+
+		if err != nil {
+			point.Error = err.Error()
+			failed++
+			fmt.Printf("  failed: %s\n", err)
+		} else {
+			fmt.Printf("  %s\n", sweepPointResult(point.Summary))
+		}
+
+		results = append(results, point)
+
+		// Write as we go, so stopping early still leaves the results so far
+		if err = writeSweepResults(*output, params, results); err != nil {
+			fmt.Printf("%s\n", err)
+			return 1
+		}
+
+		if interrupted {
+			fmt.Printf("interrupted, stopping sweep\n")
+			return 1
+		}
+	}
+
+	fmt.Printf("results in %s\n", filepath.Join(*output, "sweep.csv"))
+
+	if failed > 0 {
+		fmt.Printf("%d of %d points failed\n", failed, len(points))
+		return 1
+	}
+
+	return 0
+}
+
+// readSweepConfig reads the base config, returning it without its sweep
+// section, and the settings to sweep over in order of key.
+func readSweepConfig(path string) (map[string]interface{}, []sweepParam, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot read config: %s", err)
+	}
+
+	base := make(map[string]interface{})
+	if err = json.Unmarshal(data, &base); err != nil {
+		return nil, nil, fmt.Errorf("cannot parse %s: %s", path, err)
+	}
+
+	var sweep map[string]interface{}
+
+	for key, value := range base {
+		if strings.EqualFold(key, "sweep") {
+			sweep, _ = value.(map[string]interface{})
+			delete(base, key)
+		}
+	}
+
+	matrix, _ := lookupKey(sweep, "matrix").(map[string]interface{})
+	if len(matrix) == 0 {
+		return nil, nil, fmt.Errorf("no settings to sweep; create 'sweep.matrix' in %s", path)
+	}
+
+	params := make([]sweepParam, 0, len(matrix))
+
+	for key, value := range matrix {
+		values, ok := value.([]interface{})
+		if !ok || len(values) == 0 {
+			return nil, nil, fmt.Errorf("sweep.matrix '%s' must be a list of values", key)
+		}
+		params = append(params, sweepParam{Key: key, Values: values})
+	}
+
+	sort.Slice(params, func(i, j int) bool { return params[i].Key < params[j].Key })
+
+	// Each point must end by itself for the next to start
+	if d, ok := lookupKey(sweep, "duration").(string); ok {
+		if _, err = time.ParseDuration(d); err != nil {
+			return nil, nil, fmt.Errorf("bad sweep.duration '%s'", d)
+		}
+		if err = setKey(base, "duration", d); err != nil {
+			return nil, nil, err
+		}
+	} else if lookupKey(base, "duration") == nil && lookupKey(base, "phases") == nil &&
+		lookupKey(base, "replay.trace") == nil && lookupKey(base, "fill.enabled") != true {
+		return nil, nil, fmt.Errorf("sweep points would run until stopped; set 'sweep.duration' in %s", path)
+	}
+
+	return base, params, nil
+}
+
+// sweepCombinations returns every combination of the params' values, in
+// the params' order, with the last param changing fastest.
+func sweepCombinations(params []sweepParam) [][]interface{} {
+	points := [][]interface{}{{}}
+
+	for _, p := range params {
+		next := make([][]interface{}, 0, len(points)*len(p.Values))
+
+		for _, point := range points {
+			for _, value := range p.Values {
+				combined := append(append([]interface{}{}, point...), value)
+				next = append(next, combined)
+			}
+		}
+
+		points = next
+	}
+
+	return points
+}
+
+// sweepPointDir names point i's run directory after its values, e.g.
+// "003-runners_per_path=4-iosize=64KB".
+func sweepPointDir(i int, params []sweepParam, values []interface{}) string {
+	parts := []string{fmt.Sprintf("%03d", i+1)}
+
+	for j, p := range params {
+		name := p.Key[strings.LastIndex(p.Key, ".")+1:]
+		parts = append(parts, fmt.Sprintf("%s=%v", name, values[j]))
+	}
+
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == os.PathSeparator || r == ' ' {
+			return '_'
+		}
+		return r
+	}, strings.Join(parts, "-"))
+}
+
+// runSweepPoint runs perftest for one point in dir, with the config for
+// the point written there. It returns an error only if the run couldn't
+// be done; the run's own result is in its summary.
+func runSweepPoint(exe string, base map[string]interface{}, params []sweepParam, values []interface{},
+	dir string, sig chan os.Signal, interrupted *bool) error {
+
+	config, err := copyConfig(base)
+	if err != nil {
+		return err
+	}
+
+	for j, p := range params {
+		if err = setKey(config, p.Key, values[j]); err != nil {
+			return err
+		}
+	}
+
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(dir, 0750); err != nil {
+		return fmt.Errorf("cannot make run directory: %s", err)
+	}
+
+	configPath := filepath.Join(dir, "config.json")
+	if err = os.WriteFile(configPath, data, 0664); err != nil {
+		return fmt.Errorf("cannot write config: %s", err)
+	}
+
+	// The run logs to its own directory, so its output isn't needed here
+	cmd := exec.Command(exe, "run", "--config", configPath, "--runid", dir)
+	cmd.Stderr = os.Stderr
+
+	if err = cmd.Start(); err != nil {
+		return fmt.Errorf("cannot start run: %s", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	for {
+		select {
+		case err = <-done:
+			if err != nil {
+				return fmt.Errorf("run failed: %s", err)
+			}
+			return nil
+
+		case <-sig:
+			*interrupted = true
+			_ = cmd.Process.Signal(os.Interrupt)
+		}
+	}
+}
+
+func sweepPointResult(s *RunSummary) string {
+	var parts []string
+
+	for _, op := range []int{Read, Write, Delete} {
+		if o, ok := s.Ops[opName(op)]; ok {
+			parts = append(parts, fmt.Sprintf("%s %s/sec, %.0f ops/sec, p99 %s", opName(op),
+				SprintSize(o.BandwidthMean), o.IOPS, SprintDuration(time.Duration(o.Latency["p99"]*float64(time.Second)))))
+		}
+	}
+
+	if len(parts) == 0 {
+		return "no ops"
+	}
+
+	return strings.Join(parts, "; ")
+}
+
+// writeSweepResults writes sweep.json, with each point's params and
+// summary, and sweep.csv, with a row for each point.
+func writeSweepResults(dir string, params []sweepParam, results []*sweepPoint) error {
+	data, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err = os.WriteFile(filepath.Join(dir, "sweep.json"), append(data, '\n'), 0664); err != nil {
+		return fmt.Errorf("cannot write sweep results: %s", err)
+	}
+
+	// Only the ops some point did get columns
+	var ops []string
+	for _, op := range []int{Read, Write, Delete} {
+		for _, point := range results {
+			if _, ok := point.opSummary(opName(op)); ok {
+				ops = append(ops, opName(op))
+				break
+			}
+		}
+	}
+
+	header := []string{"point"}
+	for _, p := range params {
+		header = append(header, p.Key)
+	}
+	header = append(header, "error", "duration")
+
+	for _, op := range ops {
+		header = append(header, op+"_ops", op+"_iops", op+"_bw_mean", op+"_bw_median", op+"_lat_mean")
+		for _, p := range Percentiles {
+			header = append(header, op+"_lat_"+percentileName(p))
+		}
+		header = append(header, op+"_lat_max")
+	}
+
+	rows := [][]string{header}
+
+	for _, point := range results {
+		row := []string{filepath.Base(point.Dir)}
+		for _, p := range params {
+			row = append(row, fmt.Sprint(point.Params[p.Key]))
+		}
+
+		duration := ""
+		if point.Summary != nil {
+			duration = formatFloat(point.Summary.Duration)
+		}
+		row = append(row, point.Error, duration)
+
+		for _, op := range ops {
+			o, ok := point.opSummary(op)
+			if !ok {
+				row = append(row, make([]string, 6+len(Percentiles))...)
+				continue
+			}
+
+			row = append(row, strconv.FormatInt(o.Ops, 10), formatFloat(o.IOPS),
+				strconv.FormatInt(o.BandwidthMean, 10), strconv.FormatInt(o.BandwidthMedian, 10), formatFloat(o.LatencyMean))
+			for _, p := range Percentiles {
+				row = append(row, formatFloat(o.Latency[percentileName(p)]))
+			}
+			row = append(row, formatFloat(o.LatencyMax))
+		}
+
+		rows = append(rows, row)
+	}
+
+	f, err := os.Create(filepath.Join(dir, "sweep.csv"))
+	if err != nil {
+		return fmt.Errorf("cannot write sweep results: %s", err)
+	}
+
+	w := csv.NewWriter(f)
+	_ = w.WriteAll(rows)
+
+	if err = w.Error(); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("cannot write sweep results: %s", err)
+	}
+
+	return f.Close()
+}
+
+func (p *sweepPoint) opSummary(op string) (*OpSummary, bool) {
+	if p.Summary == nil {
+		return nil, false
+	}
+	o, ok := p.Summary.Ops[op]
+	return o, ok
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', 6, 64)
+}
+
+// lookupKey finds a dotted key (e.g. "file.paths") in a config read from
+// JSON, ignoring case as viper does, returning nil if it isn't there.
+func lookupKey(config map[string]interface{}, key string) interface{} {
+	var value interface{} = config
+
+	for _, part := range strings.Split(key, ".") {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+
+		value = nil
+		for k, v := range m {
+			if strings.EqualFold(k, part) {
+				value = v
+			}
+		}
+	}
+
+	return value
+}
+
+// setKey sets a dotted key in a config read from JSON, adding sections
+// as needed.
+func setKey(config map[string]interface{}, key string, value interface{}) error {
+	parts := strings.Split(key, ".")
+	m := config
+
+	for i, part := range parts {
+		name := part
+		for k := range m {
+			if strings.EqualFold(k, part) {
+				name = k
+			}
+		}
+
+		if i == len(parts)-1 {
+			m[name] = value
+			break
+		}
+
+		next, ok := m[name].(map[string]interface{})
+		if !ok {
+			if m[name] != nil {
+				return fmt.Errorf("cannot set '%s': '%s' isn't a section", key, name)
+			}
+			next = make(map[string]interface{})
+			m[name] = next
+		}
+
+		m = next
+	}
+
+	return nil
+}
+
+// copyConfig deep-copies a config read from JSON.
+func copyConfig(config map[string]interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+
+	c := make(map[string]interface{})
+	return c, json.Unmarshal(data, &c)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeSweepConfig(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	AbortOnError(t, os.WriteFile(path, []byte(contents), 0644))
+	return path
+}
+
+func TestReadSweepConfig(t *testing.T) {
+	path := writeSweepConfig(t, `{
+		"iosize": "1MB",
+		"File": {"paths": ["/tmp/a"], "Runners_Per_Path": 2},
+		"sweep": {
+			"duration": "30s",
+			"matrix": {"iosize": ["64KB", "1MB"], "file.runners_per_path": [1, 2, 4]}
+		}
+	}`)
+
+	base, params, err := readSweepConfig(path)
+	AbortOnError(t, err)
+
+	ExpectEqual(t, nil, base["sweep"])
+	ExpectEqual(t, "30s", base["duration"])
+	ExpectEqual(t, 2, len(params))
+	ExpectEqual(t, "file.runners_per_path", params[0].Key)
+	ExpectEqual(t, "iosize", params[1].Key)
+
+	points := sweepCombinations(params)
+	ExpectEqual(t, 6, len(points))
+	ExpectEqual(t, "001-runners_per_path=1-iosize=64KB", sweepPointDir(0, params, points[0]))
+	ExpectEqual(t, "006-runners_per_path=4-iosize=1MB", sweepPointDir(5, params, points[5]))
+
+	// Points are set the same way viper reads them, ignoring case
+	config, err := copyConfig(base)
+	AbortOnError(t, err)
+	AbortOnError(t, setKey(config, "file.runners_per_path", 8.0))
+	AbortOnError(t, setKey(config, "sync_batcher.max_pending", 16.0))
+
+	ExpectEqual(t, 8.0, lookupKey(config, "file.runners_per_path"))
+	ExpectEqual(t, 16.0, lookupKey(config, "sync_batcher.max_pending"))
+	ExpectEqual(t, 2.0, lookupKey(base, "FILE.runners_per_path"))
+	ExpectEqual(t, nil, lookupKey(config, "file.runners_per_path.more"))
+	ExpectError(t, setKey(config, "iosize.more", 1))
+}
+
+func TestReadSweepConfig_Invalid(t *testing.T) {
+	for _, contents := range []string{
+		`{"sweep": {"duration": "10s"}}`,
+		`{"sweep": {"duration": "10s", "matrix": {}}}`,
+		`{"sweep": {"duration": "10s", "matrix": {"iosize": "1MB"}}}`,
+		`{"sweep": {"duration": "10s", "matrix": {"iosize": []}}}`,
+		`{"sweep": {"duration": "soon", "matrix": {"iosize": ["1MB"]}}}`,
+		`{"sweep": {"matrix": {"iosize": ["1MB"]}}}`,
+		`{"sweep": {"matrix": {"iosize": ["1MB"]}}`,
+	} {
+		_, _, err := readSweepConfig(writeSweepConfig(t, contents))
+		ExpectErrorf(t, err, "expected error for config: %s", contents)
+	}
+
+	// Without sweep.duration, the points must end some other way
+	_, _, err := readSweepConfig(writeSweepConfig(t, `{"duration": "1m", "sweep": {"matrix": {"iosize": ["1MB"]}}}`))
+	AbortOnError(t, err)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// validateCommand implements "perftest validate": check a config the way
+// run would, without creating a run directory or touching any disks.
+func validateCommand(args []string) int {
+	flags := pflag.NewFlagSet("validate", pflag.ContinueOnError)
+	config := addConfigFlags(flags)
+	flags.Usage = func() {
+		fmt.Printf("usage: perftest validate [flags]\n")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return 2
+	}
+
+	if err := config.load(nil); err != nil {
+		fmt.Printf("%s\n", err)
+		return 1
+	}
+
+	// Only warnings, not what each setting was parsed as
+	Logger()
+	__logLevel.SetLevel(zap.WarnLevel)
+
+	if _, err := validateConfig(); err != nil {
+		fmt.Printf("%s: %s\n", viper.ConfigFileUsed(), err)
+		return 1
+	}
+
+	fmt.Printf("%s: ok\n", viper.ConfigFileUsed())
+	return 0
+}
+
+// dryRunCommand implements "perftest run --dry-run": check the config as
+// validate does, then show what the run would do, without creating runDir.
+func dryRunCommand(runDir string) int {
+	Logger()
+	__logLevel.SetLevel(zap.WarnLevel)
+
+	plan, err := validateConfig()
+	if err != nil {
+		fmt.Printf("%s: %s\n", viper.ConfigFileUsed(), err)
+		return 1
+	}
+
+	fmt.Printf("config: %s\n", viper.ConfigFileUsed())
+	fmt.Printf("run directory: %s (not created)\n", runDir)
+	plan.Print(os.Stdout)
+	return 0
+}
+
+// validateConfig checks the settings run checks before it starts, as far
+// as it can without creating anything on disk, and returns what the run
+// would do.
+func validateConfig() (plan *runPlan, err error) {
+	if err = checkSettings(); err != nil {
+		return nil, err
+	}
+
+	plan = &runPlan{Duration: viper.GetDuration("duration")}
+
+	if plan.Fill, err = parseFillConfig(); err != nil {
+		return nil, err
+	}
+
+	if _, err = parseVerifyMode(viper.GetString("verify")); err != nil {
+		return nil, err
+	}
+
+	if plan.ErrorPolicy, err = parseErrorPolicy(); err != nil {
+		return nil, err
+	}
+
+	if plan.Reporter, err = parseReporterConfig(); err != nil {
+		return nil, err
+	}
+
+	if _, err = parseOpenFlags(viper.GetStringSlice("file.open_flags")); err != nil {
+		return nil, err
+	}
+
+	if _, _, err = parseSetupCommands(); err != nil {
+		return nil, err
+	}
+
+	if plan.Replay, err = parseReplayConfig(); err != nil {
+		return nil, err
+	}
+
+	if global.ObjectVendor, err = newObjectVendor(viper.GetViper()); err != nil {
+		return nil, fmt.Errorf("cannot create object vendor: %s", err)
+	}
+
+	phases, err := parsePhases()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(phases) == 0 {
+		phases = []*Phase{nil}
+	}
+
+	runners := 0
+
+	for _, phase := range phases {
+		jobs, err := newJobs(phase, nil)
+
+		for _, job := range jobs {
+			runners += job.RunnersPerPath * len(job.Paths)
+			job.Syncer.Stop()
+		}
+
+		if err != nil && phase != nil {
+			return nil, fmt.Errorf("phase %s: %s", phase.Name, err)
+		} else if err != nil {
+			return nil, err
+		}
+
+		plan.Phases = append(plan.Phases, planPhase{Phase: phase, Jobs: jobs})
+	}
+
+	if runners == 0 && plan.Replay == nil {
+		return nil, fmt.Errorf("nothing to run; create 'file.paths' or 'replay.trace' in config.json")
+	}
+
+	return plan, nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestValidateConfig(t *testing.T) {
+	defer func(v *ObjectVendor) { global.ObjectVendor = v }(global.ObjectVendor)
+
+	valid := `{
+		"iosize": "64KB",
+		"size": "1MB",
+		"reporter": {"interval": "1s"},
+		"file": {"paths": ["/mnt/a"], "runners_per_path": 2, "sync": "batch"},
+		"sync_batcher": {"max_wait": "50ms", "max_pending": 8}
+	}`
+
+	for _, c := range []struct {
+		set      []string
+		expected string // start of the error, or empty if valid
+	}{
+		{nil, ""},
+		{[]string{"reporter.interval=0"}, "no reporter interval specified"},
+		{[]string{"file.runners_per_path=0"}, "file store must have more than 1 runner per path"},
+		{[]string{"file.paths=[]"}, "nothing to run"},
+		{[]string{"sync_batcher.max_pending=0"}, "no max_pending specified"},
+		{[]string{"fill.enabled=true", "fill.target=120"}, "fill.target must be between 0 and 100 percent"},
+		{[]string{"verify=sometimes"}, "unknown verify mode 'sometimes'"},
+		{[]string{"size=huge"}, "cannot create object vendor"},
+		{[]string{`phases=[{"name": "reads", "read": 150}]`}, "phase reads: read percent must be between 0 and 100"},
+		{[]string{"replay.trace=trace.csv"}, "no path to replay trace against"},
+		{[]string{"replay.trace=trace.csv", "replay.path=/mnt/b", "replay.timing=slow"}, "unknown replay.timing 'slow'; use fast or timed"},
+		{[]string{"file.sync=sometimes"}, "unknown file.sync 'sometimes'; use none, inline or batch"},
+		{[]string{"file.sync_on=open"}, "unknown file.sync_on 'open'; use close or write"},
+		{[]string{"file.open_flags=sync", "file.open_flags=direct"}, ""},
+		{[]string{"file.open_flags=nocache"}, "unknown file.open_flags 'nocache'"},
+		{[]string{"file.setup=mount /dev/sdb /mnt && mkdir -p /mnt/a"}, ""},
+		{[]string{"file.setup.command=mount /mnt", "file.setup.timeout=soon"}, "invalid file.setup.timeout 'soon'"},
+		{[]string{"file.teardown.timeout=1m"}, "file.teardown has no command"},
+		{[]string{"sync_batcher.max_wait=0"}, "no max_wait specified"},
+		{[]string{"iosize=0"}, "no io size specified"},
+		{[]string{"read=101"}, "read percent must be between 0 and 100"},
+		{[]string{"compressibility=101"}, "cannot create object vendor: compressibility must be between 0 and 100"},
+		{[]string{"fill.enabled=true", "fill.churn_at=-1"}, "fill.churn_at must be between 0 and 100 percent"},
+		{[]string{"fill.enabled=true", "fill.target=90", "fill.churn_at=95"}, "fill.churn_at (95%) must be below fill.target (90%)"},
+		{[]string{"fill.enabled=true", "fill.churn_at=100"}, "fill.churn_at (100%) must be below fill.target (100%)"},
+		{[]string{"fill.enabled=true", "fill.target=95", "fill.churn_at=90"}, ""},
+		{[]string{"errors.policy=threshold"}, "threshold error policy needs 'errors.max_errors' and/or 'errors.max_rate'"},
+		{[]string{"errors.backoff=2s", "errors.max_backoff=1s"}, "errors.backoff must be above 0 and no more than errors.max_backoff"},
+		{[]string{`phases=[{"name": "a"}, {"name": "b"}]`}, "phase 1 (a) needs a duration, bytes or ops limit"},
+		{[]string{"file.snyc=inline"}, "unknown setting 'file.snyc' (did you mean 'file.sync'?)"},
+		{[]string{"iosize=64KiB"}, "invalid iosize '64KiB': expected a size such as 64KB"},
+	} {
+		viper.Reset()
+		setDefaults()
+		readTestConfig(t, valid)
+
+		for _, setting := range c.set {
+			key, value, err := parseSetting(setting)
+			AbortOnError(t, err)
+			viper.Set(key, value)
+		}
+
+		_, err := validateConfig()
+
+		if len(c.expected) == 0 {
+			AbortOnErrorf(t, err, "%v", c.set)
+		} else if err == nil || !strings.HasPrefix(err.Error(), c.expected) {
+			t.Errorf("%v: expected error starting %q, got %v", c.set, c.expected, err)
+		}
+	}
+
+	viper.Reset()
+}
+
+func TestRunPlan_Print(t *testing.T) {
+	defer func(v *ObjectVendor) { global.ObjectVendor = v }(global.ObjectVendor)
+	defer viper.Reset()
+
+	viper.Reset()
+	setDefaults()
+	readTestConfig(t, `{
+		"iosize": "64KB",
+		"size": "1MB/50/dat:3MB/50/bin/text",
+		"reporter": {"interval": "1s"},
+		"file": {"paths": ["/mnt/a", "/mnt/b"], "runners_per_path": 2},
+		"rate": {"iops": 100},
+		"phases": [
+			{"name": "prefill", "bytes": "10GB"},
+			{"name": "mixed", "duration": "1m", "read": 50, "file": {"runners_per_path": 4, "sync": "batch"},
+				"sync_batcher": {"max_wait": "50ms", "max_pending": 8}}
+		]
+	}`)
+
+	plan, err := validateConfig()
+	AbortOnError(t, err)
+
+	var b strings.Builder
+	plan.Print(&b)
+	text := b.String()
+
+	for _, expected := range []string{
+		"ends: after the last phase",
+		"phase 1: prefill (10.0 GiB)",
+		"job job1: 2 runners per path, iosize 64.0 KiB, read 0%",
+		"paths: /mnt/a, /mnt/b",
+		"sizes: 50% 1.0 MiB .dat random; 50% 3.0 MiB .bin text",
+		"objects: mean about 2.0 MiB, largest 3.0 MiB",
+		"sync: none",
+		"rate: 100 ops/sec",
+		"writes about 10.0 GiB",
+		"phase 2: mixed (1m0s)",
+		"sync: in batches of up to 8, waiting up to 50ms, on close",
+		"/mnt/a: 2 runners in phase 1, 4 runners in phase 2",
+		"memory: up to 24.0 MiB of object buffers",
+		"disk: about 10.0 GiB, plus whatever phase 2 writes in 1m0s",
+	} {
+		if !strings.Contains(text, expected) {
+			t.Errorf("expected %q in plan:\n%s", expected, text)
+		}
+	}
+}
@@ -0,0 +1,386 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// verifiedObject is the outcome of checking one object on disk.
+type verifiedObject struct {
+	Path   string
+	Result VerifyResult
+}
+
+// verifyCommand implements "perftest verify [flags] <paths>": check every
+// object under the given paths against its embedded header. With --expect
+// (typically a run's durability manifest) it also reports every listed
+// object that was lost: missing, corrupted, or shorter than listed.
+func verifyCommand(args []string) int {
+	flags := pflag.NewFlagSet("verify", pflag.ContinueOnError)
+	parallel := flags.Int("parallel", runtime.NumCPU(), "number of objects to verify at once")
+	reportPath := flags.String("report", "verify-report.txt", "file to write the report to")
+	expectPath := flags.String("expect", "", "file listing objects that must exist, one path (and optional size) per line")
+	progress := flags.Duration("progress", time.Second*5, "how often to print progress")
+	repeat := flags.String("repeat", "", "the run's data.repeat pattern, to verify objects using it")
+	corpus := flags.String("corpus", "", "the run's data.corpus file, to verify objects using it")
+	flags.Usage = func() {
+		fmt.Printf("usage: perftest verify [flags] <path> [path...]\n")
+		fmt.Printf("       perftest verify --expect <list> [flags] [path...]\n")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() == 0 && len(*expectPath) == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	if *parallel < 1 {
+		*parallel = 1
+	}
+
+	if len(*repeat) > 0 {
+		registerPatternSource([]byte(*repeat))
+	}
+
+	if len(*corpus) > 0 {
+		if _, err := loadCorpus(*corpus); err != nil {
+			fmt.Printf("%s\n", err)
+			return 2
+		}
+	}
+
+	var expected map[string]int64
+
+	if len(*expectPath) > 0 {
+		var err error
+
+		if expected, err = readObjectList(*expectPath); err != nil {
+			fmt.Printf("%s\n", err)
+			return 2
+		}
+	}
+
+	// Gather everything first so progress can be reported as a fraction.
+	// Paths are made absolute so they can be matched against the expected
+	// list no matter how either was specified.
+	var paths []string
+	var totalBytes int64
+
+	for _, root := range flags.Args() {
+		root, err := filepath.Abs(root)
+		if err != nil {
+			fmt.Printf("bad path %s: %s\n", root, err)
+			return 2
+		}
+
+		err = walkObjects(root, func(path string, info os.FileInfo) {
+			paths = append(paths, path)
+			totalBytes += info.Size()
+		})
+
+		if err != nil {
+			fmt.Printf("error scanning %s: %s\n", root, err)
+			return 2
+		}
+	}
+
+	if flags.NArg() == 0 {
+		// Just the expected objects
+		for path := range expected {
+			paths = append(paths, path)
+			if info, err := os.Stat(path); err == nil {
+				totalBytes += info.Size()
+			}
+		}
+	}
+
+	fmt.Printf("verifying %d objects (%s) with %d workers\n", len(paths), SprintSize(totalBytes), *parallel)
+
+	results := verifyObjects(paths, *parallel, *progress)
+	results = append(results, missingObjects(expected, results)...)
+
+	sort.Slice(results, func(i, j int) bool { return results[i].Path < results[j].Path })
+
+	counts := make([]int, verifyStatusCount)
+	for _, r := range results {
+		counts[r.Result.Status]++
+	}
+
+	lost := lostObjects(expected, results)
+
+	if err := writeVerifyReport(*reportPath, results, counts, expected, lost); err != nil {
+		fmt.Printf("%s\n", err)
+		return 2
+	}
+
+	for status := VerifyIntact; status < verifyStatusCount; status++ {
+		fmt.Printf("%-14s %d\n", status.String()+":", counts[status])
+	}
+
+	if expected != nil {
+		fmt.Printf("%-14s %d of %d\n", "lost:", len(lost), len(expected))
+	}
+
+	fmt.Printf("report written to %s\n", *reportPath)
+
+	if expected != nil {
+		// Objects that weren't expected may legitimately be truncated
+		// (e.g. they were being written at the time of a crash), but
+		// corruption is never expected.
+		if len(lost) > 0 || counts[VerifyCorrupted] > 0 {
+			return 1
+		}
+	} else if counts[VerifyTruncated]+counts[VerifyCorrupted] > 0 {
+		return 1
+	}
+
+	return 0
+}
+
+// lostObjects returns the expected objects that are missing, corrupted,
+// without the header they were written with, or shorter than their
+// expected size, with a description of what's wrong.
+func lostObjects(expected map[string]int64, results []verifiedObject) []verifiedObject {
+	var lost []verifiedObject
+
+	for _, r := range results {
+		size, ok := expected[r.Path]
+		if !ok {
+			continue
+		}
+
+		switch {
+		case r.Result.Status == VerifyMissing:
+			r.Result.Detail = "missing"
+		case r.Result.Status == VerifyCorrupted:
+			r.Result.Detail = r.Result.String()
+		case r.Result.Status == VerifyUnverifiable && size >= ObjectHeaderSize:
+			// It was acknowledged with a header, so losing it (e.g. a
+			// zeroed first block) loses the object; Detail says why
+		case r.Result.Size < size:
+			r.Result.Detail = fmt.Sprintf("only %d of %d acknowledged bytes", r.Result.Size, size)
+		default:
+			continue
+		}
+
+		lost = append(lost, r)
+	}
+
+	return lost
+}
+
+func verifyObjects(paths []string, parallel int, progress time.Duration) []verifiedObject {
+	results := make([]verifiedObject, len(paths))
+
+	if len(paths) == 0 {
+		return results
+	}
+
+	work := make(chan int, parallel)
+	var done, doneBytes int64
+	var wg sync.WaitGroup
+
+	for i := 0; i < parallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v := NewObjectVerifier()
+			buf := make([]byte, 1<<20)
+
+			for i := range work {
+				results[i] = verifyObjectFile(paths[i], v, buf)
+				atomic.AddInt64(&done, 1)
+				atomic.AddInt64(&doneBytes, results[i].Result.Size)
+			}
+		}()
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		start := time.Now()
+		t := time.NewTicker(progress)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-finished:
+				return
+			case <-t.C:
+				n := atomic.LoadInt64(&done)
+				rate := int64(float64(atomic.LoadInt64(&doneBytes)) / time.Since(start).Seconds())
+				fmt.Printf("verified %d of %d objects (%.1f%%), %s/sec\n",
+					n, len(paths), float64(n)*100/float64(len(paths)), SprintSize(rate))
+			}
+		}
+	}()
+
+	for i := range paths {
+		work <- i
+	}
+
+	close(work)
+	wg.Wait()
+	close(finished)
+
+	return results
+}
+
+func verifyObjectFile(path string, v *ObjectVerifier, buf []byte) verifiedObject {
+	v.Reset()
+	f, e := os.Open(path)
+
+	if e != nil {
+		if os.IsNotExist(e) {
+			return verifiedObject{path, VerifyResult{Status: VerifyMissing}}
+		}
+		return verifiedObject{path, VerifyResult{Status: VerifyCorrupted, Detail: e.Error()}}
+	}
+
+	defer f.Close()
+
+	if _, e = io.CopyBuffer(v, f, buf); e != nil {
+		result := v.Finish()
+		result.Status = VerifyCorrupted
+		result.Detail = fmt.Sprintf("read error after %d bytes: %s", result.Size, e)
+		return verifiedObject{path, result}
+	}
+
+	return verifiedObject{path, v.Finish()}
+}
+
+// missingObjects returns a result for each expected object that wasn't
+// found on disk.
+func missingObjects(expected map[string]int64, found []verifiedObject) []verifiedObject {
+	var missing []verifiedObject
+
+	if len(expected) == 0 {
+		return missing
+	}
+
+	seen := make(map[string]bool, len(found))
+	for _, r := range found {
+		seen[r.Path] = true
+	}
+
+	for path, size := range expected {
+		if !seen[path] {
+			missing = append(missing, verifiedObject{path, VerifyResult{Status: VerifyMissing, Expected: size}})
+		}
+	}
+
+	return missing
+}
+
+// readObjectList reads a list of object paths, one per line, optionally
+// followed by whitespace and the object's size. Blank lines and lines
+// starting with '#' are ignored. Relative paths are taken relative to the
+// current directory. If a path is listed more than once (as happens in a
+// manifest when syncing after every write) the largest size is kept.
+func readObjectList(path string) (map[string]int64, error) {
+	f, e := os.Open(path)
+
+	if e != nil {
+		return nil, fmt.Errorf("cannot read object list: %s", e)
+	}
+
+	defer f.Close()
+
+	objects := make(map[string]int64)
+	scanner := bufio.NewScanner(f)
+	line := 0
+
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+
+		if len(text) == 0 || text[0] == '#' {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		size := int64(0)
+
+		if len(fields) > 1 {
+			if size, e = strconv.ParseInt(fields[1], 10, 64); e != nil {
+				return nil, fmt.Errorf("%s:%d: cannot parse size '%s'", path, line, fields[1])
+			}
+		}
+
+		abs, e := filepath.Abs(fields[0])
+		if e != nil {
+			return nil, fmt.Errorf("%s:%d: bad path '%s': %s", path, line, fields[0], e)
+		}
+
+		if size >= objects[abs] {
+			objects[abs] = size
+		}
+	}
+
+	if e = scanner.Err(); e != nil {
+		return nil, fmt.Errorf("cannot read object list: %s", e)
+	}
+
+	return objects, nil
+}
+
+func writeVerifyReport(path string, results []verifiedObject, counts []int, expected map[string]int64,
+	lost []verifiedObject) (e error) {
+	f, e := os.Create(path)
+
+	if e != nil {
+		return fmt.Errorf("cannot create report: %s", e)
+	}
+
+	defer func() {
+		if e == nil {
+			e = f.Close()
+		} else {
+			_ = f.Close()
+		}
+	}()
+
+	w := bufio.NewWriter(f)
+
+	fmt.Fprintf(w, "# perftest verify, %s\n", time.Now().Format(time.RFC3339))
+	if expected != nil {
+		fmt.Fprintf(w, "# expected objects: %d\n", len(expected))
+	}
+	for status := VerifyIntact; status < verifyStatusCount; status++ {
+		fmt.Fprintf(w, "# %s: %d\n", status, counts[status])
+	}
+	if expected != nil {
+		fmt.Fprintf(w, "# acknowledged but lost: %d\n", len(lost))
+	}
+
+	for _, r := range lost {
+		fmt.Fprintf(w, "lost\t%s\t%s\n", r.Path, r.Result.Detail)
+	}
+
+	for _, r := range results {
+		if r.Result.Status != VerifyIntact {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", r.Result.Status, r.Path, r.Result.String())
+		}
+	}
+
+	if e = w.Flush(); e != nil {
+		return fmt.Errorf("cannot write report: %s", e)
+	}
+
+	return nil
+}
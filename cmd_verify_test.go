@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeTestObjects writes n objects from a vendor into dir, returning
+// their paths and contents.
+func writeTestObjects(t *testing.T, dir string, n int) ([]string, [][]byte) {
+	vendor, err := NewObjectVendor("64KB", DataConfig{Compressibility: 50}, 11)
+	AbortOnError(t, err)
+
+	g := vendor.NewGenerator(1)
+	var paths []string
+	var contents [][]byte
+
+	for i := 0; i < n; i++ {
+		blk := g.GetObject()
+		data := append([]byte{}, blk.Data...)
+		vendor.ReturnObject(blk)
+
+		path := filepath.Join(dir, fmt.Sprintf("object-%d.dat", i))
+		AbortOnError(t, os.WriteFile(path, data, 0644))
+		paths = append(paths, path)
+		contents = append(contents, data)
+	}
+
+	return paths, contents
+}
+
+func TestVerifyObjects(t *testing.T) {
+	dir := t.TempDir()
+	paths, contents := writeTestObjects(t, dir, 4)
+
+	corrupt := append([]byte{}, contents[1]...)
+	corrupt[40_000] ^= 0xff
+	AbortOnError(t, os.WriteFile(paths[1], corrupt, 0644))
+	AbortOnError(t, os.Truncate(paths[2], 1000))
+
+	missing := filepath.Join(dir, "missing.dat")
+	results := verifyObjects(append(paths, missing), 2, time.Hour)
+
+	ExpectEqual(t, 5, len(results))
+	for i, expected := range []VerifyStatus{VerifyIntact, VerifyCorrupted, VerifyTruncated, VerifyIntact, VerifyMissing} {
+		ExpectEqual(t, expected, results[i].Result.Status)
+		ExpectEqual(t, append(paths, missing)[i], results[i].Path)
+	}
+
+	ExpectEqual(t, int64(40_000), results[1].Result.Offset)
+	ExpectEqual(t, int64(1000), results[2].Result.Size)
+	ExpectEqual(t, int64(len(contents[2])), results[2].Result.Expected)
+
+	ExpectEqual(t, 0, len(verifyObjects(nil, 2, time.Hour)))
+
+	counts := make([]int, verifyStatusCount)
+	for _, r := range results {
+		counts[r.Result.Status]++
+	}
+
+	report := filepath.Join(dir, "report.txt")
+	AbortOnError(t, writeVerifyReport(report, results, counts, nil, nil))
+
+	out, err := os.ReadFile(report)
+	AbortOnError(t, err)
+	lines := strings.Split(strings.TrimSuffix(string(out), "\n"), "\n")
+
+	ExpectEqual(t, true, strings.HasPrefix(lines[0], "# perftest verify, "))
+	ExpectEqual(t, strings.Join([]string{
+		"# intact: 2",
+		"# unverifiable: 0",
+		"# truncated: 1",
+		"# corrupted: 1",
+		"# missing: 1",
+		"corrupted\t" + paths[1] + "\tcorrupted: 1 bytes differ, first at offset 40000 " +
+			fmt.Sprintf("(expected 0x%02x, got 0x%02x)", contents[1][40_000], corrupt[40_000]),
+		fmt.Sprintf("truncated\t%s\ttruncated: 1000 of %d bytes", paths[2], len(contents[2])),
+		"missing\t" + missing + "\tmissing",
+	}, "\n"), strings.Join(lines[1:], "\n"))
+
+	err = writeVerifyReport(filepath.Join(dir, "no", "such", "dir"), results, counts, nil, nil)
+	ExpectError(t, err)
+}
+
+func TestReadObjectList(t *testing.T) {
+	dir := t.TempDir()
+	list := filepath.Join(dir, "list.txt")
+	AbortOnError(t, os.WriteFile(list, []byte(strings.Join([]string{
+		"# Path Size(bytes)",
+		"/mnt/a.dat 100",
+		"",
+		"/mnt/a.dat 300",
+		"  /mnt/a.dat 200  ",
+		"/mnt/b.dat",
+		"relative.dat 10",
+	}, "\n")), 0644))
+
+	objects, err := readObjectList(list)
+	AbortOnError(t, err)
+
+	cwd, err := os.Getwd()
+	AbortOnError(t, err)
+
+	ExpectEqual(t, 3, len(objects))
+	ExpectEqual(t, int64(300), objects["/mnt/a.dat"])
+	ExpectEqual(t, int64(0), objects["/mnt/b.dat"])
+	ExpectEqual(t, int64(10), objects[filepath.Join(cwd, "relative.dat")])
+
+	AbortOnError(t, os.WriteFile(list, []byte("/mnt/a.dat 100\n/mnt/b.dat big\n"), 0644))
+	_, err = readObjectList(list)
+	if err == nil || err.Error() != list+":2: cannot parse size 'big'" {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	_, err = readObjectList(filepath.Join(dir, "missing.txt"))
+	ExpectError(t, err)
+}
+
+func TestLostObjects(t *testing.T) {
+	dir := t.TempDir()
+	paths, contents := writeTestObjects(t, dir, 5)
+	size := int64(len(contents[0]))
+
+	// The third was acknowledged at half its size, before it was complete
+	expected := map[string]int64{paths[0]: size, paths[1]: size, paths[2]: size / 2, paths[4]: size}
+
+	AbortOnError(t, os.Truncate(paths[1], 1000)) // acknowledged, then lost its tail
+	AbortOnError(t, os.Truncate(paths[3], 1000)) // never acknowledged, so truncation is fine
+
+	// Acknowledged, then its header zeroed, as by a crash
+	zeroed := append(make([]byte, ObjectHeaderSize), contents[4][ObjectHeaderSize:]...)
+	AbortOnError(t, os.WriteFile(paths[4], zeroed, 0644))
+
+	missing := filepath.Join(dir, "missing.dat")
+	expected[missing] = 500
+
+	results := verifyObjects(paths, 2, time.Hour)
+	results = append(results, missingObjects(expected, results)...)
+	ExpectEqual(t, 6, len(results))
+	ExpectEqual(t, VerifyUnverifiable, results[4].Result.Status)
+
+	lost := lostObjects(expected, results)
+	ExpectEqual(t, 3, len(lost))
+
+	byPath := map[string]string{}
+	for _, r := range lost {
+		byPath[r.Path] = r.Result.Detail
+	}
+
+	ExpectEqual(t, fmt.Sprintf("only 1000 of %d acknowledged bytes", size), byPath[paths[1]])
+	ExpectEqual(t, "missing", byPath[missing])
+	ExpectEqual(t, "no object header", byPath[paths[4]])
+
+	// A short acknowledged object counts as lost even if its header says
+	// it's intact, e.g. the header was rewritten
+	short := []verifiedObject{{Path: paths[0], Result: VerifyResult{Status: VerifyIntact, Size: 10}}}
+	ExpectEqual(t, 1, len(lostObjects(map[string]int64{paths[0]: 20}, short)))
+	ExpectEqual(t, 0, len(lostObjects(nil, results)))
+
+	// Too small to have had a header, so there's nothing to lose
+	tiny := []verifiedObject{{Path: paths[0], Result: VerifyResult{Status: VerifyUnverifiable, Size: 10}}}
+	ExpectEqual(t, 0, len(lostObjects(map[string]int64{paths[0]: 10}, tiny)))
+}
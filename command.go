@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Command is an external command perftest runs: file.setup, file.teardown
+// or one of the reporter.capture commands. Given as a string, it's run by
+// the shell, so it can use pipes, redirection, quoting and variables;
+// given as a list, the first entry is run directly with the rest as its
+// arguments, with no shell. Either may be wrapped as
+// {"command": ..., "timeout": "10s"} to limit how long it can run.
+type Command struct {
+	Shell   string   // run with sh -c; empty if Argv is set
+	Argv    []string // run directly
+	Timeout time.Duration
+}
+
+// stderrLimit is how much of a failed command's stderr goes in its error.
+const stderrLimit = 1024
+
+// parseCommand parses a command setting, or returns nil if it's empty.
+// timeout is used unless the command gives its own.
+func parseCommand(name string, raw interface{}, timeout time.Duration) (*Command, error) {
+	c := &Command{Timeout: timeout}
+
+	if settings, ok := raw.(map[string]interface{}); ok {
+		for key := range settings {
+			if key != "command" && key != "timeout" {
+				return nil, fmt.Errorf("unknown setting '%s.%s'; use command and timeout", name, key)
+			}
+		}
+
+		if _, ok := settings["timeout"]; ok {
+			var err error
+			if c.Timeout, err = parseCommandTimeout(name+".timeout", settings["timeout"]); err != nil {
+				return nil, err
+			}
+		}
+
+		if raw = settings["command"]; raw == nil {
+			return nil, fmt.Errorf("%s has no command", name)
+		}
+	}
+
+	switch v := raw.(type) {
+	case nil:
+		return nil, nil
+
+	case string:
+		if len(strings.TrimSpace(v)) == 0 {
+			return nil, nil
+		}
+		c.Shell = v
+
+	case []interface{}:
+		for _, arg := range v {
+			s, ok := arg.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s must be a command string or a list of strings", name)
+			}
+			c.Argv = append(c.Argv, s)
+		}
+
+	case []string:
+		c.Argv = append(c.Argv, v...)
+
+	default:
+		return nil, fmt.Errorf("%s must be a command string or a list of strings", name)
+	}
+
+	if len(c.Shell) == 0 && (len(c.Argv) == 0 || len(c.Argv[0]) == 0) {
+		return nil, fmt.Errorf("%s has no command", name)
+	}
+
+	return c, nil
+}
+
+func parseCommandTimeout(name string, raw interface{}) (time.Duration, error) {
+	if raw == nil {
+		return 0, nil
+	}
+
+	s, _ := raw.(string)
+	d, err := time.ParseDuration(s)
+
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid %s %s: expected a duration such as 10s", name, formatValue(raw))
+	}
+
+	return d, nil
+}
+
+func (c *Command) String() string {
+	if len(c.Argv) == 0 {
+		return c.Shell
+	}
+
+	args := make([]string, len(c.Argv))
+	for i, arg := range c.Argv {
+		args[i] = arg
+		if len(arg) == 0 || strings.ContainsAny(arg, " \t\n'\"\\$") {
+			args[i] = strconv.Quote(arg)
+		}
+	}
+
+	return strings.Join(args, " ")
+}
+
+// Run runs the command at the given phase of the run (setup, before,
+// periodic, after or teardown), returning what it wrote to stdout and
+// stderr. It's killed, along with anything it started, if it runs past its
+// timeout or ctx is done. If it fails, the error includes the end of its
+// stderr.
+//
+// Besides perftest's own environment, the command gets:
+//
+//	PERFTEST_RUN_ID   the run's id
+//	PERFTEST_RUN_DIR  the run directory
+//	PERFTEST_PATHS    the paths the run writes to, separated by spaces
+//	PERFTEST_PHASE    the phase it's run at
+func (c *Command) Run(ctx context.Context, phase string) (stdout, stderr []byte, err error) {
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	var cmd *exec.Cmd
+	if len(c.Argv) > 0 {
+		cmd = exec.CommandContext(ctx, c.Argv[0], c.Argv[1:]...)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", c.Shell)
+	}
+
+	var out, errOut bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &errOut
+	cmd.Env = append(os.Environ(), commandEnv(phase)...)
+
+	// Run it in its own process group, so a timeout kills anything it
+	// started (e.g. the rest of a pipeline) along with it
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+
+	// Don't wait on anything the command left running with our stdout
+	cmd.WaitDelay = time.Second
+
+	err = cmd.Run()
+	stdout, stderr = out.Bytes(), errOut.Bytes()
+
+	switch {
+	case err == nil:
+		return stdout, stderr, nil
+	case ctx.Err() == context.DeadlineExceeded && c.Timeout > 0:
+		err = fmt.Errorf("timed out after %s", c.Timeout)
+	}
+
+	if tail := stderrTail(stderr); len(tail) > 0 {
+		return stdout, stderr, fmt.Errorf("running '%s': %s: %s", c, err, tail)
+	}
+
+	return stdout, stderr, fmt.Errorf("running '%s': %s", c, err)
+}
+
+// commandEnv returns the PERFTEST_ variables for a command.
+func commandEnv(phase string) []string {
+	dir := global.RunDir
+	if abs, err := filepath.Abs(dir); err == nil && len(dir) > 0 {
+		dir = abs
+	}
+
+	return []string{
+		"PERFTEST_RUN_ID=" + global.RunId,
+		"PERFTEST_RUN_DIR=" + dir,
+		"PERFTEST_PATHS=" + strings.Join(global.Paths, " "),
+		"PERFTEST_PHASE=" + phase,
+	}
+}
+
+// stderrTail returns the end of a command's stderr, for an error message.
+func stderrTail(stderr []byte) string {
+	s := strings.TrimSpace(string(stderr))
+
+	if len(s) > stderrLimit {
+		s = "..." + s[len(s)-stderrLimit:]
+	}
+
+	return s
+}
+
+// saveCommandOutput saves a command's stdout and stderr in the run
+// directory as name.stdout and name.stderr, leaving out either if it's
+// empty.
+func saveCommandOutput(name string, stdout, stderr []byte) error {
+	for _, out := range []struct {
+		ext  string
+		data []byte
+	}{
+		{".stdout", stdout},
+		{".stderr", stderr},
+	} {
+		if len(out.data) == 0 {
+			continue
+		}
+
+		if err := os.WriteFile(filepath.Join(global.RunDir, name+out.ext), out.data, 0664); err != nil {
+			return fmt.Errorf("cannot save %s output: %s", name, err)
+		}
+	}
+
+	return nil
+}
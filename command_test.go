@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestParseCommand(t *testing.T) {
+	c, err := parseCommand("file.setup", "mkfs.xfs -f /dev/sdb && mount /dev/sdb /mnt", 0)
+	AbortOnError(t, err)
+	ExpectEqual(t, "mkfs.xfs -f /dev/sdb && mount /dev/sdb /mnt", c.Shell)
+	ExpectEqual(t, 0, len(c.Argv))
+
+	c, err = parseCommand("file.setup", []interface{}{"/usr/local/bin/prep", "--label", "two words"}, time.Second)
+	AbortOnError(t, err)
+	ExpectEqual(t, 3, len(c.Argv))
+	ExpectEqual(t, "two words", c.Argv[2])
+	ExpectEqual(t, time.Second, c.Timeout)
+	ExpectEqual(t, `/usr/local/bin/prep --label "two words"`, c.String())
+
+	c, err = parseCommand("file.setup", map[string]interface{}{"command": "sync", "timeout": "1m"}, time.Second)
+	AbortOnError(t, err)
+	ExpectEqual(t, "sync", c.Shell)
+	ExpectEqual(t, time.Minute, c.Timeout)
+
+	for _, raw := range []interface{}{nil, "", "  "} {
+		c, err = parseCommand("file.setup", raw, 0)
+		AbortOnError(t, err)
+		ExpectEqual(t, (*Command)(nil), c)
+	}
+
+	for _, c := range []struct {
+		raw      interface{}
+		expected string
+	}{
+		{12, "file.setup must be a command string or a list of strings"},
+		{[]interface{}{"ls", 1}, "file.setup must be a command string or a list of strings"},
+		{[]interface{}{}, "file.setup has no command"},
+		{[]interface{}{""}, "file.setup has no command"},
+		{map[string]interface{}{"timeout": "1s"}, "file.setup has no command"},
+		{map[string]interface{}{"cmd": "sync"}, "unknown setting 'file.setup.cmd'; use command and timeout"},
+		{map[string]interface{}{"command": "sync", "timeout": "soon"},
+			"invalid file.setup.timeout 'soon': expected a duration such as 10s"},
+	} {
+		_, err := parseCommand("file.setup", c.raw, 0)
+		if err == nil || err.Error() != c.expected {
+			t.Errorf("%v: expected %q, got %v", c.raw, c.expected, err)
+		}
+	}
+}
+
+func TestCommand_Run(t *testing.T) {
+	runId, paths := global.RunId, global.Paths
+	global.RunId, global.Paths = "test-run", []string{"/mnt/a", "/mnt/b"}
+	defer func() { global.RunId, global.Paths = runId, paths }()
+
+	ctx := context.Background()
+
+	// The shell handles pipes and the environment
+	stdout, stderr, err := (&Command{Shell: `echo "$PERFTEST_RUN_ID $PERFTEST_PHASE $PERFTEST_PATHS" | tr a-z A-Z`}).Run(ctx, "setup")
+	AbortOnError(t, err)
+	ExpectEqual(t, "TEST-RUN SETUP /MNT/A /MNT/B\n", string(stdout))
+	ExpectEqual(t, 0, len(stderr))
+
+	stdout, _, err = (&Command{Shell: "echo $PERFTEST_RUN_DIR"}).Run(ctx, "setup")
+	AbortOnError(t, err)
+	ExpectEqual(t, true, filepath.IsAbs(strings.TrimSpace(string(stdout))))
+
+	// Arguments are passed as they are, without the shell
+	stdout, _, err = (&Command{Argv: []string{"echo", "a  b", "$PERFTEST_PHASE"}}).Run(ctx, "setup")
+	AbortOnError(t, err)
+	ExpectEqual(t, "a  b $PERFTEST_PHASE\n", string(stdout))
+
+	// Failures include stderr
+	stdout, stderr, err = (&Command{Shell: "echo partial; echo 'no such device' >&2; exit 3"}).Run(ctx, "teardown")
+	ExpectEqual(t, "partial\n", string(stdout))
+	ExpectEqual(t, "no such device\n", string(stderr))
+	if err == nil || err.Error() != "running 'echo partial; echo 'no such device' >&2; exit 3': exit status 3: no such device" {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	_, _, err = (&Command{Argv: []string{"/nonexistent/perftest-setup"}}).Run(ctx, "setup")
+	ExpectError(t, err)
+
+	start := time.Now()
+	_, _, err = (&Command{Shell: "sleep 10", Timeout: 50 * time.Millisecond}).Run(ctx, "setup")
+	if err == nil || err.Error() != "running 'sleep 10': timed out after 50ms" {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("timed out command took %s", time.Since(start))
+	}
+
+	// Whatever the command started goes too, not just the shell
+	pidFile := filepath.Join(t.TempDir(), "pid")
+	_, _, err = (&Command{Shell: "sleep 10 & echo $! > " + pidFile + "; sleep 10 | cat", Timeout: 200 * time.Millisecond}).Run(ctx, "setup")
+	ExpectError(t, err)
+
+	data, err := os.ReadFile(pidFile)
+	AbortOnError(t, err)
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	AbortOnError(t, err)
+
+	// Killed, but maybe not yet reaped by init
+	for i := 0; i < 100 && syscall.Kill(pid, 0) == nil && !zombie(pid); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if syscall.Kill(pid, 0) == nil && !zombie(pid) {
+		t.Errorf("background sleep (pid %d) still running after timeout", pid)
+	}
+
+	long := strings.Repeat("x", 2*stderrLimit)
+	ExpectEqual(t, "..."+long[:stderrLimit], stderrTail([]byte(long+"\n")))
+}
+
+// zombie returns whether pid has exited but not been reaped, on systems
+// with /proc.
+func zombie(pid int) bool {
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return false
+	}
+
+	// The state follows the command name, which is in parentheses
+	fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+	return len(fields) > 0 && fields[0] == "Z"
+}
+
+func TestSaveCommandOutput(t *testing.T) {
+	AbortOnError(t, saveCommandOutput("cmdtest", []byte("out\n"), nil))
+	defer os.Remove(filepath.Join(global.RunDir, "cmdtest.stdout"))
+
+	out, err := os.ReadFile(filepath.Join(global.RunDir, "cmdtest.stdout"))
+	AbortOnError(t, err)
+	ExpectEqual(t, "out\n", string(out))
+
+	if _, err = os.Stat(filepath.Join(global.RunDir, "cmdtest.stderr")); !os.IsNotExist(err) {
+		t.Errorf("expected no stderr file for empty stderr, got %v", err)
+	}
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/sys/unix"
+)
+
+// DashboardStats are the reporter's results for one interval, as shown on
+// the dashboard. Bandwidths are bytes/sec.
+type DashboardStats struct {
+	Phase   string         // empty without phases
+	Ops     [3]DashboardOp // by op
+	Paths   []DashboardPath
+	Syncers []DashboardSyncer // batch syncers only
+	Errors  int64
+}
+
+type DashboardOp struct {
+	Count         int64
+	Bandwidth     int64
+	MeanBandwidth int64
+	IOPS          float64
+	MeanIOPS      float64
+	Latency       []time.Duration // at each of Percentiles, over the whole run
+	MaxLatency    time.Duration
+}
+
+type DashboardPath struct {
+	Path        string
+	Read, Write int64
+	IOPS        float64
+}
+
+type DashboardSyncer struct {
+	Job    string
+	Queued int
+}
+
+// Dashboard is a full-screen view of the run, redrawn in the terminal with
+// plain ANSI escapes. While it's up, the log only goes to log.txt.
+type Dashboard struct {
+	out     io.Writer
+	runners *RunnerList
+	updates chan *DashboardStats
+	stats   *DashboardStats // latest, nil until the first interval
+	history [3][]float64    // bandwidth (IOPS for deletes) by op, for sparklines
+	start   time.Time
+	stop    func()
+}
+
+// dashboardHistory is how many intervals are kept for sparklines.
+const dashboardHistory = 200
+
+// sparks are the bars of a sparkline, lowest to highest.
+var sparks = []rune("▁▂▃▄▅▆▇█")
+
+// NewDashboard takes over the terminal once the run starts. It fails if
+// stdout isn't a terminal.
+func NewDashboard(runners *RunnerList) (*Dashboard, error) {
+	if _, _, e := terminalSize(); e != nil {
+		return nil, fmt.Errorf("cannot show dashboard: stdout is not a terminal")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+
+	d := &Dashboard{
+		out:     os.Stdout,
+		runners: runners,
+		updates: make(chan *DashboardStats, 16),
+		stop: func() {
+			cancel()
+			wg.Wait()
+		},
+	}
+
+	wg.Add(1)
+	go func() {
+		d.Run(ctx)
+		wg.Done()
+	}()
+
+	return d, nil
+}
+
+// Update shows the stats for an interval. If the dashboard has fallen that
+// far behind, they're dropped rather than holding up the reporter.
+func (d *Dashboard) Update(s *DashboardStats) {
+	select {
+	case d.updates <- s:
+	default:
+	}
+}
+
+func (d *Dashboard) Run(ctx context.Context) {
+	select {
+	case <-ctx.Done():
+		return
+	case <-global.Start:
+	}
+
+	d.start = time.Now()
+	muteConsole(true)
+	fmt.Fprint(d.out, "\x1b[?1049h\x1b[?25l") // alternate screen, hide cursor
+
+	defer func() {
+		fmt.Fprint(d.out, "\x1b[?25h\x1b[?1049l")
+		muteConsole(false)
+	}()
+
+	// Redraw between intervals too, to keep runner states and time current
+	t := time.NewTicker(time.Second)
+	defer t.Stop()
+
+	d.draw()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case s := <-d.updates:
+			d.add(s)
+			d.draw()
+
+		case <-t.C:
+			d.draw()
+		}
+	}
+}
+
+// Stop restores the terminal, so the rest of the log shows there again.
+func (d *Dashboard) Stop() {
+	d.stop()
+}
+
+func (d *Dashboard) add(s *DashboardStats) {
+	d.stats = s
+
+	for op := range d.history {
+		v := float64(s.Ops[op].Bandwidth)
+		if op == Delete {
+			v = s.Ops[op].IOPS
+		}
+
+		d.history[op] = append(d.history[op], v)
+
+		if len(d.history[op]) > dashboardHistory {
+			d.history[op] = d.history[op][1:]
+		}
+	}
+}
+
+func (d *Dashboard) draw() {
+	width, height, e := terminalSize()
+	if e != nil {
+		return
+	}
+
+	lines := d.render(time.Since(d.start), width)
+	if len(lines) > height {
+		lines = lines[:height]
+	}
+
+	var b strings.Builder
+	b.WriteString("\x1b[H")
+
+	for i, line := range lines {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString(line)
+		b.WriteString("\x1b[K") // clear the rest of the line
+	}
+
+	b.WriteString("\x1b[J") // and everything below
+	_, _ = io.WriteString(d.out, b.String())
+}
+
+// render lays out the dashboard in lines no wider than width.
+func (d *Dashboard) render(elapsed time.Duration, width int) []string {
+	var lines []string
+	line := func(format string, args ...interface{}) {
+		lines = append(lines, truncate(fmt.Sprintf(format, args...), width))
+	}
+
+	s := d.stats
+	title := fmt.Sprintf("perftest %s  elapsed %s", global.RunId, elapsed.Truncate(time.Second))
+	if s != nil && len(s.Phase) > 0 {
+		title += "  " + s.Phase
+	}
+	line("%s", title)
+	line("")
+
+	if s == nil {
+		line("waiting for the first interval...")
+	} else {
+		const opWidth = 8 + 2*15 + 2*11
+		historyWidth := width - opWidth - 1
+		if historyWidth > dashboardHistory {
+			historyWidth = dashboardHistory
+		}
+
+		line("%-8s%15s%15s%11s%11s %s", "op", "bandwidth", "mean", "iops", "mean", "history")
+
+		for op, o := range s.Ops {
+			if o.Count == 0 {
+				continue
+			}
+
+			bandwidth, mean := "", ""
+			if op != Delete {
+				bandwidth, mean = SprintSize(o.Bandwidth)+"/sec", SprintSize(o.MeanBandwidth)+"/sec"
+			}
+
+			line("%-8s%15s%15s%11.0f%11.0f %s", opName(op), bandwidth, mean, o.IOPS, o.MeanIOPS,
+				sparkline(d.history[op], historyWidth))
+		}
+
+		if len(s.Paths) > 0 {
+			pathWidth := 4
+			for _, p := range s.Paths {
+				if n := utf8.RuneCountInString(p.Path); n > pathWidth {
+					pathWidth = n
+				}
+			}
+			if pathWidth > 40 {
+				pathWidth = 40
+			}
+
+			line("")
+			line("%-*s%15s%15s%11s", pathWidth, "path", "read", "write", "iops")
+
+			for _, p := range s.Paths {
+				line("%-*s%15s%15s%11.0f", pathWidth, truncate(p.Path, pathWidth),
+					SprintSize(p.Read)+"/sec", SprintSize(p.Write)+"/sec", p.IOPS)
+			}
+		}
+
+		line("")
+		header := fmt.Sprintf("%-8s", "latency")
+		for _, p := range Percentiles {
+			header += fmt.Sprintf("%11s", percentileName(p))
+		}
+		line("%s%11s", header, "max")
+
+		for op, o := range s.Ops {
+			if o.Count == 0 {
+				continue
+			}
+
+			row := fmt.Sprintf("%-8s", opName(op))
+			for _, l := range o.Latency {
+				row += fmt.Sprintf("%11s", SprintDuration(l))
+			}
+			line("%s%11s", row, SprintDuration(o.MaxLatency))
+		}
+
+		if len(s.Syncers) > 0 {
+			queues := make([]string, len(s.Syncers))
+			for i, q := range s.Syncers {
+				queues[i] = fmt.Sprintf("%s %d", q.Job, q.Queued)
+			}
+
+			line("")
+			line("%-12s%s", "sync queue", strings.Join(queues, ", "))
+		}
+	}
+
+	line("")
+	line("%-12s%s", "runners", d.runnerStates())
+
+	if s != nil {
+		line("%-12s%d", "errors", s.Errors)
+	}
+
+	line("")
+	line("Control-C to stop; log in %s", global.RunDir)
+
+	return lines
+}
+
+// runnerStates describes the current runners, e.g. "6 running, 2 syncing".
+func (d *Dashboard) runnerStates() string {
+	counts := d.runners.States()
+	var states []string
+
+	for state, n := range counts {
+		if n > 0 {
+			states = append(states, fmt.Sprintf("%d %s", n, RunnerState(state)))
+		}
+	}
+
+	if len(states) == 0 {
+		return "none"
+	}
+
+	return strings.Join(states, ", ")
+}
+
+// sparkline draws the last width values as bars scaled to the largest.
+func sparkline(values []float64, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	if len(values) > width {
+		values = values[len(values)-width:]
+	}
+
+	max := 0.0
+	for _, v := range values {
+		if v > max {
+			max = v
+		}
+	}
+
+	var b strings.Builder
+
+	for _, v := range values {
+		i := 0
+		if max > 0 && v > 0 {
+			i = int(v/max*float64(len(sparks)-1) + 0.5)
+		}
+		b.WriteRune(sparks[i])
+	}
+
+	return b.String()
+}
+
+// truncate shortens s to at most width runes.
+func truncate(s string, width int) string {
+	if width < 0 {
+		width = 0
+	}
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	return string([]rune(s)[:width])
+}
+
+// terminalSize returns the width and height of the terminal on stdout.
+func terminalSize() (width, height int, e error) {
+	ws, e := unix.IoctlGetWinsize(int(os.Stdout.Fd()), unix.TIOCGWINSZ)
+	if e != nil {
+		return 0, 0, e
+	}
+	return int(ws.Col), int(ws.Row), nil
+}
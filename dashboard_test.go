@@ -0,0 +1,86 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestSparkline(t *testing.T) {
+	ExpectEqual(t, "", sparkline(nil, 10))
+	ExpectEqual(t, "▁▁", sparkline([]float64{0, 0}, 10))
+	ExpectEqual(t, "▁▅█", sparkline([]float64{0, 50, 100}, 10))
+
+	// Only the most recent values that fit
+	ExpectEqual(t, "▅█", sparkline([]float64{1000, 50, 100}, 2))
+	ExpectEqual(t, "", sparkline([]float64{1, 2}, 0))
+}
+
+func TestDashboard_Render(t *testing.T) {
+	rl := NewRunnerList(nil, nil)
+	rl.AddRunner(&Runner{state: int32(RunnerSyncing)})
+	rl.AddRunner(&Runner{state: int32(RunnerSyncing)})
+	rl.AddRunner(&Runner{state: int32(RunnerThrottled)})
+
+	d := &Dashboard{runners: rl}
+	lines := d.render(time.Second, 100)
+	text := strings.Join(lines, "\n")
+
+	if !strings.Contains(text, "waiting for the first interval") {
+		t.Errorf("expected waiting message before the first interval:\n%s", text)
+	}
+	if !strings.Contains(text, "1 throttled, 2 syncing") {
+		t.Errorf("expected runner states:\n%s", text)
+	}
+
+	s := &DashboardStats{
+		Phase:   "phase 2 (mixed)",
+		Paths:   []DashboardPath{{Path: "/mnt/a", Read: 1 << 20, Write: 2 << 20, IOPS: 48}},
+		Syncers: []DashboardSyncer{{Job: "logs", Queued: 7}},
+		Errors:  3,
+	}
+	s.Ops[Write] = DashboardOp{
+		Count:         100,
+		Bandwidth:     2 << 20,
+		MeanBandwidth: 1 << 20,
+		IOPS:          32,
+		MeanIOPS:      16,
+		Latency:       []time.Duration{time.Millisecond, 2 * time.Millisecond, 3 * time.Millisecond, 4 * time.Millisecond},
+		MaxLatency:    5 * time.Millisecond,
+	}
+
+	d.add(s)
+	d.add(s)
+	lines = d.render(time.Minute, 100)
+	text = strings.Join(lines, "\n")
+
+	for _, expected := range []string{
+		"phase 2 (mixed)",
+		"2.0 MiB/sec",
+		"██",
+		"/mnt/a",
+		"p99.9",
+		"5.00ms",
+		"logs 7",
+		"1 throttled, 2 syncing",
+		"errors      3",
+	} {
+		if !strings.Contains(text, expected) {
+			t.Errorf("expected %q in dashboard:\n%s", expected, text)
+		}
+	}
+
+	// No reads or deletes yet, so no rows for them
+	for _, line := range lines {
+		if strings.HasPrefix(line, "read") || strings.HasPrefix(line, "delete") {
+			t.Errorf("expected only writes, got: %s", line)
+		}
+	}
+
+	for _, line := range d.render(time.Minute, 30) {
+		if n := utf8.RuneCountInString(line); n > 30 {
+			t.Errorf("line is %d wide, expected at most 30: %s", n, line)
+		}
+	}
+}
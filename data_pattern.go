@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"hash/crc32"
+	"os"
+	"sync"
+)
+
+// DataPattern selects what generated object data looks like.
+type DataPattern int
+
+const (
+	PatternRandom DataPattern = iota // random bytes, with compressibility per compress mode
+	PatternZeros                     // all zeros
+	PatternText                      // random lowercase letters
+	PatternRepeat                    // a user-supplied pattern, repeated
+	PatternCorpus                    // chunks sampled from a user-supplied file
+	patternCount
+)
+
+func parseDataPattern(pattern string) (DataPattern, error) {
+	switch pattern {
+	case "", "random":
+		return PatternRandom, nil
+	case "zeros", "zero":
+		return PatternZeros, nil
+	case "text":
+		return PatternText, nil
+	case "repeat":
+		return PatternRepeat, nil
+	case "corpus":
+		return PatternCorpus, nil
+	default:
+		return PatternRandom, fmt.Errorf("unknown data pattern '%s'; use random, zeros, text, repeat, or corpus", pattern)
+	}
+}
+
+func (p DataPattern) String() string {
+	switch p {
+	case PatternRandom:
+		return "random"
+	case PatternZeros:
+		return "zeros"
+	case PatternText:
+		return "text"
+	case PatternRepeat:
+		return "repeat"
+	case PatternCorpus:
+		return "corpus"
+	default:
+		return fmt.Sprintf("pattern %d", int(p))
+	}
+}
+
+// needsSource reports whether the pattern copies from user-supplied data.
+func (p DataPattern) needsSource() bool {
+	return p == PatternRepeat || p == PatternCorpus
+}
+
+// Pattern sources (the repeat pattern and corpus contents) are too big to
+// put in object headers, so headers carry a checksum of the source instead
+// and the data itself is registered here, both when generating objects and
+// before verifying them.
+var patternSources = struct {
+	sync.RWMutex
+	data map[uint32][]byte
+}{data: make(map[uint32][]byte)}
+
+// registerPatternSource makes data available to generate and verify
+// objects, returning the id to put in their headers.
+func registerPatternSource(data []byte) uint32 {
+	id := crc32.ChecksumIEEE(data)
+
+	patternSources.Lock()
+	patternSources.data[id] = data
+	patternSources.Unlock()
+
+	return id
+}
+
+func lookupPatternSource(id uint32) []byte {
+	patternSources.RLock()
+	defer patternSources.RUnlock()
+	return patternSources.data[id]
+}
+
+// loadCorpus reads a corpus file and registers it as a pattern source.
+func loadCorpus(path string) (uint32, error) {
+	data, e := os.ReadFile(path)
+
+	if e != nil {
+		return 0, fmt.Errorf("cannot read corpus: %s", e)
+	}
+
+	if len(data) == 0 {
+		return 0, fmt.Errorf("corpus file %s is empty", path)
+	}
+
+	return registerPatternSource(data), nil
+}
@@ -0,0 +1,69 @@
+package main
+
+// dedupePool is a fixed set of blocks that objects copy from to make some
+// of their data repeat. The blocks are generated from a seed rather than
+// taken from earlier objects, so the pool (and any object built from it)
+// can be regenerated from an object header when verifying.
+type dedupePool struct {
+	key       ObjectHeader // settings the pool was generated from
+	blockSize int
+	blocks    int
+	data      []byte
+}
+
+// poolKey is the part of a header that determines the pool's contents.
+func poolKey(h *ObjectHeader) ObjectHeader {
+	return ObjectHeader{
+		Compressibility: h.Compressibility,
+		CompressMode:    h.CompressMode,
+		Pattern:         h.Pattern,
+		PatternSource:   h.PatternSource,
+		DedupeBlockSize: h.DedupeBlockSize,
+		DedupeSeed:      h.DedupeSeed,
+		DedupePool:      h.DedupePool,
+	}
+}
+
+// newDedupePool generates the pool described by h. The pool's blocks are
+// filled the same way as the rest of the object (e.g. same
+// compressibility).
+func newDedupePool(h *ObjectHeader) *dedupePool {
+	p := &dedupePool{
+		key:       poolKey(h),
+		blockSize: int(h.DedupeBlockSize),
+		blocks:    int(h.DedupePool),
+		data:      make([]byte, int(h.DedupeBlockSize)*int(h.DedupePool)),
+	}
+
+	seq := NewByteSequence(0)
+	seq.Seed(h.DedupeSeed)
+	fillData(&p.key, p.data, seq)
+
+	return p
+}
+
+// matches reports whether the pool is the one described by h.
+func (p *dedupePool) matches(h *ObjectHeader) bool {
+	return p != nil && p.key == poolKey(h)
+}
+
+func (p *dedupePool) block(i int) []byte {
+	return p.data[i*p.blockSize : (i+1)*p.blockSize]
+}
+
+// dedupeFill overwrites roughly percent of the whole blocks in buf with
+// blocks from the pool. The first block is never replaced, since it holds
+// the object header. Which blocks are replaced, and by what, is drawn from
+// seed.
+func (p *dedupePool) dedupeFill(buf []byte, percent int, seed uint64) {
+	rand := NewNumberSequence()
+	rand.Set(int64(mixSeed(seed, 0)))
+
+	for offset := p.blockSize; offset+p.blockSize <= len(buf); offset += p.blockSize {
+		n := uint64(rand.Next()) >> 16 // low bits of an LCG are poor
+
+		if int(n%100) < percent {
+			copy(buf[offset:], p.block(int((n/100)%uint64(p.blocks))))
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+type ErrorMode int
+
+const (
+	ErrorAbort     ErrorMode = iota // stop the run on the first error (default)
+	ErrorContinue                   // log and count errors, keep going
+	ErrorRetry                      // back off and try again, give up after too many consecutive failures
+	ErrorThreshold                  // keep going until an error count or error rate is exceeded
+)
+
+// ErrorPolicy decides whether a runner keeps going after a failed op. It
+// is shared by all runners; per-runner state (consecutive failures) is
+// passed in by the caller.
+type ErrorPolicy struct {
+	Mode       ErrorMode
+	Retries    int           // retry: consecutive failures allowed before giving up
+	Backoff    time.Duration // retry: delay after first failure, doubled after each subsequent one
+	MaxBackoff time.Duration // retry: upper bound on delay
+	MaxErrors  int64         // threshold: abort once this many errors are seen (0 = no limit)
+	MaxRate    float64       // threshold: abort once errors exceed this percent of ops (0 = no limit)
+	MinOps     int64         // threshold: ops required before MaxRate is checked
+	ops        int64
+	errors     int64
+}
+
+func NewErrorPolicy(mode string) (*ErrorPolicy, error) {
+	p := &ErrorPolicy{
+		Retries:    5,
+		Backoff:    time.Millisecond * 100,
+		MaxBackoff: time.Second * 10,
+		MinOps:     100,
+	}
+
+	switch mode {
+	case "", "abort":
+		p.Mode = ErrorAbort
+	case "continue", "ignore":
+		p.Mode = ErrorContinue
+	case "retry", "backoff":
+		p.Mode = ErrorRetry
+	case "threshold", "limit":
+		p.Mode = ErrorThreshold
+	default:
+		return nil, fmt.Errorf("unknown error policy '%s'; use abort, continue, retry, or threshold", mode)
+	}
+
+	return p, nil
+}
+
+func (p *ErrorPolicy) String() string {
+	switch p.Mode {
+	case ErrorContinue:
+		return "continue"
+	case ErrorRetry:
+		return fmt.Sprintf("retry (%d retries, backoff %s up to %s)", p.Retries, p.Backoff, p.MaxBackoff)
+	case ErrorThreshold:
+		return fmt.Sprintf("threshold (max errors %d, max rate %.2f%%)", p.MaxErrors, p.MaxRate)
+	default:
+		return "abort"
+	}
+}
+
+// CountOp records that an op was attempted, successful or not.
+func (p *ErrorPolicy) CountOp() {
+	atomic.AddInt64(&p.ops, 1)
+}
+
+// Handle is called after a failed op. failures is the number of
+// consecutive failures seen by the calling runner, including this one. A
+// non-nil return means the run should stop; the returned error explains
+// why. In retry mode Handle sleeps for the backoff period before
+// returning.
+func (p *ErrorPolicy) Handle(ctx context.Context, err error, failures int) error {
+	errorCount := atomic.AddInt64(&p.errors, 1)
+
+	switch p.Mode {
+	case ErrorContinue:
+		return nil
+
+	case ErrorRetry:
+		if failures > p.Retries {
+			return fmt.Errorf("giving up after %d retries: %w", p.Retries, err)
+		}
+
+		backoff := p.Backoff
+		for i := 1; i < failures && backoff < p.MaxBackoff; i++ {
+			backoff *= 2
+		}
+		if backoff > p.MaxBackoff {
+			backoff = p.MaxBackoff
+		}
+
+		t := time.NewTimer(backoff)
+		defer t.Stop()
+
+		select {
+		case <-ctx.Done():
+		case <-t.C:
+		}
+		return nil
+
+	case ErrorThreshold:
+		if p.MaxErrors > 0 && errorCount >= p.MaxErrors {
+			return fmt.Errorf("error limit reached (%d errors): %w", errorCount, err)
+		}
+
+		ops := atomic.LoadInt64(&p.ops)
+		if p.MaxRate > 0 && ops >= p.MinOps {
+			rate := float64(errorCount) * 100 / float64(ops)
+			if rate > p.MaxRate {
+				return fmt.Errorf("error rate %.2f%% exceeds limit of %.2f%%: %w", rate, p.MaxRate, err)
+			}
+		}
+		return nil
+
+	default:
+		return err
+	}
+}
+
+// errnoName returns the symbolic errno (e.g. "ENOSPC") wrapped inside e,
+// or "other" if there isn't one.
+func errnoName(e error) string {
+	var errno unix.Errno
+
+	if errors.As(e, &errno) {
+		if name := unix.ErrnoName(errno); name != "" {
+			return name
+		}
+		return fmt.Sprintf("errno %d", int(errno))
+	}
+
+	return "other"
+}
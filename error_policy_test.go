@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestErrorPolicy_Modes(t *testing.T) {
+	ctx := context.Background()
+	err := fmt.Errorf("boom")
+
+	p, e := NewErrorPolicy("abort")
+	AbortOnError(t, e)
+	expectErrorText(t, "boom", p.Handle(ctx, err, 1))
+
+	p, e = NewErrorPolicy("continue")
+	AbortOnError(t, e)
+	for i := 1; i < 1000; i++ {
+		ExpectEqual(t, nil, p.Handle(ctx, err, i))
+	}
+
+	_, e = NewErrorPolicy("explode")
+	expectErrorText(t, "unknown error policy 'explode'; use abort, continue, retry, or threshold", e)
+}
+
+func TestErrorPolicy_Retry(t *testing.T) {
+	ctx := context.Background()
+	err := fmt.Errorf("boom")
+
+	p, e := NewErrorPolicy("retry")
+	AbortOnError(t, e)
+	p.Retries = 3
+	p.Backoff = time.Millisecond
+	p.MaxBackoff = time.Millisecond * 2
+
+	for i := 1; i <= 3; i++ {
+		ExpectEqual(t, nil, p.Handle(ctx, err, i))
+	}
+
+	expectErrorText(t, "giving up after 3 retries: boom", p.Handle(ctx, err, 4))
+}
+
+func TestErrorPolicy_Threshold(t *testing.T) {
+	ctx := context.Background()
+	err := fmt.Errorf("boom")
+
+	p, e := NewErrorPolicy("threshold")
+	AbortOnError(t, e)
+	p.MaxErrors = 3
+
+	ExpectEqual(t, nil, p.Handle(ctx, err, 1))
+	ExpectEqual(t, nil, p.Handle(ctx, err, 2))
+	expectErrorText(t, "error limit reached (3 errors): boom", p.Handle(ctx, err, 3))
+
+	p, e = NewErrorPolicy("threshold")
+	AbortOnError(t, e)
+	p.MaxRate = 5
+	p.MinOps = 100
+
+	for i := 0; i < 100; i++ {
+		p.CountOp()
+	}
+
+	for i := 0; i < 5; i++ {
+		ExpectEqual(t, nil, p.Handle(ctx, err, 1))
+	}
+
+	expectErrorText(t, "error rate 6.00% exceeds limit of 5.00%: boom", p.Handle(ctx, err, 1))
+}
+
+func TestErrnoName(t *testing.T) {
+	pathErr := &os.PathError{Op: "write", Path: "/tmp/foo", Err: syscall.ENOSPC}
+
+	ExpectEqual(t, "ENOSPC", errnoName(pathErr))
+	ExpectEqual(t, "ENOSPC", errnoName(fmt.Errorf("cannot get block writer: %w", pathErr)))
+	ExpectEqual(t, "other", errnoName(fmt.Errorf("short write")))
+}
+
+func expectErrorText(t *testing.T, expected string, err error) {
+	t.Helper()
+
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, got %v", expected, err)
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	fillFilling  = 0 // writing until target reached
+	fillChurning = 1 // delete+write at steady fullness
+	fillFull     = 2 // target reached, no more writes
+)
+
+type FillConfig struct {
+	Target   float64       // percent full at which a path is done
+	ChurnAt  float64       // if > 0, percent full at which to switch to delete+write churn
+	Interval time.Duration // how often to sample file system usage
+}
+
+// FillMonitor periodically samples how full each path's file system is,
+// logging write bandwidth against percent full to fill.csv. When a path
+// reaches its target (or runs out of space) its runners either stop or,
+// with churn enabled, switch to deleting an object before each write. The
+// run finishes once every path is full.
+type FillMonitor struct {
+	*zap.SugaredLogger
+	config *FillConfig
+	lock   sync.Mutex
+	paths  []*FillPath
+	log    *os.File
+	stop   func()
+	usage  func(path string) (float64, error) // percent full; diskUsage but in tests
+}
+
+// FillPath is the fill state of a single store path, shared by the runners
+// writing to it.
+type FillPath struct {
+	monitor *FillMonitor
+	Path    string
+	state   int32
+	bytes   int64 // bytes written since last sample
+}
+
+func NewFillMonitor(config *FillConfig) (m *FillMonitor, e error) {
+	m = &FillMonitor{
+		SugaredLogger: Logger(),
+		config:        config,
+		paths:         make([]*FillPath, 0),
+		usage:         diskUsage,
+	}
+
+	path := filepath.Join(global.RunDir, "fill.csv")
+	m.log, e = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0664)
+
+	if e != nil {
+		return nil, fmt.Errorf("failed creating fill log: %s", e)
+	}
+
+	_, e = fmt.Fprintf(m.log, "# %s, %s, %s, %s\n", "Time(sec)", "Path", "Full(percent)", "Rate(bytes/sec)")
+
+	if e != nil {
+		_ = m.log.Close()
+		return nil, fmt.Errorf("failed writing to fill log: %s", e)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+
+	m.stop = func() {
+		cancel()
+		wg.Wait()
+	}
+
+	wg.Add(1)
+	go func() {
+		m.Run(ctx)
+		wg.Done()
+	}()
+
+	return m, nil
+}
+
+// AddPath registers a store path to be monitored, if it isn't already.
+func (m *FillMonitor) AddPath(path string) *FillPath {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for _, p := range m.paths {
+		if p.Path == path {
+			return p
+		}
+	}
+
+	p := &FillPath{monitor: m, Path: path}
+	m.paths = append(m.paths, p)
+	return p
+}
+
+func (m *FillMonitor) Stop() {
+	m.stop()
+	_ = m.log.Close()
+	m.Infof("fill monitor stopped")
+}
+
+func (m *FillMonitor) Run(ctx context.Context) {
+	<-global.Start
+
+	startTime := time.Now()
+	lastSampleTime := startTime
+
+	t := time.NewTicker(m.config.Interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case tick := <-t.C:
+			interval := tick.Sub(lastSampleTime).Seconds()
+			lastSampleTime = tick
+
+			m.lock.Lock()
+			paths := m.paths
+			m.lock.Unlock()
+
+			for _, p := range paths {
+				m.sample(p, tick.Sub(startTime).Seconds(), interval)
+			}
+		}
+	}
+}
+
+func (m *FillMonitor) sample(p *FillPath, elapsed float64, interval float64) {
+	rate := int64(float64(atomic.SwapInt64(&p.bytes, 0)) / interval)
+	percent, e := m.usage(p.Path)
+
+	if e != nil {
+		m.Errorf("cannot get usage of %s: %s", p.Path, e)
+		return
+	}
+
+	fmt.Fprintf(m.log, "%.3f, %s, %.2f, %d\n", elapsed, p.Path, percent, rate)
+	m.Infof("fill %s: %.1f%% full, %s/sec", p.Path, percent, SprintSize(rate))
+
+	// Churning holds a path near churn_at, but if it creeps up to the
+	// target anyway the path is done.
+	if percent >= m.config.Target {
+		p.setState(fillFull, fmt.Sprintf("%.1f%% full", percent))
+	} else if m.config.ChurnAt > 0 && percent >= m.config.ChurnAt {
+		p.setState(fillChurning, fmt.Sprintf("%.1f%% full", percent))
+	}
+}
+
+// checkDone finishes the run once no path has any writing left to do.
+func (m *FillMonitor) checkDone() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for _, p := range m.paths {
+		if p.State() != fillFull {
+			return
+		}
+	}
+
+	finishRun("fill target reached on all paths")
+}
+
+func (p *FillPath) State() int32 {
+	return atomic.LoadInt32(&p.state)
+}
+
+func (p *FillPath) Churning() bool {
+	return p.State() == fillChurning
+}
+
+func (p *FillPath) Full() bool {
+	return p.State() == fillFull
+}
+
+// AddBytes counts bytes written to this path for the bandwidth log.
+func (p *FillPath) AddBytes(n int) {
+	atomic.AddInt64(&p.bytes, int64(n))
+}
+
+// OutOfSpace is called by a runner that got ENOSPC. The path stops filling
+// regardless of its target.
+func (p *FillPath) OutOfSpace() {
+	if p.State() != fillFilling {
+		return
+	}
+
+	if p.monitor.config.ChurnAt > 0 {
+		p.setState(fillChurning, "out of space")
+	} else {
+		p.setState(fillFull, "out of space")
+	}
+}
+
+// setState moves the path on to state. Paths only move forward, from
+// filling to churning to full.
+func (p *FillPath) setState(state int32, reason string) {
+	for {
+		old := p.State()
+		if old >= state {
+			return // already there; another runner got here first
+		}
+		if atomic.CompareAndSwapInt32(&p.state, old, state) {
+			break
+		}
+	}
+
+	switch state {
+	case fillChurning:
+		p.monitor.Infof("fill %s: %s, switching to delete+write churn", p.Path, reason)
+	case fillFull:
+		p.monitor.Infof("fill %s: %s, done writing", p.Path, reason)
+		p.monitor.checkDone()
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testFillMonitor returns a FillMonitor whose usage comes from usage, by
+// path, without sampling on a timer.
+func testFillMonitor(t *testing.T, config *FillConfig, usage map[string]float64) *FillMonitor {
+	log, err := os.Create(filepath.Join(t.TempDir(), "fill.csv"))
+	AbortOnError(t, err)
+	t.Cleanup(func() { _ = log.Close() })
+
+	return &FillMonitor{
+		SugaredLogger: Logger(),
+		config:        config,
+		log:           log,
+		usage: func(path string) (float64, error) {
+			return usage[path], nil
+		},
+	}
+}
+
+func drainDone() string {
+	select {
+	case reason := <-global.Done:
+		return reason
+	default:
+		return ""
+	}
+}
+
+func TestFillMonitor_Churn(t *testing.T) {
+	drainDone()
+	defer drainDone()
+
+	usage := map[string]float64{}
+	m := testFillMonitor(t, &FillConfig{Target: 95, ChurnAt: 90}, usage)
+	a, b := m.AddPath("/mnt/a"), m.AddPath("/mnt/b")
+	ExpectEqual(t, a, m.AddPath("/mnt/a"))
+
+	usage["/mnt/a"], usage["/mnt/b"] = 50, 50
+	m.sample(a, 1, 1)
+	m.sample(b, 1, 1)
+	ExpectEqual(t, int32(fillFilling), a.State())
+
+	// Filling to churn_at switches to churn; ENOSPC does the same
+	usage["/mnt/a"] = 91
+	m.sample(a, 2, 1)
+	ExpectEqual(t, true, a.Churning())
+	b.OutOfSpace()
+	ExpectEqual(t, true, b.Churning())
+
+	// Churn that stays below the target carries on, and never goes back
+	usage["/mnt/a"] = 80
+	m.sample(a, 3, 1)
+	ExpectEqual(t, true, a.Churning())
+	a.OutOfSpace()
+	ExpectEqual(t, true, a.Churning())
+
+	// The run is done once every path reaches the target
+	usage["/mnt/a"], usage["/mnt/b"] = 96, 94
+	m.sample(a, 4, 1)
+	m.sample(b, 4, 1)
+	ExpectEqual(t, true, a.Full())
+	ExpectEqual(t, true, b.Churning())
+	ExpectEqual(t, "", drainDone())
+
+	usage["/mnt/b"] = 95
+	m.sample(b, 5, 1)
+	ExpectEqual(t, true, b.Full())
+	ExpectEqual(t, "fill target reached on all paths", drainDone())
+
+	// Full is final
+	usage["/mnt/b"] = 10
+	m.sample(b, 6, 1)
+	ExpectEqual(t, true, b.Full())
+
+	out, err := os.ReadFile(m.log.Name())
+	AbortOnError(t, err)
+	ExpectEqual(t, 8, strings.Count(string(out), "\n"))
+	ExpectEqual(t, true, strings.Contains(string(out), "2.000, /mnt/a, 91.00, 0\n"))
+}
+
+func TestFillMonitor_NoChurn(t *testing.T) {
+	drainDone()
+	defer drainDone()
+
+	usage := map[string]float64{"/mnt/a": 99}
+	m := testFillMonitor(t, &FillConfig{Target: 100}, usage)
+	a, b := m.AddPath("/mnt/a"), m.AddPath("/mnt/b")
+
+	m.sample(a, 1, 1)
+	ExpectEqual(t, int32(fillFilling), a.State())
+
+	// Without churn, ENOSPC means done
+	a.OutOfSpace()
+	ExpectEqual(t, true, a.Full())
+	ExpectEqual(t, "", drainDone())
+
+	b.AddBytes(4096)
+	usage["/mnt/b"] = 100
+	m.sample(b, 2, 2)
+	ExpectEqual(t, true, b.Full())
+	ExpectEqual(t, "fill target reached on all paths", drainDone())
+
+	out, err := os.ReadFile(m.log.Name())
+	AbortOnError(t, err)
+	ExpectEqual(t, true, strings.Contains(string(out), "2.000, /mnt/b, 100.00, 2048\n"))
+}
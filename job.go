@@ -0,0 +1,240 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// Job is a workload run by its own group of runners: paths, object sizes,
+// op mix, sync policy and rate limits. Without a "jobs" list in the config
+// there's a single job made from the top-level settings; with one, each
+// entry overrides the top-level settings for that job, as fio's job
+// sections override its global section. Jobs run concurrently, and jobs
+// with a path in common share its objects.
+type Job struct {
+	*zap.SugaredLogger
+	Id             int // index in global.Jobs
+	Name           string
+	Paths          []string
+	RunnersPerPath int
+	ObjectVendor   *ObjectVendor
+	IoSize         int64
+	ReadPercent    int // range 0-100
+	Syncer         Syncer
+	SyncWhen       SyncWhen
+	OpLimit        *RateLimiter // ops/sec; nil for no limit
+	ByteLimit      *RateLimiter // bytes/sec; nil for no limit
+}
+
+// jobConfigs returns the config for each job in a phase (nil without
+// phases). Settings a job doesn't have come from the top level, and the
+// phase's settings override both.
+func jobConfigs(phase *Phase) ([]*viper.Viper, error) {
+	raw := viper.Get("jobs")
+	configs := []*viper.Viper{viper.GetViper()}
+
+	if raw != nil {
+		list, ok := raw.([]interface{})
+		if !ok || len(list) == 0 {
+			return nil, fmt.Errorf("'jobs' in config.json must be a list of job settings")
+		}
+
+		configs = make([]*viper.Viper, len(list))
+
+		for i, entry := range list {
+			settings, ok := entry.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("job %d in config.json isn't a set of settings", i+1)
+			}
+
+			var e error
+			if configs[i], e = overlay(viper.GetViper(), settings); e != nil {
+				return nil, fmt.Errorf("job %d: %s", i+1, e)
+			}
+		}
+	}
+
+	if phase != nil {
+		for i := range configs {
+			var e error
+			if configs[i], e = overlay(configs[i], phase.Settings); e != nil {
+				return nil, fmt.Errorf("phase %s: %s", phase.Name, e)
+			}
+		}
+	}
+
+	return configs, nil
+}
+
+// overlay returns a config with settings on top of base's, leaving out
+// base's lists of jobs and phases.
+func overlay(base *viper.Viper, settings map[string]interface{}) (*viper.Viper, error) {
+	v := viper.New()
+
+	for _, key := range base.AllKeys() {
+		if top, _, _ := strings.Cut(key, "."); top != "jobs" && top != "phases" {
+			v.SetDefault(key, base.Get(key))
+		}
+	}
+
+	return v, v.MergeConfigMap(settings)
+}
+
+// newJob creates job id from its config. The manifest (which may be nil)
+// is shared by all jobs that sync.
+func newJob(id int, v *viper.Viper, manifest *DurabilityManifest) (job *Job, err error) {
+	job = &Job{
+		Id:             id,
+		Name:           v.GetString("name"),
+		Paths:          v.GetStringSlice("file.paths"),
+		RunnersPerPath: v.GetInt("file.runners_per_path"),
+		IoSize:         int64(v.GetSizeInBytes("iosize")),
+		ReadPercent:    v.GetInt("read"),
+	}
+
+	if len(job.Name) == 0 {
+		job.Name = fmt.Sprintf("job%d", id+1)
+	}
+
+	// Only name the job in messages if there's a jobs list
+	job.SugaredLogger = Logger()
+	prefix := ""
+
+	if viper.Get("jobs") != nil {
+		job.SugaredLogger = job.With(zap.String("job", job.Name))
+		prefix = fmt.Sprintf("job %s: ", job.Name)
+	}
+
+	if len(job.Paths) == 0 {
+		return job, nil
+	}
+
+	if job.RunnersPerPath == 0 {
+		return nil, fmt.Errorf("%sfile store must have more than 1 runner per path (set file.runners_per_path)", prefix)
+	}
+
+	if job.IoSize == 0 {
+		return nil, fmt.Errorf("%sno io size specified; create 'iosize' in config.json", prefix)
+	}
+
+	if job.ReadPercent < 0 || job.ReadPercent > 100 {
+		return nil, fmt.Errorf("%sread percent must be between 0 and 100", prefix)
+	}
+
+	if global.Fill != nil && job.ReadPercent > 0 {
+		job.Warnf("fill mode only writes; ignoring read percent")
+		job.ReadPercent = 0
+	}
+
+	if v == viper.GetViper() {
+		job.ObjectVendor = global.ObjectVendor
+	} else if job.ObjectVendor, err = newObjectVendor(v); err != nil {
+		return nil, fmt.Errorf("%scannot create object vendor: %s", prefix, err)
+	}
+
+	if err = job.initSync(v, manifest); err != nil {
+		return nil, fmt.Errorf("%s%s", prefix, err)
+	}
+
+	if iops := v.GetFloat64("rate.iops"); iops > 0 {
+		job.OpLimit = NewRateLimiter(iops)
+		job.Infof("limited to %g ops/sec", iops)
+	}
+
+	if bw := v.GetSizeInBytes("rate.bandwidth"); bw > 0 {
+		job.ByteLimit = NewRateLimiter(float64(bw))
+		job.Infof("limited to %s/sec", SprintSize(int64(bw)))
+	}
+
+	job.Infof("%d runners per path on %s", job.RunnersPerPath, strings.Join(job.Paths, ", "))
+	job.Infof("iosize: %s, read percent: %d", SprintSize(job.IoSize), job.ReadPercent)
+
+	return job, nil
+}
+
+func (job *Job) initSync(v *viper.Viper, manifest *DurabilityManifest) error {
+	willSync := false
+
+	switch v.GetString("file.sync_on") {
+	case "", "close":
+		job.SyncWhen = SyncOnClose
+	case "write", "io":
+		job.SyncWhen = SyncOnWrite
+	default:
+		return fmt.Errorf("unknown file.sync_on '%s'; use close or write", v.GetString("file.sync_on"))
+	}
+
+	switch v.GetString("file.sync") {
+	case "close", "inline":
+		job.Infof("syncing inline")
+		job.Syncer = NewSyncInline(manifest)
+		willSync = true
+	case "batch", "batched", "batcher":
+		job.Infof("syncing in batches")
+
+		syncBatcherMaxWait := v.GetDuration("sync_batcher.max_wait")
+		if syncBatcherMaxWait == 0 {
+			return fmt.Errorf("no max_wait specified; create 'sync_batcher.max_wait' in config.json")
+		}
+
+		syncBatcherMaxPending := v.GetInt("sync_batcher.max_pending")
+		if syncBatcherMaxPending == 0 {
+			return fmt.Errorf("no max_pending specified; create 'sync_batcher.max_pending' in config.json")
+		}
+
+		job.Syncer = NewSyncBatcher(syncBatcherMaxWait, syncBatcherMaxPending, manifest)
+		willSync = true
+	case "", "none":
+		job.Syncer = &SyncNone{}
+	default:
+		return fmt.Errorf("unknown file.sync '%s'; use none, inline or batch", v.GetString("file.sync"))
+	}
+
+	if !willSync {
+		job.SyncWhen = SyncOnClose
+	} else if job.SyncWhen == SyncOnWrite {
+		job.Infof("sync after every write")
+	} else {
+		job.Infof("sync on file close")
+	}
+
+	return nil
+}
+
+// newObjectVendor creates an object vendor from the size and data settings
+// in a config.
+func newObjectVendor(v *viper.Viper) (*ObjectVendor, error) {
+	sizespec := v.GetString("size")
+
+	if len(sizespec) == 0 {
+		return nil, fmt.Errorf("no file size specified; create 'size' in config.json")
+	}
+
+	compressMode, err := parseCompressMode(v.GetString("compress_mode"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	pattern, err := parseDataPattern(v.GetString("data.pattern"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	dataConfig := DataConfig{
+		Compressibility: v.GetInt("compressibility"),
+		CompressMode:    compressMode,
+		Pattern:         pattern,
+		Repeat:          v.GetString("data.repeat"),
+		Corpus:          v.GetString("data.corpus"),
+		DedupePercent:   v.GetInt("dedupe_percent"),
+		DedupeBlockSize: int(v.GetSizeInBytes("dedupe_block_size")),
+		DedupePool:      v.GetInt("dedupe_pool"),
+	}
+
+	return NewObjectVendor(sizespec, dataConfig, global.Seed)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestJobConfigs(t *testing.T) {
+	defer viper.Reset()
+	viper.SetConfigType("json")
+
+	AbortOnError(t, viper.ReadConfig(strings.NewReader(`{
+		"size": "4MB",
+		"iosize": "1MB",
+		"read": 20,
+		"file": {"paths": ["/tmp/a"], "runners_per_path": 4, "sync": "inline"},
+		"jobs": [
+			{"name": "big"},
+			{"name": "small", "size": "8KB", "read": 0, "file": {"paths": ["/tmp/b"]}, "rate": {"iops": 100}}
+		]
+	}`)))
+
+	configs, err := jobConfigs(nil)
+	AbortOnError(t, err)
+	ExpectEqual(t, 2, len(configs))
+
+	big, small := configs[0], configs[1]
+
+	ExpectEqual(t, "big", big.GetString("name"))
+	ExpectEqual(t, "4MB", big.GetString("size"))
+	ExpectEqual(t, 20, big.GetInt("read"))
+	ExpectEqual(t, "/tmp/a", strings.Join(big.GetStringSlice("file.paths"), ","))
+
+	// Overrides replace single settings, leaving the rest of a section
+	ExpectEqual(t, "8KB", small.GetString("size"))
+	ExpectEqual(t, 0, small.GetInt("read"))
+	ExpectEqual(t, "/tmp/b", strings.Join(small.GetStringSlice("file.paths"), ","))
+	ExpectEqual(t, 4, small.GetInt("file.runners_per_path"))
+	ExpectEqual(t, "inline", small.GetString("file.sync"))
+	ExpectEqual(t, 100.0, small.GetFloat64("rate.iops"))
+	ExpectEqual(t, 0.0, big.GetFloat64("rate.iops"))
+	ExpectEqual(t, nil, small.Get("jobs"))
+}
+
+func TestJobConfigs_Default(t *testing.T) {
+	defer viper.Reset()
+
+	configs, err := jobConfigs(nil)
+	AbortOnError(t, err)
+	ExpectEqual(t, 1, len(configs))
+
+	if configs[0] != viper.GetViper() {
+		t.Errorf("expected top-level config without a jobs list")
+	}
+}
+
+func TestJobConfigs_Invalid(t *testing.T) {
+	defer viper.Reset()
+
+	for _, jobs := range []interface{}{
+		"job1",
+		[]interface{}{},
+		[]interface{}{"job1"},
+	} {
+		viper.Set("jobs", jobs)
+		_, err := jobConfigs(nil)
+		ExpectErrorf(t, err, "expected error for jobs %v", jobs)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"math/bits"
+	"time"
+)
+
+// Latencies are counted in buckets that are exact below latencySubBuckets
+// nsec and then split each power of two into latencySubBuckets/2 buckets,
+// so any percentile is within 1.6% of the real value however long the run.
+const (
+	latencySubBits    = 7
+	latencySubBuckets = 1 << latencySubBits
+	latencyHalf       = latencySubBuckets / 2
+	latencyBuckets    = (64-latencySubBits)*latencyHalf + latencySubBuckets
+)
+
+// LatencyTracker counts op latencies so percentiles can be found later
+// without keeping every sample. It isn't safe for concurrent use; the
+// reporter owns the ones it keeps.
+type LatencyTracker struct {
+	counts []int64
+	count  int64
+	sum    time.Duration
+	min    time.Duration
+	max    time.Duration
+}
+
+func NewLatencyTracker() *LatencyTracker {
+	return &LatencyTracker{counts: make([]int64, latencyBuckets)}
+}
+
+func (l *LatencyTracker) Add(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+
+	l.counts[latencyBucket(d)]++
+
+	if l.count == 0 || d < l.min {
+		l.min = d
+	}
+	if d > l.max {
+		l.max = d
+	}
+
+	l.count++
+	l.sum += d
+}
+
+func (l *LatencyTracker) Count() int64 {
+	return l.count
+}
+
+func (l *LatencyTracker) Max() time.Duration {
+	return l.max
+}
+
+func (l *LatencyTracker) Mean() time.Duration {
+	if l.count == 0 {
+		return 0
+	}
+	return l.sum / time.Duration(l.count)
+}
+
+// Percentile returns the latency that p percent (0-100) of ops took no
+// longer than, or 0 if there are none.
+func (l *LatencyTracker) Percentile(p float64) time.Duration {
+	if l.count == 0 {
+		return 0
+	}
+
+	rank := int64(p / 100 * float64(l.count))
+	if rank < 1 {
+		rank = 1
+	} else if rank > l.count {
+		rank = l.count
+	}
+
+	seen := int64(0)
+
+	for i, n := range l.counts {
+		if seen += n; seen >= rank {
+			d := latencyBucketMax(i)
+
+			// The extremes are known exactly
+			if d > l.max {
+				d = l.max
+			} else if d < l.min {
+				d = l.min
+			}
+			return d
+		}
+	}
+
+	return l.max
+}
+
+// Percentiles are the ones reported for each op.
+var Percentiles = []float64{50, 90, 99, 99.9}
+
+// String summarizes the percentiles, e.g. for logging.
+func (l *LatencyTracker) String() string {
+	s := ""
+	for _, p := range Percentiles {
+		s += fmt.Sprintf("p%g %s, ", p, SprintDuration(l.Percentile(p)))
+	}
+	return s + fmt.Sprintf("max %s", SprintDuration(l.max))
+}
+
+func latencyBucket(d time.Duration) int {
+	v := uint64(d)
+
+	if v < latencySubBuckets {
+		return int(v)
+	}
+
+	shift := bits.Len64(v) - latencySubBits
+	return shift*latencyHalf + int(v>>shift)
+}
+
+// latencyBucketMax is the longest latency counted in bucket i.
+func latencyBucketMax(i int) time.Duration {
+	if i < latencySubBuckets {
+		return time.Duration(i)
+	}
+
+	shift := i/latencyHalf - 1
+	m := uint64(i%latencyHalf + latencyHalf)
+	return time.Duration((m+1)<<shift - 1)
+}
+
+// SprintDuration formats a latency to three significant digits or so.
+func SprintDuration(d time.Duration) string {
+	switch {
+	case d < time.Microsecond:
+		return d.String()
+	case d < time.Millisecond:
+		return fmt.Sprintf("%.1fus", float64(d)/float64(time.Microsecond))
+	case d < time.Second:
+		return fmt.Sprintf("%.2fms", float64(d)/float64(time.Millisecond))
+	default:
+		return fmt.Sprintf("%.3fs", d.Seconds())
+	}
+}
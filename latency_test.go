@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLatencyTracker_Percentile(t *testing.T) {
+	l := NewLatencyTracker()
+	ExpectEqual(t, time.Duration(0), l.Percentile(50))
+
+	// 1..1000 usec, in a scrambled order
+	for i := 0; i < 1000; i++ {
+		l.Add(time.Duration((i*7919)%1000+1) * time.Microsecond)
+	}
+
+	ExpectEqual(t, int64(1000), l.Count())
+	ExpectEqual(t, time.Millisecond, l.Max())
+	ExpectEqual(t, time.Duration(500500)*time.Nanosecond, l.Mean())
+
+	for _, c := range []struct {
+		p        float64
+		expected time.Duration
+	}{
+		{0, time.Microsecond},
+		{50, 500 * time.Microsecond},
+		{90, 900 * time.Microsecond},
+		{99, 990 * time.Microsecond},
+		{99.9, 999 * time.Microsecond},
+		{100, time.Millisecond},
+	} {
+		actual := l.Percentile(c.p)
+		diff := float64(actual-c.expected) / float64(c.expected)
+
+		if diff < -0.016 || diff > 0.016 {
+			t.Errorf("p%g: expected about %s, got %s", c.p, c.expected, actual)
+		}
+	}
+}
+
+func TestLatencyTracker_Buckets(t *testing.T) {
+	// Every bucket's range follows on from the one before
+	for i := 1; i < latencyBuckets; i++ {
+		lo := latencyBucketMax(i-1) + 1
+
+		if latencyBucket(lo) != i || latencyBucket(latencyBucketMax(i)) != i {
+			t.Fatalf("bucket %d doesn't cover %d-%d", i, lo, latencyBucketMax(i))
+		}
+	}
+
+	l := NewLatencyTracker()
+	l.Add(-1)
+	l.Add(time.Duration(1<<63 - 1))
+	ExpectEqual(t, time.Duration(0), l.Percentile(50))
+	ExpectEqual(t, time.Duration(1<<63-1), l.Percentile(100))
+}
+
+func TestSprintDuration(t *testing.T) {
+	ExpectEqual(t, "500ns", SprintDuration(500))
+	ExpectEqual(t, "12.5us", SprintDuration(12500))
+	ExpectEqual(t, "1.50ms", SprintDuration(1500*time.Microsecond))
+	ExpectEqual(t, "2.000s", SprintDuration(2*time.Second))
+}
@@ -1,15 +1,21 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"net/url"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -25,54 +31,229 @@ const (
 type runnerInitFn func(rl *RunnerList) error
 
 type Globals struct {
+	Dashboard     *Dashboard  // non-nil in TUI mode
+	Done          chan string // send a reason to finish the run normally
+	ErrorPolicy   *ErrorPolicy
+	Fill          *FillMonitor        // non-nil in fill mode
+	Jobs          []*Job              // in the current phase
+	Manifest      *DurabilityManifest // non-nil if recording synced objects
 	ObjectVendor  *ObjectVendor
+	Paths         []string // every path the run writes to, in any phase
+	Phases        []*Phase
+	Recorder      *TraceRecorder // non-nil if recording an op trace
 	Reporter      *Reporter
+	RunDir        string // where the run's logs and results go
 	RunId         string // unique name for this run
 	RunnerInitFns []runnerInitFn
 	RunnerError   chan error
-	Syncer        Syncer
-	SyncWhen      SyncWhen
-	IoSize        int64
+	Runners       int    // runners created so far, across phases
+	Seed          uint64 // drives all workload randomness
+	VerifyMode    VerifyMode
 	Subdirs       int           // each runner will have this many subdirs
-	ReadPercent   int           // range 0-100
 	Start         chan struct{} // close to start reporters and runners
 }
 
 var global = &Globals{
+	Done:          make(chan string, 1),
 	RunnerInitFns: []runnerInitFn{},
 	RunnerError:   make(chan error, 10),
 }
 
+// commands are named by the first argument; run is the default.
+var commands = map[string]func(args []string) int{
+	"clean":    cleanCommand,
+	"compare":  compareCommand,
+	"datagen":  datagenCommand,
+	"report":   reportCommand,
+	"run":      runCommand,
+	"sweep":    sweepCommand,
+	"validate": validateCommand,
+	"verify":   verifyCommand,
+	"version":  versionCommand,
+}
+
 func init() {
 	global.RunId = time.Now().Format("2006-01-02-15-04-05")
-	global.RunnerInitFns = append(global.RunnerInitFns, startFileRunners)
+	global.RunnerInitFns = append(global.RunnerInitFns, startFileRunners, startReplayRunners)
 	global.Start = make(chan struct{})
 }
 
 func main() {
-	var err error
+	// Without a command, flags go to run, as before there were commands
+	if len(os.Args) < 2 || strings.HasPrefix(os.Args[1], "-") {
+		os.Exit(runCommand(os.Args[1:]))
+	}
 
-	viper.SetConfigName("config")
-	viper.AddConfigPath(".")
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+
+	os.Exit(cmd(os.Args[2:]))
+}
+
+func usage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Printf("usage: perftest <command> [flags]\n")
+	fmt.Printf("commands: %s\n", strings.Join(names, ", "))
+	fmt.Printf("run \"perftest <command> --help\" for a command's flags\n")
+}
+
+// version is set when building a release, with
+// -ldflags "-X main.version=1.2.3".
+var version = "dev"
+
+// versionCommand implements "perftest version".
+func versionCommand(args []string) int {
+	if len(args) > 0 {
+		fmt.Printf("usage: perftest version\n")
+		return 2
+	}
+
+	fmt.Printf("perftest %s\n", version)
+
+	if info, ok := debug.ReadBuildInfo(); ok {
+		fmt.Printf("built with %s\n", info.GoVersion)
+
+		for _, s := range info.Settings {
+			switch s.Key {
+			case "vcs.revision", "vcs.time", "vcs.modified":
+				fmt.Printf("%s: %s\n", s.Key, s.Value)
+			}
+		}
+	}
+
+	return 0
+}
+
+func setDefaults() {
 	viper.SetDefault("iosize", "1MB")
 	viper.SetDefault("size", "4MB/100/dat")
-	viper.SetDefault("reporter.maxWait", "1s")
 	viper.SetDefault("compressibility", "50")
+	viper.SetDefault("compress_mode", "runs")
+	viper.SetDefault("data.pattern", "random")
+	viper.SetDefault("dedupe_percent", "0")
+	viper.SetDefault("dedupe_block_size", "4KB")
+	viper.SetDefault("dedupe_pool", "1024")
 	viper.SetDefault("subdirs", "0")
 	viper.SetDefault("read", "0")
+	viper.SetDefault("errors.policy", "abort")
+	viper.SetDefault("reporter.logsystem", "true")
+	viper.SetDefault("fill.target", "100")
+	viper.SetDefault("fill.interval", "1s")
+	viper.SetDefault("replay.timing", "fast")
+	viper.SetDefault("replay.speed", "1")
+	viper.SetDefault("replay.workers", "16")
+	viper.SetDefault("replay.prepare", "true")
+}
+
+// configFlags choose the config file and override its settings, for the
+// commands that read one.
+type configFlags struct {
+	file string
+	set  []string
+}
+
+func addConfigFlags(flags *pflag.FlagSet) *configFlags {
+	c := &configFlags{}
+	flags.StringVar(&c.file, "config", "", "config file to use instead of ./config.json")
+	flags.StringArrayVar(&c.set, "set", nil, "override a config setting, e.g. --set file.sync=batch (repeatable)")
+	return c
+}
+
+// load reads the config into viper with the defaults, the command's
+// settings flags (if not nil) and then the --set overrides on top.
+func (c *configFlags) load(settings *pflag.FlagSet) error {
+	setDefaults()
+	viper.SetConfigName("config")
+	viper.AddConfigPath(".")
+
+	if len(c.file) > 0 {
+		viper.SetConfigFile(c.file)
+	}
+
+	if err := viper.ReadInConfig(); err != nil {
+		return fmt.Errorf("error reading config file: %s", err)
+	}
+
+	if settings != nil {
+		if err := viper.BindPFlags(settings); err != nil {
+			return fmt.Errorf("error binding flags: %s", err)
+		}
+	}
+
+	for _, setting := range c.set {
+		key, value, err := parseSetting(setting)
+		if err != nil {
+			return err
+		}
+		viper.Set(key, value)
+	}
+
+	return nil
+}
+
+// parseSetting parses a --set override. Values are strings, which viper
+// converts as needed, except for JSON lists and objects, e.g.
+// `file.paths=["/mnt/a","/mnt/b"]`.
+func parseSetting(setting string) (key string, value interface{}, err error) {
+	key, raw, ok := strings.Cut(setting, "=")
+	key = strings.TrimSpace(key)
 
-	if err = viper.ReadInConfig(); err != nil {
-		fmt.Printf("error reading config file: %s\n", err)
-		os.Exit(-1)
+	if !ok || len(key) == 0 {
+		return "", nil, fmt.Errorf("invalid setting '%s'; use --set key=value", setting)
 	}
 
-	pflag.String("runid", "", "unique name for this run")
-	pflag.Int("read", 0, "set read percent (0-100)")
-	pflag.Parse()
+	if strings.HasPrefix(raw, "[") || strings.HasPrefix(raw, "{") {
+		if err = json.Unmarshal([]byte(raw), &value); err != nil {
+			return "", nil, fmt.Errorf("invalid value for %s: %s", key, err)
+		}
+		return key, value, nil
+	}
+
+	return key, raw, nil
+}
+
+// runCommand implements "perftest run": run the test the config describes
+// until it finishes or is interrupted.
+func runCommand(args []string) int {
+	var err error
+
+	flags := pflag.NewFlagSet("run", pflag.ContinueOnError)
+	config := addConfigFlags(flags)
+	outputDir := flags.String("output-dir", "", "directory to create the run directory in (default current directory)")
+	dryRun := flags.Bool("dry-run", false, "check the config and show what the run would do, without running it")
+
+	// These are settings too, so they're bound to the config
+	settings := pflag.NewFlagSet("settings", pflag.ContinueOnError)
+	settings.String("runid", "", "unique name for this run")
+	settings.Int("read", 0, "set read percent (0-100)")
+	settings.Uint64("seed", 0, "seed for workload randomness (0 picks one)")
+	settings.Bool("tui", false, "show a live dashboard instead of logging to the terminal")
+	flags.AddFlagSet(settings)
+	flags.Usage = func() {
+		fmt.Printf("usage: perftest run [flags]\n")
+		flags.PrintDefaults()
+	}
 
-	if err = viper.BindPFlags(pflag.CommandLine); err != nil {
-		fmt.Printf("error binding flags: %s\n", err)
-		os.Exit(-1)
+	if err = flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return 2
+	}
+
+	if err = config.load(settings); err != nil {
+		fmt.Printf("%s\n", err)
+		return 1
 	}
 
 	runId := viper.GetString("runid")
@@ -81,194 +262,558 @@ func main() {
 		global.RunId = runId
 	}
 
-	if err = os.MkdirAll(global.RunId, 0750); err != nil {
+	if *dryRun {
+		return dryRunCommand(filepath.Join(*outputDir, global.RunId))
+	}
+
+	if err = checkSettings(); err != nil {
+		fmt.Printf("%s: %s\n", viper.ConfigFileUsed(), err)
+		return 1
+	}
+
+	if global.Paths, err = configPaths(); err != nil {
+		fmt.Printf("%s: %s\n", viper.ConfigFileUsed(), err)
+		return 1
+	}
+
+	global.RunDir = filepath.Join(*outputDir, global.RunId)
+
+	if err = os.MkdirAll(global.RunDir, 0750); err != nil {
 		fmt.Printf("cannot make output directory: %s\n", err)
-		os.Exit(-1)
+		return 1
 	}
 
 	logger := Logger()
 	logger.Infof("starting run %s", global.RunId)
 
-	iosize := viper.GetSizeInBytes("iosize")
-
-	if iosize == 0 {
-		logger.Errorf("no io size specified; create 'iosize' in config.json")
-		os.Exit(-1)
+	global.Seed = viper.GetUint64("seed")
+	if global.Seed == 0 {
+		global.Seed = mixSeed(uint64(time.Now().UnixNano()), 0)
 	}
 
-	sizespec := viper.GetString("size")
+	logger.Infof("seed: %d", global.Seed)
 
-	if len(sizespec) == 0 {
-		logger.Errorf("no file size specified; create 'size' in config.json")
-		os.Exit(-1)
+	err = os.WriteFile(filepath.Join(global.RunDir, "seed.txt"), []byte(fmt.Sprintf("%d\n", global.Seed)), 0664)
+	if err != nil {
+		logger.Errorf("cannot write seed: %s", err)
+		return 1
 	}
 
-	compressibility := viper.GetInt("compressibility")
 	global.Subdirs = viper.GetInt("subdirs")
-	global.ReadPercent = viper.GetInt("read")
 
-	if global.ReadPercent < 0 || global.ReadPercent > 100 {
-		logger.Errorf("read percent must be between 0 and 100")
-		os.Exit(-1)
+	fillConfig, err := parseFillConfig()
+	if err != nil {
+		logger.Errorf(err.Error())
+		return 1
 	}
 
-	logger.Infof("read percent: %d", global.ReadPercent)
+	if fillConfig != nil {
+		logger.Infof("fill mode: target %.1f%% full, churn at %.1f%%", fillConfig.Target, fillConfig.ChurnAt)
 
-	global.ObjectVendor, err = NewObjectVendor(sizespec, compressibility)
+		if global.Fill, err = NewFillMonitor(fillConfig); err != nil {
+			logger.Errorf(err.Error())
+			return 1
+		}
+	}
 
-	if err != nil {
-		logger.Errorf("cannot create object vendor: %s", err)
-		os.Exit(-1)
+	if global.VerifyMode, err = parseVerifyMode(viper.GetString("verify")); err != nil {
+		logger.Errorf(err.Error())
+		return 1
 	}
 
-	reporterInterval := viper.GetDuration("reporter.interval")
-	if reporterInterval == 0 {
-		logger.Errorf("no reporter interval specified; create 'reporter.interval' in config.json")
-		os.Exit(-1)
+	if global.VerifyMode != VerifyOff {
+		logger.Infof("verifying data on read (%s)", viper.GetString("verify"))
 	}
 
-	reporterConfig := &ReporterConfig{
-		Interval:         reporterInterval,
-		WarmUp:           viper.GetDuration("reporter.warmup"),
-		LatencyEnabled:   viper.GetBool("reporter.loglatency"),
-		BandwidthEnabled: viper.GetBool("reporter.logbandwidth"),
-		Capture:          viper.GetStringMapString("reporter.capture"),
+	if global.ErrorPolicy, err = parseErrorPolicy(); err != nil {
+		logger.Errorf(err.Error())
+		return 1
+	}
+
+	logger.Infof("error policy: %s", global.ErrorPolicy)
+
+	global.ObjectVendor, err = newObjectVendor(viper.GetViper())
+
+	if err != nil {
+		logger.Errorf("cannot create object vendor: %s", err)
+		return 1
+	}
+
+	reporterConfig, err := parseReporterConfig()
+	if err != nil {
+		logger.Errorf(err.Error())
+		return 1
 	}
 
 	global.Reporter, err = NewReporter(reporterConfig)
 
 	if err != nil {
 		logger.Errorf("failed creating reporter: %s", err)
-		os.Exit(-1)
+		return 1
+	}
+
+	if viper.GetBool("reporter.logtrace") {
+		if global.Recorder, err = NewTraceRecorder(filepath.Join(global.RunDir, "trace.jsonl")); err != nil {
+			logger.Errorf(err.Error())
+			return 1
+		}
+	}
+
+	if global.Phases, err = parsePhases(); err != nil {
+		logger.Errorf(err.Error())
+		return 1
+	}
+
+	setupCmd, teardownCmd, err := parseSetupCommands()
+	if err != nil {
+		logger.Errorf(err.Error())
+		return 1
 	}
 
-	runners := NewRunnerList(viper.GetString("file.setup"), viper.GetString("file.teardown"))
+	runners := NewRunnerList(setupCmd, teardownCmd)
 
 	for _, fn := range global.RunnerInitFns {
 		err = fn(runners)
 
 		if err != nil {
 			logger.Errorf(err.Error())
-			os.Exit(-1)
+			return 1
 		}
 	}
 
 	if err = runners.Start(); err != nil {
 		logger.Errorf(err.Error())
-		os.Exit(-1)
+		return 1
+	}
+
+	if global.Recorder != nil {
+		global.Recorder.Start()
+	}
+
+	if viper.GetBool("tui") {
+		if global.Dashboard, err = NewDashboard(runners); err != nil {
+			logger.Warnf("%s; logging instead", err)
+		} else {
+			global.Reporter.ShowOn(global.Dashboard)
+		}
 	}
 
 	close(global.Start)
 
+	var phaseRunner *PhaseRunner
+	if len(global.Phases) > 0 {
+		phaseRunner = NewPhaseRunner(runners)
+	}
+
+	if d := viper.GetDuration("duration"); d > 0 {
+		time.AfterFunc(d, func() { finishRun(fmt.Sprintf("ran for %s", d)) })
+	}
+
 	logger.Infof("running... press Control-C to stop.")
 	sig := make(chan os.Signal, 1)
 	signal.Notify(sig, os.Interrupt)
+	end := ""
+	err = nil
 
 	for {
 		select {
 		case <-sig:
 			logger.Infof("Control-C, stopping.")
+			end = "interrupted"
 			goto stop
 
 		case err = <-global.RunnerError:
 			logger.Errorf("runner error: %s", err)
+			end = "runner error"
+			goto stop
+
+		case end = <-global.Done:
+			logger.Infof("%s, stopping.", end)
 			goto stop
 		}
 	}
 
 stop:
 
+	if global.Dashboard != nil {
+		global.Dashboard.Stop()
+	}
 	global.Reporter.PreStop() // stops further logging
+	if phaseRunner != nil {
+		phaseRunner.Stop()
+	}
 	runners.Stop()
-	global.Syncer.Stop()
+	for _, job := range global.Jobs {
+		job.Syncer.Stop()
+	}
+	if global.Recorder != nil {
+		global.Recorder.Close()
+	}
+	if global.Manifest != nil {
+		_ = global.Manifest.Close()
+	}
+	if global.Fill != nil {
+		global.Fill.Stop()
+	}
 	global.Reporter.Stop()
+
+	summary := global.Reporter.Summary()
+	summary.End = end
+	if err != nil {
+		summary.Error = err.Error()
+	}
+	if e := summary.Write(filepath.Join(global.RunDir, "summary.json")); e != nil {
+		logger.Errorf(e.Error())
+	}
+
 	logger.Infof("finished run %s", global.RunId)
-	os.Exit(0)
+
+	// So scripts and CI can tell a run that stopped on an error
+	if end == "runner error" {
+		return 1
+	}
+
+	return 0
 }
 
-func startFileRunners(rl *RunnerList) (err error) {
-	logger := Logger()
-	paths := viper.GetStringSlice("file.paths")
+// finishRun ends the run normally (as opposed to with a runner error).
+func finishRun(reason string) {
+	select {
+	case global.Done <- reason:
+	default:
+		// already finishing
+	}
+}
+
+// parseFillConfig returns the fill mode settings, or nil if fill mode is
+// off.
+func parseFillConfig() (*FillConfig, error) {
+	if !viper.GetBool("fill.enabled") {
+		return nil, nil
+	}
+
+	config := &FillConfig{
+		Target:   viper.GetFloat64("fill.target"),
+		ChurnAt:  viper.GetFloat64("fill.churn_at"),
+		Interval: viper.GetDuration("fill.interval"),
+	}
 
-	if len(paths) == 0 {
-		logger.Infof("no file runner paths specified; skipping")
-		return nil
+	if config.Target <= 0 || config.Target > 100 {
+		return nil, fmt.Errorf("fill.target must be between 0 and 100 percent")
 	}
 
-	runnersPerPath := viper.GetInt("file.runners_per_path")
+	if config.ChurnAt < 0 || config.ChurnAt > 100 {
+		return nil, fmt.Errorf("fill.churn_at must be between 0 and 100 percent")
+	}
+
+	if config.ChurnAt > 0 && config.ChurnAt >= config.Target {
+		return nil, fmt.Errorf("fill.churn_at (%g%%) must be below fill.target (%g%%)", config.ChurnAt, config.Target)
+	}
+
+	return config, nil
+}
 
-	if runnersPerPath == 0 {
-		return fmt.Errorf("file store must have more than 1 runner per path (set file.runners_per_path)")
+func parseReporterConfig() (*ReporterConfig, error) {
+	config := &ReporterConfig{
+		Interval:         viper.GetDuration("reporter.interval"),
+		WarmUp:           viper.GetDuration("reporter.warmup"),
+		LatencyEnabled:   viper.GetBool("reporter.loglatency"),
+		BandwidthEnabled: viper.GetBool("reporter.logbandwidth"),
 	}
 
-	global.IoSize = int64(viper.GetSizeInBytes("iosize"))
+	var err error
+	if config.Capture, err = parseCaptureConfig(viper.Get("reporter.capture")); err != nil {
+		return nil, err
+	}
 
-	willSync := false
-	switch viper.GetString("file.sync") {
-	case "close", "inline":
-		logger.Infof("syncing inline")
-		global.Syncer = NewSyncInline()
-		willSync = true
-	case "batch", "batched", "batcher":
-		logger.Infof("syncing in batches")
+	if config.Interval == 0 {
+		return nil, fmt.Errorf("no reporter interval specified; create 'reporter.interval' in config.json")
+	}
 
-		syncBatcherMaxWait := viper.GetDuration("sync_batcher.max_wait")
-		if syncBatcherMaxWait == 0 {
-			return fmt.Errorf("no max_wait specified; create 'sync_batcher.max_wait' in config.json")
+	if viper.GetBool("reporter.logsystem") {
+		if config.SystemPaths, err = configPaths(); err != nil {
+			return nil, err
 		}
+	}
+
+	return config, nil
+}
+
+// parseSetupCommands parses file.setup and file.teardown, which are nil
+// if not set.
+func parseSetupCommands() (setup, teardown *Command, err error) {
+	if setup, err = parseCommand("file.setup", viper.Get("file.setup"), 0); err != nil {
+		return nil, nil, err
+	}
+
+	if teardown, err = parseCommand("file.teardown", viper.Get("file.teardown"), 0); err != nil {
+		return nil, nil, err
+	}
+
+	return setup, teardown, nil
+}
+
+func parseErrorPolicy() (*ErrorPolicy, error) {
+	p, err := NewErrorPolicy(viper.GetString("errors.policy"))
+
+	if err != nil {
+		return nil, err
+	}
 
-		syncBatcherMaxPending := viper.GetInt("sync_batcher.max_pending")
-		if syncBatcherMaxPending == 0 {
-			return fmt.Errorf("no max_pending specified; create 'sync_batcher.max_pending' in config.json")
+	if viper.IsSet("errors.retries") {
+		p.Retries = viper.GetInt("errors.retries")
+	}
+	if viper.IsSet("errors.backoff") {
+		p.Backoff = viper.GetDuration("errors.backoff")
+	}
+	if viper.IsSet("errors.max_backoff") {
+		p.MaxBackoff = viper.GetDuration("errors.max_backoff")
+	}
+	if viper.IsSet("errors.min_ops") {
+		p.MinOps = viper.GetInt64("errors.min_ops")
+	}
+
+	p.MaxErrors = viper.GetInt64("errors.max_errors")
+	p.MaxRate = viper.GetFloat64("errors.max_rate")
+
+	if p.Mode == ErrorThreshold && p.MaxErrors == 0 && p.MaxRate == 0 {
+		return nil, fmt.Errorf("threshold error policy needs 'errors.max_errors' and/or 'errors.max_rate' in config.json")
+	}
+
+	if p.Backoff <= 0 || p.MaxBackoff < p.Backoff {
+		return nil, fmt.Errorf("errors.backoff must be above 0 and no more than errors.max_backoff")
+	}
+
+	return p, nil
+}
+
+func startFileRunners(rl *RunnerList) (err error) {
+	if viper.GetBool("file.manifest") {
+		if global.Manifest, err = NewDurabilityManifest(filepath.Join(global.RunDir, "manifest.txt")); err != nil {
+			return err
 		}
+		Logger().Infof("recording synced objects in durability manifest")
+	}
 
-		global.Syncer = NewSyncBatcher(syncBatcherMaxWait, syncBatcherMaxPending)
-		willSync = true
-	default:
-		global.Syncer = &SyncNone{}
+	var phase *Phase
+	if len(global.Phases) > 0 {
+		phase = global.Phases[0]
+	}
+
+	if err = addFileRunners(rl, phase); err != nil {
+		return err
+	}
+
+	if global.Manifest != nil && len(global.Jobs) == 0 {
+		_ = global.Manifest.Close()
+		global.Manifest = nil
+	} else if global.Manifest != nil && !anyJobSyncs() && len(global.Phases) == 0 {
+		Logger().Warnf("file.manifest has no effect without file.sync; nothing will be recorded")
+	}
+
+	return nil
+}
+
+// addFileRunners creates the jobs for a phase (nil without phases) and adds
+// their runners. Stores already in rl, e.g. from an earlier phase, are
+// reused along with the objects in them.
+func addFileRunners(rl *RunnerList, phase *Phase) (err error) {
+	logger := Logger()
+
+	if global.Jobs, err = newJobs(phase, global.Manifest); err != nil {
+		return err
 	}
 
-	global.SyncWhen = SyncOnClose
-	if willSync {
-		switch viper.GetString("file.sync_on") {
-		case "write", "io":
-			global.SyncWhen = SyncOnWrite
-			logger.Infof("sync after every write")
-		default:
-			logger.Infof("sync on file close")
+	// Jobs on the same path share its store (and fill state), so each
+	// can read what the others wrote.
+	fills := make(map[string]*FillPath)
+	scan := make(map[string]bool)
+
+	for _, job := range global.Jobs {
+		for _, path := range job.Paths {
+			scan[path] = scan[path] || job.ReadPercent > 0 || global.Fill != nil
 		}
 	}
 
-	openFlags := parseOpenFlags(viper.GetStringSlice("file.open_flags"))
+	openFlags, err := parseOpenFlags(viper.GetStringSlice("file.open_flags"))
+	if err != nil {
+		return err
+	}
+
+	for _, job := range global.Jobs {
+		for _, path := range job.Paths {
+			o := rl.Store(path)
 
-	for i, path := range paths {
-		var o ObjectStore
+			if o == nil {
+				logger.Infof("initializing file object store: %s", path)
 
-		logger.Infof("initializing file object store: %s", path)
+				if o, err = NewFileObjectStore(path, openFlags, scan[path]); err != nil {
+					return fmt.Errorf("cannot init store: %s", err)
+				}
+
+				rl.AddStore(path, o)
+			} else if f, ok := o.(*FileObjectStore); ok && scan[path] {
+				// An earlier phase may only have written
+				f.ScanExistingObjects()
+			}
 
-		if o, err = NewFileObjectStore(path, openFlags); err != nil {
-			return fmt.Errorf("cannot init store: %s", err)
+			if global.Fill != nil && fills[path] == nil {
+				fills[path] = global.Fill.AddPath(path)
+			}
+
+			for j := 0; j < job.RunnersPerPath; j++ {
+				var r *Runner
+
+				global.Runners++
+
+				if r, err = NewRunner(job, o, global.Runners); err != nil {
+					return fmt.Errorf("error initializing runner: %s", err)
+				}
+
+				r.fill = fills[path]
+				r.path = path
+				rl.AddRunner(r)
+			}
 		}
+	}
+
+	global.Reporter.SetJobs(global.Jobs)
+	return nil
+}
+
+// newJobs creates the jobs for a phase (nil without phases), or none if
+// there are no file paths to run on.
+func newJobs(phase *Phase, manifest *DurabilityManifest) ([]*Job, error) {
+	configs, err := jobConfigs(phase)
+
+	if err != nil {
+		return nil, err
+	}
 
-		rl.AddStore(o)
+	var jobs []*Job
 
-		for j := 0; j < runnersPerPath; j++ {
-			var r *Runner
+	for i, v := range configs {
+		job, err := newJob(len(jobs), v, manifest)
+
+		if err != nil {
+			return nil, err
+		}
 
-			if r, err = NewRunner(o, (i*runnersPerPath)+j+1); err != nil {
-				return fmt.Errorf("error initializing runner: %s", err)
+		if len(job.Paths) == 0 {
+			if len(configs) > 1 {
+				return nil, fmt.Errorf("job %d (%s) has no file paths", i+1, job.Name)
 			}
+			Logger().Infof("no file runner paths specified; skipping")
+			break
+		}
+
+		jobs = append(jobs, job)
+	}
 
-			rl.AddRunner(r)
+	return jobs, nil
+}
+
+func anyJobSyncs() bool {
+	for _, job := range global.Jobs {
+		if _, ok := job.Syncer.(*SyncNone); !ok {
+			return true
 		}
 	}
+	return false
+}
+
+func startReplayRunners(rl *RunnerList) (err error) {
+	config, err := parseReplayConfig()
+
+	if config == nil || err != nil {
+		return err
+	}
+
+	Logger().Infof("initializing replay object store: %s", config.Path)
+
+	openFlags, err := parseOpenFlags(viper.GetStringSlice("file.open_flags"))
+	if err != nil {
+		return err
+	}
 
+	o, err := NewFileObjectStore(config.Path, openFlags, false)
+	if err != nil {
+		return fmt.Errorf("cannot init store: %s", err)
+	}
+
+	r, err := NewReplayer(o, config)
+	if err != nil {
+		return err
+	}
+
+	rl.AddStore(config.Path, o)
+	rl.AddRunner(r)
 	return nil
 }
 
+// parseReplayConfig returns the trace replay settings, or nil if there's
+// no trace to replay.
+func parseReplayConfig() (*ReplayConfig, error) {
+	trace := viper.GetString("replay.trace")
+
+	if len(trace) == 0 {
+		return nil, nil
+	}
+
+	path := viper.GetString("replay.path")
+
+	if len(path) == 0 {
+		return nil, fmt.Errorf("no path to replay trace against; create 'replay.path' in config.json")
+	}
+
+	config := &ReplayConfig{
+		Trace:   trace,
+		Path:    path,
+		Speed:   viper.GetFloat64("replay.speed"),
+		Workers: viper.GetInt("replay.workers"),
+		Sync:    viper.GetBool("replay.sync"),
+		Prepare: viper.GetBool("replay.prepare"),
+	}
+
+	switch viper.GetString("replay.timing") {
+	case "fast":
+	case "timed", "timestamp", "timestamps":
+		config.Timed = true
+	default:
+		return nil, fmt.Errorf("unknown replay.timing '%s'; use fast or timed", viper.GetString("replay.timing"))
+	}
+
+	return config, nil
+}
+
 var __logger *zap.Logger
 var __logLevel zap.AtomicLevel
 var __loggerOnce sync.Once
+var __consoleMuted int32
+
+// consoleSink is the log's output to stdout, which can be muted while the
+// dashboard has the terminal.
+type consoleSink struct{}
+
+func (consoleSink) Write(p []byte) (int, error) {
+	if atomic.LoadInt32(&__consoleMuted) != 0 {
+		return len(p), nil
+	}
+	return os.Stdout.Write(p)
+}
+
+func (consoleSink) Sync() error  { return nil }
+func (consoleSink) Close() error { return nil }
+
+// muteConsole stops (or restarts) logging to stdout; log.txt still gets
+// everything.
+func muteConsole(mute bool) {
+	if mute {
+		atomic.StoreInt32(&__consoleMuted, 1)
+	} else {
+		atomic.StoreInt32(&__consoleMuted, 0)
+	}
+}
 
 func Logger() *zap.SugaredLogger {
 	__loggerOnce.Do(func() {
@@ -277,16 +822,29 @@ func Logger() *zap.SugaredLogger {
 		__logLevel = zap.NewAtomicLevel()
 		__logLevel.SetLevel(zap.InfoLevel)
 
+		err = zap.RegisterSink("console", func(*url.URL) (zap.Sink, error) {
+			return consoleSink{}, nil
+		})
+		if err != nil {
+			panic(err)
+		}
+
 		// config := zap.NewDevelopmentConfig()
 		// config.Level = __logLevel
-		// config.OutputPaths = []string{"stdout", filepath.Join(global.RunId, "log.txt")}
+		// config.OutputPaths = []string{"stdout", filepath.Join(global.RunDir, "log.txt")}
 		//
 		// __logger, err = config.Build()
 
+		// Commands other than run have no run directory to log to
+		outputPaths := []string{"console:"}
+		if len(global.RunDir) > 0 {
+			outputPaths = append(outputPaths, filepath.Join(global.RunDir, "log.txt"))
+		}
+
 		cfg := zap.Config{
 			Encoding:    "console",
 			Level:       __logLevel,
-			OutputPaths: []string{"stdout", filepath.Join(global.RunId, "log.txt")},
+			OutputPaths: outputPaths,
 			EncoderConfig: zapcore.EncoderConfig{
 				MessageKey: "message",
 
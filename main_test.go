@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+// TestMain points the run directory at a temp dir so anything that logs
+// (and so opens the run's log.txt) works under test.
+func TestMain(m *testing.M) {
+	dir, e := os.MkdirTemp("", "perftest-test-")
+	if e != nil {
+		fmt.Printf("cannot create test run directory: %s\n", e)
+		os.Exit(1)
+	}
+
+	global.RunDir = dir
+	code := m.Run()
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func TestParseSetting(t *testing.T) {
+	key, value, err := parseSetting("file.sync=batch")
+	AbortOnError(t, err)
+	ExpectEqual(t, "file.sync", key)
+	ExpectEqual(t, "batch", value.(string))
+
+	// Everything after the first = is the value
+	key, value, err = parseSetting("reporter.capture.args=a=b")
+	AbortOnError(t, err)
+	ExpectEqual(t, "reporter.capture.args", key)
+	ExpectEqual(t, "a=b", value.(string))
+
+	key, value, err = parseSetting(`file.paths=["/mnt/a","/mnt/b"]`)
+	AbortOnError(t, err)
+	ExpectEqual(t, "file.paths", key)
+	ExpectEqual(t, 2, len(value.([]interface{})))
+	ExpectEqual(t, "/mnt/b", value.([]interface{})[1].(string))
+
+	_, value, err = parseSetting("size=")
+	AbortOnError(t, err)
+	ExpectEqual(t, "", value.(string))
+
+	for _, setting := range []string{"file.sync", "=batch", `file.paths=["/mnt/a"`} {
+		_, _, err = parseSetting(setting)
+		ExpectErrorf(t, err, "setting %s", setting)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+// DurabilityManifest is an append-only record of objects the Syncer has
+// acknowledged as durable. Each entry is written and fsynced before the
+// runner that wrote the object is told its sync succeeded, so after a
+// crash every object in the manifest should be on disk with at least the
+// listed size. Each object's directory is fsynced before its entry is
+// written, so that its name is as durable as its data. The format is the
+// same list "perftest verify --expect" reads: one absolute path and size
+// per line.
+type DurabilityManifest struct {
+	lock sync.Mutex
+	file *os.File
+	buf  []byte
+}
+
+func NewDurabilityManifest(path string) (*DurabilityManifest, error) {
+	f, e := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0664)
+
+	if e != nil {
+		return nil, fmt.Errorf("failed creating durability manifest: %s", e)
+	}
+
+	m := &DurabilityManifest{file: f}
+
+	if _, e = fmt.Fprintf(f, "# %s %s\n", "Path", "Size(bytes)"); e == nil {
+		e = f.Sync()
+	}
+
+	if e == nil {
+		e = syncDir(filepath.Dir(path))
+	}
+
+	if e != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("failed writing to durability manifest: %s", e)
+	}
+
+	return m, nil
+}
+
+// Append records objects as durable. It returns once the entries
+// themselves are durable.
+func (m *DurabilityManifest) Append(writers ...ObjectWriter) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.buf = m.buf[:0]
+	dirs := make(map[string]bool)
+
+	for _, w := range writers {
+		path, e := filepath.Abs(w.Name())
+		if e != nil {
+			return fmt.Errorf("manifest: %s", e)
+		}
+
+		if dir := filepath.Dir(path); !dirs[dir] {
+			if e = syncDir(dir); e != nil {
+				return fmt.Errorf("manifest: cannot sync directory: %w", e)
+			}
+			dirs[dir] = true
+		}
+
+		m.buf = append(m.buf, path...)
+		m.buf = append(m.buf, ' ')
+		m.buf = strconv.AppendInt(m.buf, w.Size(), 10)
+		m.buf = append(m.buf, '\n')
+	}
+
+	if _, e := m.file.Write(m.buf); e != nil {
+		return fmt.Errorf("manifest write: %w", e)
+	}
+
+	if e := m.file.Sync(); e != nil {
+		return fmt.Errorf("manifest sync: %w", e)
+	}
+
+	return nil
+}
+
+// Close closes the manifest, once the syncers using it have stopped. Only
+// the first call does anything.
+func (m *DurabilityManifest) Close() error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.file == nil {
+		return nil
+	}
+
+	e := m.file.Close()
+	m.file = nil
+	return e
+}
+
+// syncDir fsyncs a directory, so the names of files just created in it
+// survive a crash.
+func syncDir(dir string) error {
+	d, e := os.Open(dir)
+	if e != nil {
+		return e
+	}
+
+	e = d.Sync()
+
+	if ce := d.Close(); e == nil {
+		e = ce
+	}
+
+	return e
+}
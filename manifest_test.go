@@ -0,0 +1,66 @@
+package main
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDurabilityManifest(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "manifest.txt")
+	store := &FileObjectStore{root: filepath.Join(dir, "store"), index: make(map[string]int)}
+	AbortOnError(t, os.MkdirAll(store.root, 0755))
+	rng := rand.New(rand.NewSource(1))
+
+	write := func(name string, size int) ObjectWriter {
+		w, err := store.GetWriter(name, rng)
+		AbortOnError(t, err)
+		_, err = w.Write(make([]byte, size))
+		AbortOnError(t, err)
+		AbortOnError(t, w.Sync())
+		return w
+	}
+
+	m, err := NewDurabilityManifest(path)
+	AbortOnError(t, err)
+
+	a := write("a.dat", 100)
+	AbortOnError(t, m.Append(a))
+	b, c := write("b.dat", 200), write("c.dat", 300)
+	AbortOnError(t, m.Append(b, c))
+	_, err = a.Write(make([]byte, 50)) // synced again, after growing
+	AbortOnError(t, err)
+	AbortOnError(t, m.Append(a))
+
+	AbortOnError(t, m.Close())
+	AbortOnError(t, m.Close())
+
+	// Reopening appends
+	m, err = NewDurabilityManifest(path)
+	AbortOnError(t, err)
+	AbortOnError(t, m.Append(write("d.dat", 400)))
+	AbortOnError(t, m.Close())
+
+	out, err := os.ReadFile(path)
+	AbortOnError(t, err)
+	lines := strings.Split(strings.TrimSuffix(string(out), "\n"), "\n")
+
+	ExpectEqual(t, 7, len(lines))
+	ExpectEqual(t, "# Path Size(bytes)", lines[0])
+	ExpectEqual(t, filepath.Join(store.root, "a.dat")+" 100", lines[1])
+	ExpectEqual(t, filepath.Join(store.root, "c.dat")+" 300", lines[3])
+	ExpectEqual(t, filepath.Join(store.root, "a.dat")+" 150", lines[4])
+	ExpectEqual(t, "# Path Size(bytes)", lines[5])
+	ExpectEqual(t, filepath.Join(store.root, "d.dat")+" 400", lines[6])
+
+	objects, err := readObjectList(path)
+	AbortOnError(t, err)
+	ExpectEqual(t, 4, len(objects))
+	ExpectEqual(t, int64(150), objects[filepath.Join(store.root, "a.dat")])
+
+	_, err = NewDurabilityManifest(filepath.Join(dir, "missing", "manifest.txt"))
+	ExpectError(t, err)
+}
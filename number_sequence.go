@@ -1,5 +1,11 @@
 package main
 
+import "math/rand"
+
+// defaultSeed is the generators' historical starting point, a couple of
+// rounds into the sequence.
+const defaultSeed = 0x490c734ad1ccf6e9
+
 // NumberSequence is a generator of not-crypto-strong random numbers.
 type NumberSequence struct {
 	next int64
@@ -8,8 +14,7 @@ type NumberSequence struct {
 // Create new number sequence.
 func NewNumberSequence() *NumberSequence {
 	return &NumberSequence{
-		// Initialize with a couple rounds of the generator
-		next: 0x490c734ad1ccf6e9,
+		next: defaultSeed,
 	}
 }
 
@@ -27,3 +32,41 @@ func (seq *NumberSequence) Next() int64 {
 func (seq *NumberSequence) Set(seed int64) {
 	seq.next = seed
 }
+
+// mixSeed derives an independent seed for stream n from a base seed,
+// using the SplitMix64 finalizer so that nearby inputs (runner 1, runner
+// 2, ...) give unrelated outputs.
+func mixSeed(seed uint64, n uint64) uint64 {
+	z := seed + (n+1)*0x9e3779b97f4a7c15
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+// Each runner draws from several independent random streams, all derived
+// from the run seed, so that a change in one (e.g. how many objects a read
+// finds) can't shift the others.
+const (
+	seedStreamData      = iota // object contents
+	seedStreamSize             // object size selection
+	seedStreamOps              // op mix
+	seedStreamPlacement        // subdirectory for new objects
+	seedStreamPick             // which existing object to read or delete
+)
+
+// seedStreamDedupe derives the dedupe pool seed from the run seed. The pool
+// is shared by all runners, so this isn't per-runner like the streams
+// above; it's just kept well away from runner ids.
+const seedStreamDedupe = 1 << 32
+
+// streamSeed derives the seed for one of runner id's random streams.
+func streamSeed(seed uint64, id int, stream int) uint64 {
+	return mixSeed(mixSeed(seed, uint64(id)), uint64(stream))
+}
+
+// newStreamRand returns a math/rand generator for one of runner id's
+// random streams. Like all math/rand generators other than the global one,
+// it is not safe for concurrent use.
+func newStreamRand(seed uint64, id int, stream int) *rand.Rand {
+	return rand.New(rand.NewSource(int64(streamSeed(seed, id, stream))))
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+)
+
+const (
+	objectMagic      = "PERFTEST"
+	ObjectHeaderSize = 64
+	generatorVersion = 1 // bump whenever generated contents change for the same header
+)
+
+// ObjectHeader is written at the start of every object large enough to
+// hold it. It records everything needed to regenerate the object's
+// contents, so data read back can be checked without keeping a copy.
+//
+// Layout (little endian):
+//
+//	 0  magic "PERFTEST"
+//	 8  generator version (uint32)
+//	12  compressibility (uint32)
+//	16  data seed (uint64)
+//	24  object size (uint64)
+//	32  dedupe percent (uint8)
+//	33  compress mode (uint8)
+//	34  data pattern (uint8)
+//	35  reserved, zero
+//	36  dedupe block size (uint32)
+//	40  dedupe pool seed (uint64)
+//	48  dedupe pool blocks (uint32)
+//	52  pattern source id (uint32)
+//	56  CRC-32 of bytes 0-55 (uint32)
+//	60  reserved, zero
+//
+// Fields added since version 1 are zero in older headers, which gives the
+// same contents as before (e.g. no dedupe).
+type ObjectHeader struct {
+	Version         uint32
+	Compressibility uint32
+	Seed            uint64
+	Size            uint64
+	DedupePercent   uint8
+	CompressMode    uint8
+	Pattern         uint8
+	DedupeBlockSize uint32
+	DedupeSeed      uint64
+	DedupePool      uint32
+	PatternSource   uint32 // checksum of the repeat pattern or corpus
+}
+
+// Marshal writes the header into the first ObjectHeaderSize bytes of buf.
+func (h *ObjectHeader) Marshal(buf []byte) {
+	hdr := buf[:ObjectHeaderSize]
+
+	for i := range hdr {
+		hdr[i] = 0
+	}
+
+	copy(hdr, objectMagic)
+	binary.LittleEndian.PutUint32(hdr[8:], h.Version)
+	binary.LittleEndian.PutUint32(hdr[12:], h.Compressibility)
+	binary.LittleEndian.PutUint64(hdr[16:], h.Seed)
+	binary.LittleEndian.PutUint64(hdr[24:], h.Size)
+	hdr[32] = h.DedupePercent
+	hdr[33] = h.CompressMode
+	hdr[34] = h.Pattern
+	binary.LittleEndian.PutUint32(hdr[36:], h.DedupeBlockSize)
+	binary.LittleEndian.PutUint64(hdr[40:], h.DedupeSeed)
+	binary.LittleEndian.PutUint32(hdr[48:], h.DedupePool)
+	binary.LittleEndian.PutUint32(hdr[52:], h.PatternSource)
+	binary.LittleEndian.PutUint32(hdr[56:], crc32.ChecksumIEEE(hdr[:56]))
+}
+
+// errNoHeader means the data doesn't start with an object header at all
+// (as opposed to a damaged one), e.g. it was written by an older perftest
+// or is too small to hold one.
+var errNoHeader = fmt.Errorf("no object header")
+
+// ParseObjectHeader reads a header from the start of buf.
+func ParseObjectHeader(buf []byte) (*ObjectHeader, error) {
+	if len(buf) < ObjectHeaderSize || string(buf[:len(objectMagic)]) != objectMagic {
+		return nil, errNoHeader
+	}
+
+	hdr := buf[:ObjectHeaderSize]
+
+	if crc32.ChecksumIEEE(hdr[:56]) != binary.LittleEndian.Uint32(hdr[56:]) {
+		return nil, fmt.Errorf("object header checksum mismatch")
+	}
+
+	h := &ObjectHeader{
+		Version:         binary.LittleEndian.Uint32(hdr[8:]),
+		Compressibility: binary.LittleEndian.Uint32(hdr[12:]),
+		Seed:            binary.LittleEndian.Uint64(hdr[16:]),
+		Size:            binary.LittleEndian.Uint64(hdr[24:]),
+		DedupePercent:   hdr[32],
+		CompressMode:    hdr[33],
+		Pattern:         hdr[34],
+		DedupeBlockSize: binary.LittleEndian.Uint32(hdr[36:]),
+		DedupeSeed:      binary.LittleEndian.Uint64(hdr[40:]),
+		DedupePool:      binary.LittleEndian.Uint32(hdr[48:]),
+		PatternSource:   binary.LittleEndian.Uint32(hdr[52:]),
+	}
+
+	if h.Version != generatorVersion {
+		return nil, fmt.Errorf("unsupported generator version %d (expected %d)", h.Version, generatorVersion)
+	}
+
+	if h.Size < ObjectHeaderSize {
+		return nil, fmt.Errorf("object header has impossible size %d", h.Size)
+	}
+
+	if h.Compressibility > 100 || CompressMode(h.CompressMode) >= compressModeCount {
+		return nil, fmt.Errorf("object header has invalid compressibility settings")
+	}
+
+	if DataPattern(h.Pattern) >= patternCount {
+		return nil, fmt.Errorf("object header has unknown data pattern %d", h.Pattern)
+	}
+
+	if h.DedupePercent > 100 || (h.DedupePercent > 0 && (h.DedupeBlockSize == 0 || h.DedupePool == 0)) {
+		return nil, fmt.Errorf("object header has invalid dedupe settings")
+	}
+
+	return h, nil
+}
+
+// fillObject generates the contents of an object described by h into buf,
+// which must be h.Size bytes. If h calls for dedupe, pool must match it, and
+// if its pattern needs a source, the source must be registered.
+// Objects too small for a header are filled with data only and can't be
+// verified later.
+func fillObject(h *ObjectHeader, buf []byte, seq *ByteSequence, pool *dedupePool) {
+	seq.Seed(h.Seed)
+
+	if len(buf) < ObjectHeaderSize {
+		fillData(h, buf, seq)
+		return
+	}
+
+	fillData(h, buf[ObjectHeaderSize:], seq)
+
+	if h.DedupePercent > 0 {
+		pool.dedupeFill(buf, int(h.DedupePercent), h.Seed)
+	}
+
+	h.Marshal(buf)
+}
+
+// fillData fills buf with data (no header) as described by h, continuing
+// from seq's current state.
+func fillData(h *ObjectHeader, buf []byte, seq *ByteSequence) {
+	switch DataPattern(h.Pattern) {
+	case PatternZeros:
+		seq.ZeroFill(buf)
+	case PatternText:
+		seq.TextFill(buf)
+	case PatternRepeat:
+		seq.RepeatFill(buf, lookupPatternSource(h.PatternSource))
+	case PatternCorpus:
+		seq.CorpusFill(buf, lookupPatternSource(h.PatternSource))
+	default:
+		seq.CompressFill(buf, int(h.Compressibility), CompressMode(h.CompressMode))
+	}
+}
@@ -1,17 +1,26 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"github.com/oklog/ulid/v2"
+	"io"
 	"math/rand"
 	"os"
 	"path/filepath"
+	"sync"
 )
 
+// errNoObjects is returned when a store has no objects to read or delete.
+var errNoObjects = errors.New("no objects available")
+
 type ObjectWriter interface {
 	Write(p []byte) (n int, err error)
 	Close() error
 	Sync() error
+	Name() string   // path of the object
+	Object() string // name relative to the store, as used with GetReader
+	Size() int64    // bytes written so far
 }
 
 type ObjectReader interface {
@@ -19,20 +28,92 @@ type ObjectReader interface {
 	Close() error
 }
 
+// ObjectFile gives random access to an object, for replaying traces.
+type ObjectFile interface {
+	io.ReaderAt
+	io.WriterAt
+	Sync() error
+	Close() error
+}
+
+// ObjectStore is shared by many runners. Methods that make a random choice
+// take the calling runner's generator so the choice is reproducible.
 type ObjectStore interface {
-	GetWriter(name string) (ObjectWriter, error)
+	GetWriter(name string, rng *rand.Rand) (ObjectWriter, error)
 	GetReader(name string) (ObjectReader, error)
-	RandomExistingObjectName() (string, error)
+	RandomExistingObjectName(rng *rand.Rand) (string, error)
+	DeleteRandomObject(rng *rand.Rand) (string, error)
+
+	// OpenObject opens a named object, creating it (and any directories
+	// in its name) if create is set. Names are relative to the store and
+	// can't refer to anything outside it.
+	OpenObject(name string, create bool) (ObjectFile, error)
+	DeleteObject(name string) error
+
+	// Scanned returns whether an object was already in the store, rather
+	// than written by this run.
+	Scanned(name string) bool
 }
 
 type FileObjectStore struct {
 	root      string
 	openFlags int
 	subdirs   []string
-	objects   []string
+	lock      sync.Mutex
+	objects   []string       // names relative to root, usable with GetReader
+	index     map[string]int // name -> position in objects
+	scanned   bool
+	found     map[string]bool // objects found by the scan, not yet deleted
+}
+
+// fileObjectWriter adds its object to the store's list of existing objects
+// once it has been completely written and closed, or removes it if a
+// write failed (e.g. with ENOSPC).
+type fileObjectWriter struct {
+	*os.File
+	store  *FileObjectStore
+	name   string // relative to store root
+	size   int64
+	failed bool // a write failed; remove the object on close
+}
+
+func (w *fileObjectWriter) Write(p []byte) (int, error) {
+	n, e := w.File.Write(p)
+	w.size += int64(n)
+	if e != nil {
+		w.failed = true
+	}
+	return n, e
+}
+
+func (w *fileObjectWriter) Size() int64 {
+	return w.size
+}
+
+func (w *fileObjectWriter) Object() string {
+	return w.name
+}
+
+func (w *fileObjectWriter) Close() error {
+	e := w.File.Close()
+
+	if w.failed {
+		// Don't leave a partial object for a later run's scan to find
+		if re := os.Remove(w.File.Name()); re != nil && e == nil && !os.IsNotExist(re) {
+			e = re
+		}
+		return e
+	}
+
+	if e == nil {
+		w.store.addObject(w.name)
+	}
+	return e
 }
 
-func NewFileObjectStore(root string, openFlags int) (ObjectStore, error) {
+// NewFileObjectStore creates a store under root. If scan is set, objects
+// already there are available to read (or delete).
+func NewFileObjectStore(root string, openFlags int, scan bool) (ObjectStore, error) {
 	var e error
 
 	if e = os.MkdirAll(root, 0755); e != nil {
@@ -54,30 +135,31 @@ func NewFileObjectStore(root string, openFlags int) (ObjectStore, error) {
 	}
 
 	f := &FileObjectStore{
-		root,
-		openFlags,
-		subdirs,
-		make([]string, 0),
+		root:      root,
+		openFlags: openFlags,
+		subdirs:   subdirs,
+		objects:   make([]string, 0),
+		index:     make(map[string]int),
 	}
 
-	if global.ReadPercent > 0 {
+	if scan {
 		f.ScanExistingObjects()
 	}
 
 	return f, nil
 }
 
-func (f *FileObjectStore) GetWriter(name string) (bw ObjectWriter, e error) {
-	var path string
+func (f *FileObjectStore) GetWriter(name string, rng *rand.Rand) (bw ObjectWriter, e error) {
+	if len(f.subdirs) > 0 {
+		name = filepath.Join(f.subdirs[rng.Intn(len(f.subdirs))], name)
+	}
 
-	if len(f.subdirs) == 0 {
-		path = filepath.Join(f.root, name)
-	} else {
-		path = filepath.Join(f.root, f.subdirs[rand.Intn(len(f.subdirs))], name)
+	file, e := os.OpenFile(filepath.Join(f.root, name), os.O_WRONLY|os.O_CREATE|f.openFlags, 0775)
+	if e != nil {
+		return nil, e
 	}
 
-	bw, e = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|f.openFlags, 0775)
-	return
+	return &fileObjectWriter{File: file, store: f, name: name}, nil
 }
 
 func (f *FileObjectStore) GetReader(name string) (br ObjectReader, e error) {
@@ -85,33 +167,126 @@ func (f *FileObjectStore) GetReader(name string) (br ObjectReader, e error) {
 	return
 }
 
-func (f *FileObjectStore) RandomExistingObjectName() (name string, e error) {
+func (f *FileObjectStore) RandomExistingObjectName(rng *rand.Rand) (name string, e error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
 	if len(f.objects) == 0 {
-		e = fmt.Errorf("no objects available")
+		e = errNoObjects
 		return
 	}
 
-	name = f.objects[rand.Intn(len(f.objects))]
+	name = f.objects[rng.Intn(len(f.objects))]
 	return
 }
 
-func (f *FileObjectStore) ScanExistingObjects() {
-	err := filepath.Walk(f.root, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
+// DeleteRandomObject removes a randomly chosen existing object. The object
+// is taken off the list before it is removed, so concurrent runners never
+// try to delete the same one.
+func (f *FileObjectStore) DeleteRandomObject(rng *rand.Rand) (name string, e error) {
+	f.lock.Lock()
+
+	if len(f.objects) == 0 {
+		f.lock.Unlock()
+		e = errNoObjects
+		return
+	}
+
+	name = f.objects[rng.Intn(len(f.objects))]
+	f.removeObjectLocked(name)
+	f.lock.Unlock()
+
+	e = os.Remove(filepath.Join(f.root, name))
+	return
+}
+
+// objectPath maps a name onto a path within the store. Leading slashes and
+// ".." can't escape the root.
+func (f *FileObjectStore) objectPath(name string) string {
+	return filepath.Join(f.root, filepath.Clean("/"+name))
+}
+
+func (f *FileObjectStore) OpenObject(name string, create bool) (ObjectFile, error) {
+	path := f.objectPath(name)
+	flags := os.O_RDWR | f.openFlags
+
+	if create {
+		if e := os.MkdirAll(filepath.Dir(path), 0755); e != nil {
+			return nil, e
 		}
+		flags |= os.O_CREATE
+	}
+
+	return os.OpenFile(path, flags, 0664)
+}
+
+func (f *FileObjectStore) DeleteObject(name string) error {
+	path := f.objectPath(name)
+
+	if rel, e := filepath.Rel(f.root, path); e == nil {
+		f.lock.Lock()
+		f.removeObjectLocked(rel)
+		f.lock.Unlock()
+	}
+
+	return os.Remove(path)
+}
+
+func (f *FileObjectStore) addObject(name string) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if _, ok := f.index[name]; ok {
+		return
+	}
+
+	f.index[name] = len(f.objects)
+	f.objects = append(f.objects, name)
+}
+
+// removeObjectLocked swaps the last object into the removed one's slot.
+// Caller must hold f.lock.
+func (f *FileObjectStore) removeObjectLocked(name string) {
+	i, ok := f.index[name]
+	if !ok {
+		return
+	}
+
+	last := len(f.objects) - 1
+	f.objects[i] = f.objects[last]
+	f.index[f.objects[i]] = i
+	f.objects = f.objects[:last]
+	delete(f.index, name)
+	delete(f.found, name)
+}
+
+// ScanExistingObjects makes objects already in the store available, if
+// that hasn't been done already.
+func (f *FileObjectStore) ScanExistingObjects() {
+	f.lock.Lock()
+	scanned := f.scanned
+	f.scanned = true
+	f.lock.Unlock()
 
-		if !info.IsDir() && info.Size() > 0 {
-			if isValidULIDWithExtension(filepath.Base(path)) {
-				relPath, err := filepath.Rel(f.root, path)
-				if err != nil {
-					panic(err)
-				}
-				f.objects = append(f.objects, relPath)
+	if scanned {
+		return
+	}
+
+	err := walkObjects(f.root, func(path string, info os.FileInfo) {
+		if info.Size() > 0 {
+			relPath, err := filepath.Rel(f.root, path)
+			if err != nil {
+				panic(err)
 			}
-		}
+			f.addObject(relPath)
 
-		return nil
+			f.lock.Lock()
+			if f.found == nil {
+				f.found = make(map[string]bool)
+			}
+			f.found[relPath] = true
+			f.lock.Unlock()
+		}
 	})
 
 	if err != nil {
@@ -119,6 +294,29 @@ func (f *FileObjectStore) ScanExistingObjects() {
 	}
 }
 
+func (f *FileObjectStore) Scanned(name string) bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	return f.found[name]
+}
+
+// walkObjects calls fn for every file under root that's named like an
+// object (a ULID plus extension).
+func walkObjects(root string, fn func(path string, info os.FileInfo)) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() && isValidULIDWithExtension(filepath.Base(path)) {
+			fn(path, info)
+		}
+
+		return nil
+	})
+}
+
 func isValidULIDWithExtension(name string) bool {
 	ext := filepath.Ext(name)
 	base := name[:len(name)-len(ext)]
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// checkIndex checks that the store's index and object list agree.
+func checkIndex(t *testing.T, f *FileObjectStore, expected ...string) {
+	t.Helper()
+
+	ExpectEqual(t, len(expected), len(f.objects))
+	ExpectEqual(t, len(expected), len(f.index))
+
+	for i, name := range f.objects {
+		if f.index[name] != i {
+			t.Errorf("index of %s is %d, but it's in slot %d", name, f.index[name], i)
+		}
+	}
+
+	for _, name := range expected {
+		if _, ok := f.index[name]; !ok {
+			t.Errorf("%s is missing from the index", name)
+		}
+	}
+}
+
+func TestFileObjectStore_RemoveObject(t *testing.T) {
+	f := &FileObjectStore{root: t.TempDir(), index: make(map[string]int)}
+
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		f.addObject(name)
+	}
+	f.addObject("c") // already there
+	checkIndex(t, f, "a", "b", "c", "d", "e")
+
+	// From the middle: the last object takes its slot
+	f.removeObjectLocked("b")
+	checkIndex(t, f, "a", "c", "d", "e")
+	ExpectEqual(t, "e", f.objects[1])
+
+	// The last object
+	f.removeObjectLocked("d")
+	checkIndex(t, f, "a", "e", "c")
+	ExpectEqual(t, "c", f.objects[2])
+
+	f.removeObjectLocked("d") // already gone
+	f.removeObjectLocked("a")
+	f.removeObjectLocked("c")
+	checkIndex(t, f, "e")
+	f.removeObjectLocked("e")
+	checkIndex(t, f)
+
+	f.addObject("f")
+	checkIndex(t, f, "f")
+}
+
+func TestFileObjectStore_DeleteRandomObject(t *testing.T) {
+	root := t.TempDir()
+	f := &FileObjectStore{root: root, index: make(map[string]int)}
+	rng := rand.New(rand.NewSource(1))
+
+	_, err := f.DeleteRandomObject(rng)
+	ExpectEqual(t, true, errors.Is(err, errNoObjects))
+
+	for _, name := range []string{"a", "b", "c"} {
+		AbortOnError(t, os.WriteFile(filepath.Join(root, name), []byte(name), 0644))
+		f.addObject(name)
+	}
+
+	deleted := map[string]bool{}
+
+	for i := 0; i < 3; i++ {
+		name, err := f.DeleteRandomObject(rng)
+		AbortOnError(t, err)
+		ExpectEqual(t, false, deleted[name])
+		deleted[name] = true
+
+		if _, err = os.Stat(filepath.Join(root, name)); !os.IsNotExist(err) {
+			t.Errorf("%s wasn't removed: %v", name, err)
+		}
+	}
+
+	checkIndex(t, f)
+
+	_, err = f.DeleteRandomObject(rng)
+	ExpectEqual(t, true, errors.Is(err, errNoObjects))
+}
+
+func TestFileObjectStore_FailedWrite(t *testing.T) {
+	root := t.TempDir()
+	f := &FileObjectStore{root: root, index: make(map[string]int)}
+	rng := rand.New(rand.NewSource(1))
+
+	w, err := f.GetWriter("a.dat", rng)
+	AbortOnError(t, err)
+	_, err = w.Write(make([]byte, 100))
+	AbortOnError(t, err)
+	AbortOnError(t, w.Close())
+	checkIndex(t, f, "a.dat")
+
+	// As if the disk filled up partway through
+	w, err = f.GetWriter("b.dat", rng)
+	AbortOnError(t, err)
+	_, err = w.Write(make([]byte, 100))
+	AbortOnError(t, err)
+	w.(*fileObjectWriter).failed = true
+	AbortOnError(t, w.Close())
+
+	checkIndex(t, f, "a.dat")
+	if _, err = os.Stat(filepath.Join(root, "b.dat")); !os.IsNotExist(err) {
+		t.Errorf("partial object wasn't removed: %v", err)
+	}
+}
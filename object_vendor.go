@@ -2,9 +2,10 @@ package main
 
 import (
 	"fmt"
+	"math"
 	"math/rand"
+	"sort"
 	"strconv"
-	"strings"
 	"sync"
 
 	"github.com/oklog/ulid/v2"
@@ -14,86 +15,252 @@ import (
 type Object struct {
 	Id        ulid.ULID
 	Extension string // file extension
-	dataBuf   []byte // full-size buffer
+	dataBuf   []byte // grows to the largest size drawn for this object
 	Data      []byte // slice of dataBuf to use (may be smaller)
 }
 
+// DataConfig controls the contents of generated objects.
+type DataConfig struct {
+	Compressibility int // percent, 0 (incompressible) to 100
+	CompressMode    CompressMode
+	Pattern         DataPattern // default; the size spec can choose per size
+	Repeat          string      // pattern for PatternRepeat
+	Corpus          string      // file to sample for PatternCorpus
+	DedupePercent   int         // percent of blocks copied from the dedupe pool
+	DedupeBlockSize int         // size of blocks for dedupe
+	DedupePool      int         // number of distinct blocks in the dedupe pool
+}
+
+// SizeEntry is one split of a size spec.
+type SizeEntry struct {
+	Dist       SizeDist
+	Weight     float64 // percent of objects
+	Extension  string
+	Pattern    DataPattern
+	HasPattern bool // false to use the default pattern
+}
+
 type ObjectVendorConfig struct {
-	Compressibility int
-	Sizes           []int
-	MaxSize         int
-	Extensions      map[int]string // map size -> file extension for size
+	DataConfig
+	Entries    []SizeEntry
+	Cumulative []float64 // running total of entry weights, for picking one
+	MaxSize    int
 }
 
 type ObjectVendor struct {
 	*zap.SugaredLogger
-	config *ObjectVendorConfig
-	pool   sync.Pool
+	config  *ObjectVendorConfig
+	pool    sync.Pool
+	seed    uint64                      // run seed, from which each generator's seed is derived
+	sources map[DataPattern]uint32      // pattern source ids for repeat and corpus
+	dedupe  map[DataPattern]*dedupePool // one per pattern in use; nil unless dedupe is enabled
+}
+
+// ObjectGenerator fills objects for a single runner. Each runner gets its
+// own so that data generation needs no locking; a generator must not be
+// shared between goroutines.
+type ObjectGenerator struct {
+	vendor *ObjectVendor
 	seq    *ByteSequence
+	seeds  *rand.Rand // per-object data seeds
+	sizes  *rand.Rand
 }
 
 // Size spec follows fio 'bsplit' format:
 // "blocksize/percentage:blocksize/percentage:..." For example
 // "4K/10:8K/90" means 4K blocks 10 percent of the time and 8K blocks
-// 90 percent of the time. The percentages must sum to 100.
+// 90 percent of the time. The percentages must sum to 100, but needn't be
+// whole numbers. Each split may also give a file extension and data
+// pattern, e.g. "8K/90/xml/text". Instead of a single size, a split may
+// give a range or a named distribution (see parseSizeDist).
 //
 // Compressibility should be 0 for incompressible, 100 for totally
-// compressible data, or any percentage between.
-func NewObjectVendor(sizespec string, compressibility int) (*ObjectVendor, error) {
+// compressible data, or any percentage between. With dedupe, roughly
+// DedupePercent of each object's blocks are copied from a pool of
+// DedupePool distinct blocks shared by all objects.
+//
+// All object sizes and contents are derived from seed, so the same seed
+// gives each runner the same sequence of objects.
+func NewObjectVendor(sizespec string, data DataConfig, seed uint64) (*ObjectVendor, error) {
 	config, err := parseSizeSpec(sizespec)
 
 	if err != nil {
 		return nil, err
 	}
 
-	config.Compressibility = compressibility
+	if data.Compressibility < 0 || data.Compressibility > 100 {
+		return nil, fmt.Errorf("compressibility must be between 0 and 100")
+	}
+
+	if data.DedupePercent < 0 || data.DedupePercent > 100 {
+		return nil, fmt.Errorf("dedupe percent must be between 0 and 100")
+	}
+
+	if data.DedupePercent > 0 && (data.DedupeBlockSize <= 0 || data.DedupePool <= 0) {
+		return nil, fmt.Errorf("dedupe needs a block size and pool size above 0")
+	}
+
+	config.DataConfig = data
 
 	b := &ObjectVendor{
 		SugaredLogger: Logger(),
 		config:        config,
 		pool: sync.Pool{
 			New: func() interface{} {
-				return &Object{
-					Id:      ulid.Make(),
-					dataBuf: make([]byte, config.MaxSize),
-				}
+				return &Object{Id: ulid.Make()}
 			},
 		},
-		seq: NewByteSequence(0),
+		seed:    seed,
+		sources: make(map[DataPattern]uint32),
+	}
+
+	patterns := make(map[DataPattern]bool)
+
+	for i := range config.Entries {
+		e := &config.Entries[i]
+		if !e.HasPattern {
+			e.Pattern = data.Pattern
+		}
+		patterns[e.Pattern] = true
+	}
+
+	if patterns[PatternRepeat] {
+		if len(data.Repeat) == 0 {
+			return nil, fmt.Errorf("repeat pattern needs a string to repeat")
+		}
+		b.sources[PatternRepeat] = registerPatternSource([]byte(data.Repeat))
+	}
+
+	if patterns[PatternCorpus] {
+		if len(data.Corpus) == 0 {
+			return nil, fmt.Errorf("corpus pattern needs a corpus file")
+		}
+		if b.sources[PatternCorpus], err = loadCorpus(data.Corpus); err != nil {
+			return nil, err
+		}
 	}
 
 	b.Infof("object size spec: %s", sizespec)
-	b.Infof("compressibility: %d", compressibility)
+
+	for _, e := range config.Entries {
+		b.Infof("  %.4g%%: %s, .%s, %s data", e.Weight, e.Dist, e.Extension, e.Pattern)
+
+		if r, ok := e.Dist.(interface{ Report() []string }); ok {
+			for _, line := range r.Report() {
+				b.Infof("    %s", line)
+			}
+		}
+	}
+
+	b.Infof("data pattern: %s", data.Pattern)
+	b.Infof("compressibility: %d (%s)", data.Compressibility, data.CompressMode)
+
+	if data.DedupePercent > 0 {
+		b.dedupe = make(map[DataPattern]*dedupePool)
+		poolBytes := 0
+
+		for p := range patterns {
+			b.dedupe[p] = newDedupePool(b.newHeader(0, 0, p))
+			poolBytes += len(b.dedupe[p].data)
+		}
+
+		b.Infof("dedupe: %d%% of %s blocks from a pool of %d (%s)", data.DedupePercent,
+			SprintSize(int64(data.DedupeBlockSize)), data.DedupePool, SprintSize(int64(poolBytes)))
+	}
 
 	return b, nil
 }
 
-func (b *ObjectVendor) GetObject() *Object {
+// NewGenerator creates the generator for runner id. Its seeds are derived
+// from the run seed and id, so every runner produces a distinct sequence.
+func (b *ObjectVendor) NewGenerator(id int) *ObjectGenerator {
+	return &ObjectGenerator{
+		vendor: b,
+		seq:    NewByteSequence(0),
+		seeds:  newStreamRand(b.seed, id, seedStreamData),
+		sizes:  newStreamRand(b.seed, id, seedStreamSize),
+	}
+}
+
+func (g *ObjectGenerator) GetObject() *Object {
+	b := g.vendor
 	blk := b.pool.Get().(*Object)
 	blk.Id = ulid.Make() // Need to assign new one every time to prevent recycling
 
-	// slice block down to size
-	size := b.config.Sizes[rand.Int31n(100)]
+	// Buffers are only as big as the objects drawn, rather than the
+	// largest possible, which may be far out in a long tail
+	entry := b.config.pick(g.sizes)
+	size := entry.Dist.Sample(g.sizes)
+	if cap(blk.dataBuf) < size {
+		blk.dataBuf = make([]byte, size)
+	}
 	blk.Data = blk.dataBuf[:size]
-	blk.Extension = b.config.Extensions[size]
+	blk.Extension = entry.Extension
 
-	b.seq.PatternFill(blk.Data, b.config.Compressibility)
+	fillObject(b.newHeader(g.seeds.Uint64(), size, entry.Pattern), blk.Data, g.seq, b.dedupe[entry.Pattern])
 	return blk
 }
 
+// FillData fills buf with data of the vendor's default pattern and
+// compressibility, for writes that aren't whole objects (e.g. when
+// replaying a trace). There's no header, so it can't be verified.
+func (g *ObjectGenerator) FillData(buf []byte) {
+	b := g.vendor
+	h := b.newHeader(g.seeds.Uint64(), len(buf), b.config.Pattern)
+	g.seq.Seed(h.Seed)
+	fillData(h, buf, g.seq)
+}
+
+// pick chooses a size spec entry according to the weights.
+func (c *ObjectVendorConfig) pick(rng *rand.Rand) *SizeEntry {
+	if len(c.Entries) == 1 {
+		return &c.Entries[0]
+	}
+
+	r := rng.Float64() * c.Cumulative[len(c.Cumulative)-1]
+	i := sort.Search(len(c.Cumulative), func(i int) bool { return c.Cumulative[i] > r })
+
+	if i == len(c.Entries) {
+		i-- // only if rounding puts r at the very top
+	}
+
+	return &c.Entries[i]
+}
+
+// newHeader describes an object of the given size, data seed and pattern,
+// generated with the vendor's data settings.
+func (b *ObjectVendor) newHeader(seed uint64, size int, pattern DataPattern) *ObjectHeader {
+	h := &ObjectHeader{
+		Version:         generatorVersion,
+		Compressibility: uint32(b.config.Compressibility),
+		CompressMode:    uint8(b.config.CompressMode),
+		Pattern:         uint8(pattern),
+		PatternSource:   b.sources[pattern],
+		Seed:            seed,
+		Size:            uint64(size),
+	}
+
+	if b.config.DedupePercent > 0 {
+		h.DedupePercent = uint8(b.config.DedupePercent)
+		h.DedupeBlockSize = uint32(b.config.DedupeBlockSize)
+		h.DedupeSeed = mixSeed(b.seed, seedStreamDedupe)
+		h.DedupePool = uint32(b.config.DedupePool)
+	}
+
+	return h
+}
+
 func (b *ObjectVendor) ReturnObject(blk *Object) {
 	b.pool.Put(blk)
 }
 
 func parseSizeSpec(sizespec string) (*ObjectVendorConfig, error) {
 	config := &ObjectVendorConfig{
-		Sizes:      make([]int, 100),
-		Extensions: make(map[int]string),
-		MaxSize:    0,
+		MaxSize: 0,
 	}
 
-	totalPercent := 0
-	splits := strings.Split(sizespec, ":")
+	totalPercent := 0.0
+	splits := splitOutsideParens(sizespec, ':')
 
 	if len(splits) == 0 {
 		return nil, fmt.Errorf("size spec needs at least one size; try 'blocksize/100/dat'")
@@ -103,8 +270,9 @@ func parseSizeSpec(sizespec string) (*ObjectVendorConfig, error) {
 		sizeStr := ""
 		percentStr := "100"
 		extension := "dat"
+		patternStr := ""
 
-		strs := strings.Split(s, "/")
+		strs := splitOutsideParens(s, '/')
 		switch {
 		case len(strs) == 1:
 			sizeStr = strs[0]
@@ -115,42 +283,84 @@ func parseSizeSpec(sizespec string) (*ObjectVendorConfig, error) {
 			sizeStr = strs[0]
 			percentStr = strs[1]
 			extension = strs[2]
+		case len(strs) == 4:
+			sizeStr = strs[0]
+			percentStr = strs[1]
+			extension = strs[2]
+			patternStr = strs[3]
 		default:
-			return nil, fmt.Errorf("malformed split '%s'; should be blocksize/percent/extension", s)
+			return nil, fmt.Errorf("malformed split '%s'; should be blocksize/percent/extension[/pattern]", s)
 		}
 
-		size, err := parseSizeInBytes(sizeStr)
+		dist, err := parseSizeDist(sizeStr)
 
 		if err != nil {
-			return nil, fmt.Errorf("cannot parse block size spec: %s", err)
-		} else if size <= 0 {
-			return nil, fmt.Errorf("block size '%s' must be above 0", sizeStr)
+			return nil, err
 		}
 
-		percent, err := strconv.ParseInt(percentStr, 10, 64)
+		percent, err := strconv.ParseFloat(percentStr, 64)
 
-		if err != nil {
-			return nil, fmt.Errorf("cannot parse '%s' as int64", percentStr)
-		} else if totalPercent+int(percent) > 100 {
+		if err != nil || percent < 0 || math.IsInf(percent, 0) {
+			return nil, fmt.Errorf("cannot parse '%s' as a percentage", percentStr)
+		} else if totalPercent+percent > 100+percentSlop {
 			return nil, fmt.Errorf("percents must sum to 100")
 		}
 
-		for i := totalPercent; i < totalPercent+int(percent); i++ {
-			config.Sizes[i] = int(size)
+		entry := SizeEntry{
+			Dist:      dist,
+			Weight:    percent,
+			Extension: extension,
 		}
 
-		if int(size) > config.MaxSize {
-			config.MaxSize = int(size)
+		if len(patternStr) > 0 {
+			if entry.Pattern, err = parseDataPattern(patternStr); err != nil {
+				return nil, err
+			}
+			entry.HasPattern = true
 		}
 
-		config.Extensions[int(size)] = extension
+		totalPercent += percent
+
+		if percent > 0 {
+			if dist.Max() > config.MaxSize {
+				config.MaxSize = dist.Max()
+			}
 
-		totalPercent += int(percent)
+			config.Entries = append(config.Entries, entry)
+			config.Cumulative = append(config.Cumulative, totalPercent)
+		}
 	}
 
-	if totalPercent != 100 {
+	if math.Abs(totalPercent-100) > percentSlop {
 		return nil, fmt.Errorf("percents must sum to 100")
 	}
 
 	return config, nil
 }
+
+// splitOutsideParens is like strings.Split, but ignores separators within
+// parentheses (e.g. in "file(/path/to/sizes)/100").
+func splitOutsideParens(s string, sep byte) []string {
+	var splits []string
+	depth, start := 0, 0
+
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case sep:
+			if depth == 0 {
+				splits = append(splits, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+
+	return append(splits, s[start:])
+}
+
+// percentSlop allows for fractional percents like 33.33 that don't quite
+// add up.
+const percentSlop = 0.1
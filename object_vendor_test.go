@@ -1,8 +1,11 @@
 package main
 
 import (
+	"crypto/sha256"
 	"fmt"
+	"hash/crc32"
 	"runtime/debug"
+	"sync"
 	"testing"
 )
 
@@ -38,6 +41,12 @@ func TestParseBlockSizes_InvalidInput(t *testing.T) {
 
 	_, err = parseSizeSpec("foo/100")
 	ExpectErrorf(t, err, "invalid size")
+
+	_, err = parseSizeSpec("4k/100/dat/blah")
+	ExpectErrorf(t, err, "invalid pattern")
+
+	_, err = parseSizeSpec("4k/100/dat/text/x")
+	ExpectErrorf(t, err, "too many fields")
 }
 
 func TestParseBlockSizes_ValidInput(t *testing.T) {
@@ -51,6 +60,10 @@ func TestParseBlockSizes_ValidInput(t *testing.T) {
 
 	fmt.Println(config)
 
+	config, err = parseSizeSpec("4KB/50/xml/text:8KB/50/mp4")
+	AbortOnErrorf(t, err, "parse split with pattern")
+	ExpectEqual(t, PatternText, config.Entries[0].Pattern)
+	ExpectEqual(t, false, config.Entries[1].HasPattern)
 }
 
 // ExpectErrorf causes the testing framework to error if the given
@@ -70,3 +83,124 @@ func ExpectError(t *testing.T, e error) {
 	t.Helper()
 	ExpectErrorf(t, e, "")
 }
+
+func TestObjectVendor_ConcurrentGetObject(t *testing.T) {
+	vendor, err := NewObjectVendor("64KB/50:200KB/50", DataConfig{Compressibility: 50}, defaultSeed)
+	AbortOnError(t, err)
+
+	const runners = 16
+	const objects = 200
+
+	// Reference checksums, generated one runner at a time.
+	expected := make([][]uint32, runners)
+	for i := 0; i < runners; i++ {
+		expected[i] = generateChecksums(vendor.NewGenerator(i+1), objects)
+	}
+
+	// Same again, with all runners going at once.
+	actual := make([][]uint32, runners)
+	var wg sync.WaitGroup
+
+	for i := 0; i < runners; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			actual[i] = generateChecksums(vendor.NewGenerator(i+1), objects)
+		}(i)
+	}
+
+	wg.Wait()
+
+	for i := 0; i < runners; i++ {
+		for j := 0; j < objects; j++ {
+			if expected[i][j] != actual[i][j] {
+				t.Fatalf("runner %d object %d: data differs when generated concurrently", i+1, j)
+			}
+		}
+	}
+
+	if expected[0][0] == expected[1][0] {
+		t.Errorf("runners 1 and 2 generated identical data")
+	}
+}
+
+func TestObjectVendor_BufferSize(t *testing.T) {
+	vendor, err := NewObjectVendor("lognormal(64KB,2)", DataConfig{Compressibility: 50}, defaultSeed)
+	AbortOnError(t, err)
+
+	// Buffers grow with the objects drawn, not to the largest possible
+	g := vendor.NewGenerator(1)
+	largest := 0
+
+	for i := 0; i < 100; i++ {
+		blk := g.GetObject()
+		largest = max(largest, len(blk.Data))
+
+		if cap(blk.dataBuf) > largest {
+			t.Fatalf("object %d: %d byte buffer, but the largest drawn is %d", i, cap(blk.dataBuf), largest)
+		}
+
+		vendor.ReturnObject(blk)
+	}
+
+	if largest >= vendor.config.MaxSize {
+		t.Errorf("expected objects well below the %d byte maximum, got %d", vendor.config.MaxSize, largest)
+	}
+}
+
+// generateChecksums returns a checksum of each generated object.
+func generateChecksums(g *ObjectGenerator, count int) []uint32 {
+	sums := make([]uint32, count)
+
+	for i := range sums {
+		blk := g.GetObject()
+		sums[i] = crc32.ChecksumIEEE(blk.Data)
+		g.vendor.ReturnObject(blk)
+	}
+
+	return sums
+}
+
+func TestObjectVendor_Dedupe(t *testing.T) {
+	for _, tc := range []struct {
+		percent  int
+		minRatio float64
+		maxRatio float64
+	}{
+		{0, 1.0, 1.01},
+		{50, 1.8, 2.2},
+		{75, 3.4, 4.6},
+	} {
+		data := DataConfig{DedupePercent: tc.percent, DedupeBlockSize: 4096, DedupePool: 64}
+		vendor, err := NewObjectVendor("1MB", data, 99)
+		AbortOnError(t, err)
+
+		ratio := dedupeRatio(vendor, 50, 4096)
+		t.Logf("dedupe %d%%: ratio %.2f", tc.percent, ratio)
+
+		if ratio < tc.minRatio || ratio > tc.maxRatio {
+			t.Errorf("dedupe %d%%: ratio %.2f not between %.2f and %.2f", tc.percent, ratio, tc.minRatio, tc.maxRatio)
+		}
+	}
+}
+
+// dedupeRatio generates objects and returns total blocks / unique blocks,
+// as seen by a dedupe engine using the given block size.
+func dedupeRatio(vendor *ObjectVendor, objects int, blockSize int) float64 {
+	g := vendor.NewGenerator(1)
+	unique := make(map[[sha256.Size]byte]bool)
+	total := 0
+
+	for i := 0; i < objects; i++ {
+		blk := g.GetObject()
+
+		for offset := 0; offset+blockSize <= len(blk.Data); offset += blockSize {
+			unique[sha256.Sum256(blk.Data[offset:offset+blockSize])] = true
+			total++
+		}
+
+		vendor.ReturnObject(blk)
+	}
+
+	return float64(total) / float64(len(unique))
+}
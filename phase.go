@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// Phase is one of a sequence of workloads run back to back, e.g. a
+// prefill, then writes, then a mixed workload. A phase's settings override
+// the top-level (and each job's) settings, and it ends after its duration,
+// or once it has read and written its bytes or done its ops, whichever
+// comes first. The last phase needn't have a limit, in which case it runs
+// until the run is stopped.
+type Phase struct {
+	Name     string
+	Settings map[string]interface{} // overrides, without the keys below
+	Duration time.Duration
+	Bytes    int64
+	Ops      int64
+}
+
+// phaseKeys are a phase's own settings rather than overrides.
+var phaseKeys = map[string]bool{"name": true, "duration": true, "bytes": true, "ops": true}
+
+func parsePhases() ([]*Phase, error) {
+	raw := viper.Get("phases")
+
+	if raw == nil {
+		return nil, nil
+	}
+
+	list, ok := raw.([]interface{})
+	if !ok || len(list) == 0 {
+		return nil, fmt.Errorf("'phases' in config.json must be a list of phase settings")
+	}
+
+	if len(viper.GetString("replay.trace")) > 0 {
+		return nil, fmt.Errorf("phases can't be combined with trace replay")
+	}
+
+	phases := make([]*Phase, len(list))
+
+	for i, entry := range list {
+		settings, ok := entry.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("phase %d in config.json isn't a set of settings", i+1)
+		}
+
+		// Read the phase's own settings the same way as the rest of the config
+		v := viper.New()
+		if e := v.MergeConfigMap(settings); e != nil {
+			return nil, fmt.Errorf("phase %d: %s", i+1, e)
+		}
+
+		p := &Phase{
+			Name:     v.GetString("name"),
+			Settings: make(map[string]interface{}),
+			Duration: v.GetDuration("duration"),
+			Bytes:    int64(v.GetSizeInBytes("bytes")),
+			Ops:      v.GetInt64("ops"),
+		}
+
+		if len(p.Name) == 0 {
+			p.Name = fmt.Sprintf("phase%d", i+1)
+		}
+
+		for key, value := range settings {
+			if !phaseKeys[strings.ToLower(key)] {
+				p.Settings[key] = value
+			}
+		}
+
+		if p.Duration < 0 || p.Bytes < 0 || p.Ops < 0 {
+			return nil, fmt.Errorf("phase %d (%s) has a negative limit", i+1, p.Name)
+		}
+
+		if p.Duration == 0 && p.Bytes == 0 && p.Ops == 0 && i < len(list)-1 {
+			return nil, fmt.Errorf("phase %d (%s) needs a duration, bytes or ops limit", i+1, p.Name)
+		}
+
+		phases[i] = p
+	}
+
+	return phases, nil
+}
+
+func (p *Phase) String() string {
+	var limits []string
+
+	if p.Duration > 0 {
+		limits = append(limits, p.Duration.String())
+	}
+	if p.Bytes > 0 {
+		limits = append(limits, SprintSize(p.Bytes))
+	}
+	if p.Ops > 0 {
+		limits = append(limits, fmt.Sprintf("%d ops", p.Ops))
+	}
+	if len(limits) == 0 {
+		limits = append(limits, "until stopped")
+	}
+
+	return fmt.Sprintf("%s (%s)", p.Name, strings.Join(limits, " or "))
+}
+
+// PhaseRunner moves a run through its phases. The first phase's runners
+// are started as usual; for each later one, the runners are stopped and
+// replaced with the next phase's, without running the setup or teardown
+// commands. Stores, and the objects in them, carry over.
+type PhaseRunner struct {
+	*zap.SugaredLogger
+	runners *RunnerList
+	stop    func()
+}
+
+func NewPhaseRunner(runners *RunnerList) *PhaseRunner {
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+
+	p := &PhaseRunner{
+		SugaredLogger: Logger(),
+		runners:       runners,
+		stop: func() {
+			cancel()
+			wg.Wait()
+		},
+	}
+
+	wg.Add(1)
+	go func() {
+		p.Run(ctx)
+		wg.Done()
+	}()
+
+	return p
+}
+
+// Stop stops changing phases; call it before stopping the runners.
+func (p *PhaseRunner) Stop() {
+	p.stop()
+}
+
+func (p *PhaseRunner) Run(ctx context.Context) {
+	<-global.Start
+
+	for i, phase := range global.Phases {
+		if i > 0 {
+			p.runners.NextPhase()
+
+			for _, job := range global.Jobs {
+				job.Syncer.Report()
+				job.Syncer.Stop()
+			}
+
+			if e := addFileRunners(p.runners, phase); e != nil {
+				p.fail(ctx, e)
+				return
+			}
+		}
+
+		p.Infof("=== phase %d of %d: %s ===", i+1, len(global.Phases), phase)
+		done := global.Reporter.BeginPhase(phase.Name, phase.Bytes, phase.Ops)
+
+		if i > 0 {
+			if e := p.runners.Resume(); e != nil {
+				p.fail(ctx, e)
+				return
+			}
+		}
+
+		if !p.wait(ctx, phase, done) {
+			return
+		}
+	}
+
+	finishRun("all phases complete")
+}
+
+// wait waits for the phase to reach a limit, returning false if the run is
+// stopped first.
+func (p *PhaseRunner) wait(ctx context.Context, phase *Phase, done <-chan struct{}) bool {
+	var timeout <-chan time.Time
+
+	if phase.Duration > 0 {
+		t := time.NewTimer(phase.Duration)
+		defer t.Stop()
+		timeout = t.C
+	}
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-done:
+		p.Infof("phase %s reached its limit", phase.Name)
+	case <-timeout:
+		p.Infof("phase %s reached its duration", phase.Name)
+	}
+
+	return true
+}
+
+func (p *PhaseRunner) fail(ctx context.Context, e error) {
+	select {
+	case global.RunnerError <- fmt.Errorf("cannot start next phase: %s", e):
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func readTestConfig(t *testing.T, config string) {
+	t.Helper()
+	viper.SetConfigType("json")
+	AbortOnError(t, viper.ReadConfig(strings.NewReader(config)))
+}
+
+func TestParsePhases(t *testing.T) {
+	defer viper.Reset()
+
+	readTestConfig(t, `{
+		"read": 0,
+		"phases": [
+			{"name": "prefill", "bytes": "1GB", "size": "4MB"},
+			{"duration": "10m", "read": 30, "ops": 1000},
+			{"name": "reads", "read": 100}
+		]
+	}`)
+
+	phases, err := parsePhases()
+	AbortOnError(t, err)
+	ExpectEqual(t, 3, len(phases))
+
+	ExpectEqual(t, "prefill", phases[0].Name)
+	ExpectEqual(t, int64(1<<30), phases[0].Bytes)
+	ExpectEqual(t, 1, len(phases[0].Settings))
+	ExpectEqual(t, "4MB", phases[0].Settings["size"])
+
+	ExpectEqual(t, "phase2", phases[1].Name)
+	ExpectEqual(t, 10*time.Minute, phases[1].Duration)
+	ExpectEqual(t, int64(1000), phases[1].Ops)
+	ExpectEqual(t, "phase2 (10m0s or 1000 ops)", phases[1].String())
+
+	// The last phase may run until the run is stopped
+	ExpectEqual(t, "reads (until stopped)", phases[2].String())
+
+	// Phase settings override the top level's, and each job's
+	configs, err := jobConfigs(phases[1])
+	AbortOnError(t, err)
+	ExpectEqual(t, 30, configs[0].GetInt("read"))
+	ExpectEqual(t, nil, configs[0].Get("phases"))
+}
+
+func TestParsePhases_None(t *testing.T) {
+	defer viper.Reset()
+
+	phases, err := parsePhases()
+	AbortOnError(t, err)
+	ExpectEqual(t, 0, len(phases))
+}
+
+func TestParsePhases_Invalid(t *testing.T) {
+	for _, config := range []string{
+		`{"phases": {"name": "one"}}`,
+		`{"phases": []}`,
+		`{"phases": ["one"]}`,
+		`{"phases": [{"name": "one"}, {"name": "two"}]}`,
+		`{"phases": [{"duration": "-1s"}]}`,
+		`{"phases": [{"duration": "1s"}], "replay": {"trace": "trace.csv"}}`,
+	} {
+		viper.Reset()
+		readTestConfig(t, config)
+
+		_, err := parsePhases()
+		ExpectErrorf(t, err, "expected error for config: %s", config)
+	}
+
+	viper.Reset()
+}
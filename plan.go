@@ -0,0 +1,267 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+)
+
+// runPlan is what a run would do, as worked out by validateConfig without
+// touching any disks.
+type runPlan struct {
+	Phases      []planPhase
+	Fill        *FillConfig // nil unless in fill mode
+	Replay      *ReplayConfig
+	Reporter    *ReporterConfig
+	ErrorPolicy *ErrorPolicy
+	Duration    time.Duration // of the whole run, or 0 until stopped
+}
+
+type planPhase struct {
+	Phase *Phase // nil without phases
+	Jobs  []*Job
+}
+
+// meanSampleCount is how many object sizes are drawn to estimate the mean.
+const meanSampleCount = 10000
+
+// Print describes the plan: stores, runners, object sizes, sync policy and
+// how much memory and disk the run should take.
+func (p *runPlan) Print(w io.Writer) {
+	fmt.Fprintf(w, "reporter: every %s", p.Reporter.Interval)
+	if p.Reporter.WarmUp > 0 {
+		fmt.Fprintf(w, " after a %s warm-up", p.Reporter.WarmUp)
+	}
+	fmt.Fprintf(w, "\nerrors: %s\n", p.ErrorPolicy)
+
+	last := p.Phases[len(p.Phases)-1].Phase
+
+	switch {
+	case p.Duration > 0:
+		fmt.Fprintf(w, "ends: after %s, or on Control-C\n", p.Duration)
+	case last != nil && (last.Duration > 0 || last.Bytes > 0 || last.Ops > 0):
+		fmt.Fprintf(w, "ends: after the last phase, or on Control-C\n")
+	default:
+		fmt.Fprintf(w, "ends: on Control-C\n")
+	}
+
+	if p.Fill != nil {
+		fmt.Fprintf(w, "fill: until each file system is %.1f%% full, churning at %.1f%%\n", p.Fill.Target, p.Fill.ChurnAt)
+	}
+
+	memory := int64(0)
+	var written int64
+	var unbounded []string
+
+	for i, phase := range p.Phases {
+		fmt.Fprintf(w, "\n")
+
+		if phase.Phase != nil {
+			fmt.Fprintf(w, "phase %d: %s\n", i+1, phase.Phase)
+		} else if len(phase.Jobs) > 0 {
+			fmt.Fprintf(w, "workload:\n")
+		}
+
+		if len(phase.Jobs) == 0 {
+			fmt.Fprintf(w, "  no file runners\n")
+			continue
+		}
+
+		phaseMemory, runners, writeWeight := int64(0), 0, 0.0
+		var meanWritten float64 // per write op, across jobs
+
+		for _, job := range phase.Jobs {
+			printJob(w, job)
+
+			n := job.RunnersPerPath * len(job.Paths)
+			mean := job.ObjectVendor.meanSize()
+			fraction := float64(100-job.ReadPercent) / 100
+
+			phaseMemory += int64(n) * int64(job.ObjectVendor.config.MaxSize)
+			runners += n
+			writeWeight += float64(n) * fraction
+			meanWritten += float64(n) * fraction * min(mean, float64(job.IoSize))
+		}
+
+		if phaseMemory > memory {
+			memory = phaseMemory
+		}
+
+		name := "the run"
+		if phase.Phase != nil {
+			name = fmt.Sprintf("phase %d", i+1)
+		}
+
+		// Assume every runner gets through the same number of bytes (or
+		// ops), and that reads are of objects the same size as writes.
+		fraction := writeWeight / float64(runners)
+
+		switch {
+		case p.Fill != nil:
+			unbounded = append(unbounded, fmt.Sprintf("%s fills its file systems", name))
+		case phase.Phase != nil && phase.Phase.Bytes > 0:
+			n := int64(float64(phase.Phase.Bytes) * fraction)
+			written += n
+			fmt.Fprintf(w, "  writes about %s\n", SprintSize(n))
+		case phase.Phase != nil && phase.Phase.Ops > 0 && writeWeight > 0:
+			n := int64(float64(phase.Phase.Ops) * meanWritten / float64(runners))
+			written += n
+			fmt.Fprintf(w, "  writes up to about %s\n", SprintSize(n))
+		case fraction == 0:
+			fmt.Fprintf(w, "  writes nothing\n")
+		case phase.Phase != nil && phase.Phase.Duration > 0:
+			unbounded = append(unbounded, fmt.Sprintf("whatever %s writes in %s", name, phase.Phase.Duration))
+		case p.Duration > 0 && phase.Phase != nil:
+			unbounded = append(unbounded, fmt.Sprintf("whatever %s writes until the run ends at %s", name, p.Duration))
+		case p.Duration > 0:
+			unbounded = append(unbounded, fmt.Sprintf("whatever %s writes in %s", name, p.Duration))
+		default:
+			unbounded = append(unbounded, fmt.Sprintf("whatever %s writes until stopped", name))
+		}
+	}
+
+	stores := planStores(p.Phases)
+
+	if len(stores) > 0 || p.Replay != nil {
+		fmt.Fprintf(w, "\nstores:\n")
+	}
+
+	for _, store := range stores {
+		fmt.Fprintf(w, "  %s: %s\n", store.path, strings.Join(store.runners, ", "))
+	}
+
+	if r := p.Replay; r != nil {
+		timing := "as fast as possible"
+		if r.Timed {
+			timing = fmt.Sprintf("at %gx the trace's timing", r.Speed)
+		}
+		fmt.Fprintf(w, "  %s: replay of %s with %d workers, %s\n", r.Path, r.Trace, r.Workers, timing)
+	}
+
+	fmt.Fprintf(w, "\nfootprint:\n")
+	fmt.Fprintf(w, "  memory: up to %s of object buffers (runners x largest object)\n", SprintSize(memory))
+
+	disk := SprintSize(written)
+	if len(unbounded) > 0 && written == 0 {
+		disk = strings.Join(unbounded, ", plus ")
+	} else if len(unbounded) > 0 {
+		disk = fmt.Sprintf("about %s, plus %s", disk, strings.Join(unbounded, ", plus "))
+	} else {
+		disk = "about " + disk
+	}
+	if p.Replay != nil {
+		disk += ", plus what the trace writes"
+	}
+	fmt.Fprintf(w, "  disk: %s\n", disk)
+}
+
+func printJob(w io.Writer, job *Job) {
+	fmt.Fprintf(w, "  job %s: %d runners per path, iosize %s, read %d%%\n",
+		job.Name, job.RunnersPerPath, SprintSize(job.IoSize), job.ReadPercent)
+	fmt.Fprintf(w, "    paths: %s\n", strings.Join(job.Paths, ", "))
+
+	config := job.ObjectVendor.config
+	sizes := make([]string, len(config.Entries))
+
+	for i, entry := range config.Entries {
+		pattern := config.Pattern
+		if entry.HasPattern {
+			pattern = entry.Pattern
+		}
+		sizes[i] = fmt.Sprintf("%g%% %s .%s %s", entry.Weight, entry.Dist, entry.Extension, pattern)
+	}
+
+	fmt.Fprintf(w, "    sizes: %s\n", strings.Join(sizes, "; "))
+	fmt.Fprintf(w, "    objects: mean about %s, largest %s\n",
+		SprintSize(int64(job.ObjectVendor.meanSize())), SprintSize(int64(config.MaxSize)))
+	fmt.Fprintf(w, "    sync: %s\n", syncPolicy(job))
+
+	var limits []string
+	if job.OpLimit != nil {
+		limits = append(limits, fmt.Sprintf("%g ops/sec", job.OpLimit.rate))
+	}
+	if job.ByteLimit != nil {
+		limits = append(limits, fmt.Sprintf("%s/sec", SprintSize(int64(job.ByteLimit.rate))))
+	}
+	if len(limits) > 0 {
+		fmt.Fprintf(w, "    rate: %s\n", strings.Join(limits, ", "))
+	}
+}
+
+// syncPolicy describes when a job syncs.
+func syncPolicy(job *Job) string {
+	when := "on close"
+	if job.SyncWhen == SyncOnWrite {
+		when = "after every write"
+	}
+
+	switch s := job.Syncer.(type) {
+	case *SyncInline:
+		return "inline, " + when
+	case *SyncBatcher:
+		return fmt.Sprintf("in batches of up to %d, waiting up to %s, %s", s.maxPending, s.maxWait, when)
+	default:
+		return "none"
+	}
+}
+
+type planStore struct {
+	path    string
+	runners []string // e.g. "10 runners in phase 1"
+}
+
+// planStores lists the paths written to, with how many runners each has.
+func planStores(phases []planPhase) []planStore {
+	var paths []string
+	runners := make(map[string][]string)
+
+	for i, phase := range phases {
+		counts := make(map[string]int)
+		var order []string
+
+		for _, job := range phase.Jobs {
+			for _, path := range job.Paths {
+				if _, ok := runners[path]; !ok {
+					runners[path] = nil
+					paths = append(paths, path)
+				}
+				if _, ok := counts[path]; !ok {
+					order = append(order, path)
+				}
+				counts[path] += job.RunnersPerPath
+			}
+		}
+
+		for _, path := range order {
+			s := fmt.Sprintf("%d runners", counts[path])
+			if phase.Phase != nil {
+				s += fmt.Sprintf(" in phase %d", i+1)
+			}
+			runners[path] = append(runners[path], s)
+		}
+	}
+
+	sort.Strings(paths)
+	stores := make([]planStore, len(paths))
+
+	for i, path := range paths {
+		stores[i] = planStore{path, runners[path]}
+	}
+
+	return stores
+}
+
+// meanSize estimates the mean object size by drawing a sample of sizes.
+func (b *ObjectVendor) meanSize() float64 {
+	rng := rand.New(rand.NewSource(1))
+	total := 0.0
+
+	for i := 0; i < meanSampleCount; i++ {
+		total += float64(b.config.pick(rng).Dist.Sample(rng))
+	}
+
+	return total / meanSampleCount
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimiter is a token bucket shared by a job's runners, limiting ops or
+// bytes per second. A caller asking for more than is available is told to
+// wait until it would have accrued, so the long-run rate is exact however
+// large each request is, and bursts are limited to one second's worth.
+// A nil RateLimiter doesn't limit anything.
+type RateLimiter struct {
+	lock   sync.Mutex
+	rate   float64 // per second
+	tokens float64 // may go negative when callers are waiting
+	last   time.Time
+}
+
+func NewRateLimiter(rate float64) *RateLimiter {
+	return &RateLimiter{rate: rate, last: time.Now()}
+}
+
+// Wait blocks until n more units fit within the rate, or ctx is done.
+func (l *RateLimiter) Wait(ctx context.Context, n int) error {
+	if l == nil {
+		return nil
+	}
+
+	wait := l.reserve(n, time.Now())
+
+	if wait <= 0 {
+		return nil
+	}
+
+	t := time.NewTimer(wait)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// reserve takes n units at time now, returning how long the caller must
+// wait before using them.
+func (l *RateLimiter) reserve(n int, now time.Time) time.Duration {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.tokens = math.Min(l.tokens+now.Sub(l.last).Seconds()*l.rate, l.rate)
+	l.last = now
+	l.tokens -= float64(n)
+
+	if l.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter_Reserve(t *testing.T) {
+	start := time.Now()
+	l := &RateLimiter{rate: 100, last: start}
+
+	// Nothing has accrued yet, so the first op waits for its share
+	ExpectEqual(t, 10*time.Millisecond, l.reserve(1, start))
+
+	// Callers queue up behind each other
+	ExpectEqual(t, 20*time.Millisecond, l.reserve(1, start))
+
+	// Requests bigger than a second's worth wait proportionally
+	ExpectEqual(t, 2020*time.Millisecond, l.reserve(200, start))
+
+	// Idle time builds up at most a second's worth of credit
+	later := start.Add(time.Minute)
+	ExpectEqual(t, time.Duration(0), l.reserve(100, later))
+	ExpectEqual(t, 10*time.Millisecond, l.reserve(1, later))
+}
+
+func TestRateLimiter_Wait(t *testing.T) {
+	var none *RateLimiter
+	AbortOnError(t, none.Wait(context.Background(), 1<<30))
+
+	l := NewRateLimiter(1000)
+	start := time.Now()
+
+	for i := 0; i < 50; i++ {
+		AbortOnError(t, l.Wait(context.Background(), 1))
+	}
+
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("50 ops at 1000/sec took only %s", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ExpectError(t, l.Wait(ctx, 1000000))
+}
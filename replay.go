@@ -0,0 +1,413 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type ReplayConfig struct {
+	Trace   string
+	Path    string  // of the store, for per-path stats
+	Timed   bool    // follow the trace's timestamps; otherwise as fast as possible
+	Speed   float64 // timestamp speedup, e.g. 2 replays twice as fast
+	Workers int     // ops in flight at once
+	Sync    bool    // sync after every write
+	Prepare bool    // create objects that are read before they're written
+}
+
+// Replayer replays a workload trace against an object store. Ops are
+// spread over workers by object name, so ops on any one object happen in
+// trace order while ops on different objects may overlap.
+type Replayer struct {
+	*zap.SugaredLogger
+	config      *ReplayConfig
+	store       ObjectStore
+	records     []TraceRecord
+	reporter    *Reporter
+	errorPolicy *ErrorPolicy
+	errchan     chan error
+	start       time.Time
+	lagLock     sync.Mutex
+	maxLag      time.Duration // furthest behind schedule in timed mode
+	state       int32         // a RunnerState
+}
+
+// replayWorker performs the ops for its share of objects.
+type replayWorker struct {
+	*Replayer
+	id        int
+	ops       chan *TraceRecord
+	generator *ObjectGenerator
+	buf       []byte
+	files     map[string]ObjectFile
+	failures  int
+}
+
+// maxOpenFiles is how many objects each worker keeps open between ops.
+const maxOpenFiles = 64
+
+func NewReplayer(store ObjectStore, config *ReplayConfig) (*Replayer, error) {
+	r := &Replayer{
+		SugaredLogger: Logger().With(zap.String("trace", config.Trace)),
+		config:        config,
+		store:         store,
+		reporter:      global.Reporter,
+		errorPolicy:   global.ErrorPolicy,
+		errchan:       global.RunnerError,
+	}
+
+	if config.Workers < 1 {
+		return nil, fmt.Errorf("replay needs at least 1 worker")
+	}
+
+	if config.Timed && config.Speed <= 0 {
+		return nil, fmt.Errorf("replay speed must be above 0")
+	}
+
+	var e error
+	if r.records, e = ReadTrace(config.Trace); e != nil {
+		return nil, e
+	}
+
+	if len(r.records) == 0 {
+		return nil, fmt.Errorf("trace %s has no ops", config.Trace)
+	}
+
+	duration := r.records[len(r.records)-1].Timestamp - r.records[0].Timestamp
+	r.Infof("replaying %d ops spanning %.1f sec with %d workers", len(r.records), duration, config.Workers)
+
+	if config.Timed {
+		r.Infof("following trace timing at %gx speed", config.Speed)
+	} else {
+		r.Infof("replaying as fast as possible")
+	}
+
+	return r, nil
+}
+
+// Prepare creates objects that the trace reads before writing, big enough
+// for every read of them, so the trace doesn't need to have been captured
+// from an empty store.
+func (r *Replayer) Prepare() error {
+	if !r.config.Prepare {
+		return nil
+	}
+
+	written := make(map[string]bool)
+	needed := make(map[string]int64)
+	var order []string
+
+	for i := range r.records {
+		tr := &r.records[i]
+
+		switch {
+		case tr.Op == Read && !written[tr.Object]:
+			if _, ok := needed[tr.Object]; !ok {
+				order = append(order, tr.Object)
+			}
+			if end := tr.Offset + tr.Length; end > needed[tr.Object] {
+				needed[tr.Object] = end
+			}
+		case tr.Op == Write || tr.Op == Delete:
+			written[tr.Object] = true
+		}
+	}
+
+	if len(order) == 0 {
+		return nil
+	}
+
+	total := int64(0)
+	for _, size := range needed {
+		total += size
+	}
+
+	r.Infof("preparing %d objects (%s) read by the trace", len(order), SprintSize(total))
+
+	g := global.ObjectVendor.NewGenerator(0)
+	buf := make([]byte, 1<<20)
+
+	for _, name := range order {
+		if e := r.prepareObject(name, needed[name], g, buf); e != nil {
+			return fmt.Errorf("cannot prepare %s: %s", name, e)
+		}
+	}
+
+	return nil
+}
+
+func (r *Replayer) prepareObject(name string, size int64, g *ObjectGenerator, buf []byte) (e error) {
+	f, e := r.store.OpenObject(name, true)
+	if e != nil {
+		return e
+	}
+
+	defer func() {
+		if e == nil {
+			e = f.Close()
+		} else {
+			_ = f.Close()
+		}
+	}()
+
+	for offset := int64(0); offset < size; offset += int64(len(buf)) {
+		n := int64(len(buf))
+		if n > size-offset {
+			n = size - offset
+		}
+
+		g.FillData(buf[:n])
+
+		if _, e = f.WriteAt(buf[:n], offset); e != nil {
+			return e
+		}
+	}
+
+	return nil
+}
+
+func (r *Replayer) Run(ctx context.Context) {
+	defer atomic.StoreInt32(&r.state, int32(RunnerStopped))
+
+	<-global.Start
+
+	r.Infof("running")
+	atomic.StoreInt32(&r.state, int32(RunnerRunning))
+	r.start = time.Now()
+	workers := make([]*replayWorker, r.config.Workers)
+	var wg sync.WaitGroup
+
+	for i := range workers {
+		workers[i] = &replayWorker{
+			Replayer:  r,
+			id:        i,
+			ops:       make(chan *TraceRecord, 64),
+			generator: global.ObjectVendor.NewGenerator(i + 1),
+			files:     make(map[string]ObjectFile),
+		}
+
+		wg.Add(1)
+		go func(w *replayWorker) {
+			w.run(ctx)
+			wg.Done()
+		}(workers[i])
+	}
+
+	dispatched := r.dispatch(ctx, workers)
+
+	for _, w := range workers {
+		close(w.ops)
+	}
+
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return
+	}
+
+	r.Infof("replayed %d ops in %.1f sec", dispatched, time.Since(r.start).Seconds())
+
+	if r.config.Timed {
+		r.Infof("furthest behind trace timing: %.3f sec", r.maxLag.Seconds())
+	}
+
+	finishRun("trace replay complete")
+}
+
+// State returns what the replayer is doing: waiting, running or stopped.
+func (r *Replayer) State() RunnerState {
+	return RunnerState(atomic.LoadInt32(&r.state))
+}
+
+// dispatch hands each op to its worker, at the time the trace calls for in
+// timed mode. It returns the number of ops dispatched.
+func (r *Replayer) dispatch(ctx context.Context, workers []*replayWorker) int {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for i := range r.records {
+		tr := &r.records[i]
+
+		if r.config.Timed {
+			if wait := r.due(tr) - time.Since(r.start); wait > 0 {
+				timer.Reset(wait)
+
+				select {
+				case <-ctx.Done():
+					return i
+				case <-timer.C:
+				}
+			}
+		}
+
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(tr.Object))
+
+		select {
+		case <-ctx.Done():
+			return i
+		case workers[h.Sum32()%uint32(len(workers))].ops <- tr:
+		}
+	}
+
+	return len(r.records)
+}
+
+// due returns when an op should start, relative to the start of the replay.
+func (r *Replayer) due(tr *TraceRecord) time.Duration {
+	return time.Duration((tr.Timestamp - r.records[0].Timestamp) / r.config.Speed * float64(time.Second))
+}
+
+func (r *Replayer) noteLag(lag time.Duration) {
+	r.lagLock.Lock()
+	if lag > r.maxLag {
+		r.maxLag = lag
+	}
+	r.lagLock.Unlock()
+}
+
+func (w *replayWorker) run(ctx context.Context) {
+	defer w.closeFiles()
+
+	for tr := range w.ops {
+		if ctx.Err() != nil {
+			return
+		}
+
+		if w.config.Timed {
+			w.noteLag(time.Since(w.start) - w.due(tr))
+		}
+
+		err := w.op(tr)
+		w.errorPolicy.CountOp()
+
+		if err == nil {
+			w.failures = 0
+			continue
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		w.failures++
+		w.reporter.CaptureError(tr.Op, err)
+
+		if fatal := w.errorPolicy.Handle(ctx, err, w.failures); fatal != nil {
+			select {
+			case w.errchan <- fatal:
+			case <-ctx.Done():
+			}
+
+			// Drain so the dispatcher isn't left blocked.
+			for range w.ops {
+			}
+			return
+		}
+
+		w.Warnf("%s error (%s, continuing): %s", opName(tr.Op), errnoName(err), err)
+	}
+}
+
+func (w *replayWorker) op(tr *TraceRecord) error {
+	if tr.Op == Delete {
+		w.closeFile(tr.Object)
+
+		sample := w.getSample()
+		e := w.store.DeleteObject(tr.Object)
+		w.reporter.CaptureSample(sample, 0, Delete)
+
+		if e != nil {
+			return fmt.Errorf("delete %s: %w", tr.Object, e)
+		}
+		return nil
+	}
+
+	f, e := w.openFile(tr.Object, tr.Op == Write)
+	if e != nil {
+		return fmt.Errorf("open %s: %w", tr.Object, e)
+	}
+
+	if int64(cap(w.buf)) < tr.Length {
+		w.buf = make([]byte, tr.Length)
+	}
+	buf := w.buf[:tr.Length]
+
+	if tr.Op == Read {
+		sample := w.getSample()
+		n, e := f.ReadAt(buf, tr.Offset)
+		w.reporter.CaptureSample(sample, n, Read)
+
+		if e != nil && e != io.EOF {
+			return fmt.Errorf("read %s: %w", tr.Object, e)
+		}
+		return nil
+	}
+
+	w.generator.FillData(buf)
+
+	sample := w.getSample()
+	n, e := f.WriteAt(buf, tr.Offset)
+	w.reporter.CaptureSample(sample, n, Write)
+
+	if e != nil {
+		return fmt.Errorf("write %s: %w", tr.Object, e)
+	}
+
+	if w.config.Sync {
+		if e = f.Sync(); e != nil {
+			return fmt.Errorf("sync %s: %w", tr.Object, e)
+		}
+	}
+
+	return nil
+}
+
+// getSample starts timing an op on the replayed path.
+func (w *replayWorker) getSample() *Sample {
+	s := w.reporter.GetSample()
+	s.Path = w.config.Path
+	return s
+}
+
+// openFile returns an open object, from the cache if possible.
+func (w *replayWorker) openFile(name string, create bool) (ObjectFile, error) {
+	if f, ok := w.files[name]; ok {
+		return f, nil
+	}
+
+	if len(w.files) >= maxOpenFiles {
+		for other := range w.files {
+			w.closeFile(other)
+			break
+		}
+	}
+
+	f, e := w.store.OpenObject(name, create)
+	if e != nil {
+		return nil, e
+	}
+
+	w.files[name] = f
+	return f, nil
+}
+
+func (w *replayWorker) closeFile(name string) {
+	if f, ok := w.files[name]; ok {
+		_ = f.Close()
+		delete(w.files, name)
+	}
+}
+
+func (w *replayWorker) closeFiles() {
+	for name := range w.files {
+		w.closeFile(name)
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testReplayer returns a Replayer for trace against a temp store, with
+// the run already started and its samples counted by op. The counts are
+// complete once the returned wait func returns, after Run.
+func testReplayer(t *testing.T, trace string, config ReplayConfig) (*Replayer, string, func() map[int]int) {
+	t.Helper()
+
+	vendor, err := NewObjectVendor("4KB", DataConfig{Compressibility: 50}, 5)
+	AbortOnError(t, err)
+	policy, err := NewErrorPolicy("abort")
+	AbortOnError(t, err)
+
+	reporter := &Reporter{
+		SugaredLogger: Logger(),
+		samples:       make(chan *Sample, 1000),
+		samplePool:    sync.Pool{New: func() interface{} { return &Sample{} }},
+		errorCounts:   make(map[errorKey]int64),
+	}
+
+	start := make(chan struct{})
+	close(start)
+
+	// Run reads these, so they stay swapped until the test is done
+	t.Cleanup(func(v *ObjectVendor, r *Reporter, p *ErrorPolicy, s chan struct{}) func() {
+		return func() {
+			global.ObjectVendor, global.Reporter, global.ErrorPolicy, global.Start = v, r, p, s
+		}
+	}(global.ObjectVendor, global.Reporter, global.ErrorPolicy, global.Start))
+	global.ObjectVendor, global.Reporter, global.ErrorPolicy, global.Start = vendor, reporter, policy, start
+
+	root := t.TempDir()
+	store, err := NewFileObjectStore(root, 0, false)
+	AbortOnError(t, err)
+
+	config.Trace = writeTraceFile(t, trace)
+	r, err := NewReplayer(store, &config)
+	AbortOnError(t, err)
+
+	counts := make(map[int]int)
+	done := make(chan struct{})
+
+	go func() {
+		for s := range reporter.samples {
+			counts[s.Op]++
+		}
+		close(done)
+	}()
+
+	return r, root, func() map[int]int {
+		close(reporter.samples)
+		<-done
+		return counts
+	}
+}
+
+func expectObjectSize(t *testing.T, root, name string, expected int64) {
+	t.Helper()
+
+	info, err := os.Stat(filepath.Join(root, name))
+	if err != nil {
+		t.Errorf("%s: %s", name, err)
+		return
+	}
+
+	if info.Size() != expected {
+		t.Errorf("%s is %d bytes, expected %d", name, info.Size(), expected)
+	}
+}
+
+func TestReplayer_Run(t *testing.T) {
+	drainDone()
+	defer drainDone()
+
+	// Each object's ops only come out right in trace order: log grows one
+	// block at a time and is then replaced by a smaller one, and tmp is
+	// written, read and deleted.
+	r, root, wait := testReplayer(t, `timestamp,op,object,offset,length
+0,write,log,0,4096
+0,write,a/one,0,1000
+0,write,tmp,0,512
+1,write,log,4096,4096
+1,read,tmp,0,512
+1,write,a/two,0,2000
+2,write,log,8192,4096
+2,delete,tmp,0,0
+2,write,a/one,1000,24
+3,read,log,0,12288
+3,delete,log,0,0
+4,write,log,0,100
+`, ReplayConfig{Workers: 4})
+
+	r.Run(context.Background())
+	counts := wait()
+
+	ExpectEqual(t, RunnerStopped, r.State())
+	ExpectEqual(t, "trace replay complete", drainDone())
+
+	expectObjectSize(t, root, "log", 100)
+	expectObjectSize(t, root, "a/one", 1024)
+	expectObjectSize(t, root, "a/two", 2000)
+
+	if _, err := os.Stat(filepath.Join(root, "tmp")); !os.IsNotExist(err) {
+		t.Errorf("tmp wasn't deleted: %v", err)
+	}
+
+	ExpectEqual(t, 8, counts[Write])
+	ExpectEqual(t, 2, counts[Read])
+	ExpectEqual(t, 2, counts[Delete])
+	ExpectEqual(t, 0, len(r.reporter.errorCounts))
+}
+
+func TestReplayer_Timed(t *testing.T) {
+	drainDone()
+	defer drainDone()
+
+	r, root, wait := testReplayer(t, `timestamp,op,object,offset,length
+10,write,a,0,100
+10.25,write,b,0,100
+10.5,write,a,100,100
+`, ReplayConfig{Workers: 2, Timed: true, Speed: 2})
+
+	ExpectEqual(t, time.Duration(0), r.due(&r.records[0]))
+	ExpectEqual(t, 125*time.Millisecond, r.due(&r.records[1]))
+	ExpectEqual(t, 250*time.Millisecond, r.due(&r.records[2]))
+
+	start := time.Now()
+	r.Run(context.Background())
+	elapsed := time.Since(start)
+	wait()
+
+	// At 2x speed the 0.5 sec trace takes 0.25 sec, and no less
+	if elapsed < 250*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("timed replay took %s, expected about 250ms", elapsed)
+	}
+
+	ExpectEqual(t, "trace replay complete", drainDone())
+	expectObjectSize(t, root, "a", 200)
+	expectObjectSize(t, root, "b", 100)
+}
+
+func TestReplayer_Cancel(t *testing.T) {
+	drainDone()
+	defer drainDone()
+
+	r, _, wait := testReplayer(t, `timestamp,op,object,offset,length
+0,write,a,0,100
+60,write,a,100,100
+`, ReplayConfig{Workers: 1, Timed: true, Speed: 1})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	r.Run(ctx)
+	wait()
+
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("cancelled replay took %s", elapsed)
+	}
+
+	// Cancelled, so not finished normally
+	ExpectEqual(t, "", drainDone())
+}
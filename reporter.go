@@ -2,26 +2,47 @@ package main
 
 import (
 	"context"
+	"encoding/csv"
+	"encoding/json"
 	"fmt"
+	"github.com/spf13/viper"
 	"go.uber.org/zap"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 const (
-	Read  = 0 // Match fio's read op
-	Write = 1 // Match fio's write op
+	Read   = 0 // Match fio's read op
+	Write  = 1 // Match fio's write op
+	Delete = 2 // Match fio's trim op
 )
 
+func opName(op int) string {
+	switch op {
+	case Read:
+		return "read"
+	case Write:
+		return "write"
+	case Delete:
+		return "delete"
+	default:
+		return fmt.Sprintf("op %d", op)
+	}
+}
+
 type ReporterConfig struct {
 	LatencyEnabled   bool
 	BandwidthEnabled bool
 	Interval         time.Duration
 	WarmUp           time.Duration
-	Capture          map[string]string // commands to run at startup
+	Capture          *CaptureConfig // nil for none
+	SystemPaths      []string       // paths whose block devices to sample, with CPU and page cache
 }
 
 type Sample struct {
@@ -29,6 +50,8 @@ type Sample struct {
 	Finish time.Time
 	Op     int
 	Size   int
+	Job    int    // index in global.Jobs, or -1 if not from a job's runner
+	Path   string // of the store, if known
 }
 
 type Reporter struct {
@@ -43,8 +66,62 @@ type Reporter struct {
 	writeBandwidth []int64
 	readTotal      int64
 	writeTotal     int64
+	deleteTotal    int64
+	opCounts       [3]int64           // by op
+	intervalOps    [3]int64           // by op
+	iops           [3][]float64       // by op, for each interval
+	latency        [3]*LatencyTracker // by op
 	bwlog          *os.File
 	latlog         *os.File
+	startTime      time.Time
+	stopTime       time.Time
+	dashboard      *Dashboard           // non-nil in TUI mode
+	paths          map[string]*opTotals // by path, for the dashboard
+	pathNames      []string             // in the order first seen
+	lock           sync.Mutex           // guards the below, which change between phases
+	jobs           []*opTotals          // per job, when there's more than one
+	syncers        []Syncer             // of the current jobs
+	jobNames       []string             // of the current jobs
+	phases         []*phaseTotals       // finished phases, then the current one
+	errorLock      sync.Mutex
+	errorCounts    map[errorKey]int64
+	verifyCounts   [verifyStatusCount]int64 // indexed by VerifyStatus
+}
+
+// opTotals accumulates the samples for one job or phase.
+type opTotals struct {
+	name           string
+	readBandwidth  []int64
+	writeBandwidth []int64
+	readTotal      int64
+	writeTotal     int64
+	deleteTotal    int64
+	opTotal        int64
+	intervalRead   int64
+	intervalWrite  int64
+	intervalOps    int64
+}
+
+// phaseTotals accumulates a phase's samples, and notices when it has
+// reached its byte or op limit.
+type phaseTotals struct {
+	opTotals
+	limitBytes int64
+	limitOps   int64
+	start      time.Time
+	finish     time.Time
+	opCounts   [3]int64           // by op
+	iops       [3][]float64       // by op, for each interval
+	latency    [3]*LatencyTracker // by op
+	jobs       []*opTotals
+	done       chan struct{} // closed when a limit is reached
+	reached    bool
+}
+
+// errorKey groups errors by op type and errno for the final breakdown.
+type errorKey struct {
+	op    int
+	errno string
 }
 
 func NewReporter(config *ReporterConfig) (r *Reporter, e error) {
@@ -54,7 +131,7 @@ func NewReporter(config *ReporterConfig) (r *Reporter, e error) {
 	r = &Reporter{
 		SugaredLogger: Logger(),
 		config:        config,
-		dir:           global.RunId,
+		dir:           global.RunDir,
 		stop: func() {
 			cancel()
 			wg.Wait()
@@ -68,6 +145,12 @@ func NewReporter(config *ReporterConfig) (r *Reporter, e error) {
 		},
 		readBandwidth:  make([]int64, 0, 1000),
 		writeBandwidth: make([]int64, 0, 1000),
+		paths:          make(map[string]*opTotals),
+		errorCounts:    make(map[errorKey]int64),
+	}
+
+	for op := range r.latency {
+		r.latency[op] = NewLatencyTracker()
 	}
 
 	if e = r.openFiles(); e != nil {
@@ -78,11 +161,15 @@ func NewReporter(config *ReporterConfig) (r *Reporter, e error) {
 		return nil, e
 	}
 
-	wg.Add(1)
+	wg.Add(2)
 	go func() {
 		r.Run(ctx)
 		wg.Done()
 	}()
+	go func() {
+		r.capturePeriodic(ctx)
+		wg.Done()
+	}()
 
 	return
 }
@@ -158,22 +245,24 @@ func copyFile(src string, dst string) (e error) {
 }
 
 func (r *Reporter) captureRunState() (e error) {
-	e = copyFile("config.json", filepath.Join(r.dir, "config.json"))
+	e = copyFile(viper.ConfigFileUsed(), filepath.Join(r.dir, "config.json"))
 	if e != nil {
 		return e
 	}
 
-	for file, command := range r.config.Capture {
-		var out []byte
+	// Along with every default and flag, as the run actually used it
+	resolved, e := json.MarshalIndent(viper.AllSettings(), "", "  ")
+	if e != nil {
+		return fmt.Errorf("cannot encode config: %s", e)
+	}
 
-		if out, e = RunCmd(command); e != nil {
-			return e
-		}
+	e = ioutil.WriteFile(filepath.Join(r.dir, "config-resolved.json"), append(resolved, '\n'), 0664)
+	if e != nil {
+		return fmt.Errorf("cannot write config-resolved.json: %s", e)
+	}
 
-		e = ioutil.WriteFile(filepath.Join(r.dir, file), out, 0664)
-		if e != nil {
-			return fmt.Errorf("cannot write %s: %s", file, e)
-		}
+	if r.config.Capture != nil {
+		r.capture(context.Background(), "before", r.config.Capture.Before)
 	}
 
 	return nil
@@ -186,8 +275,40 @@ func (r *Reporter) PreStop() {
 
 func (r *Reporter) Stop() {
 	r.stop()
+	r.stopTime = time.Now()
 	r.Infof("stopped")
 
+	if r.config.Capture != nil {
+		r.capture(context.Background(), "after", r.config.Capture.After)
+	}
+
+	r.lock.Lock()
+
+	// Sync times since the last periodic report
+	for _, s := range r.syncers {
+		s.Report()
+	}
+
+	if len(r.phases) > 0 {
+		r.phases[len(r.phases)-1].finish = time.Now()
+
+		for i, p := range r.phases {
+			p.report(r, i)
+		}
+
+		r.Infof("all phases:")
+	} else {
+		for _, j := range r.jobs {
+			j.report(r, "job ")
+		}
+
+		if len(r.jobs) > 0 {
+			r.Infof("all jobs:")
+		}
+	}
+
+	r.lock.Unlock()
+
 	if r.readTotal > 0 {
 		r.Infof("read bandwidth (median): %s/sec", SprintSize(Median(r.readBandwidth)))
 		r.Infof("read bandwidth (mean): %s/sec", SprintSize(Mean(r.readBandwidth)))
@@ -199,11 +320,201 @@ func (r *Reporter) Stop() {
 		r.Infof("write bandwidth (mean): %s/sec", SprintSize(Mean(r.writeBandwidth)))
 		r.Infof("total written: %s", SprintSize(r.writeTotal))
 	}
+
+	if r.deleteTotal > 0 {
+		r.Infof("total deleted: %d objects", r.deleteTotal)
+	}
+
+	for op, l := range r.latency {
+		if l.Count() > 0 {
+			r.Infof("%s latency: %s", opName(op), l)
+		}
+	}
+
+	r.reportVerify()
+	r.reportErrors()
+}
+
+// Summary returns the run's results, once the reporter has stopped.
+func (r *Reporter) Summary() *RunSummary {
+	s := &RunSummary{
+		RunId: global.RunId,
+		Seed:  global.Seed,
+		Ops:   make(map[string]*OpSummary),
+	}
+
+	var elapsed time.Duration
+	if !r.startTime.IsZero() {
+		elapsed = r.stopTime.Sub(r.startTime)
+		s.Duration = elapsed.Seconds()
+	}
+
+	if r.opCounts[Read] > 0 {
+		s.Ops[opName(Read)] = newOpSummary(r.opCounts[Read], r.readTotal, elapsed, r.readBandwidth, r.iops[Read], r.latency[Read])
+	}
+	if r.opCounts[Write] > 0 {
+		s.Ops[opName(Write)] = newOpSummary(r.opCounts[Write], r.writeTotal, elapsed, r.writeBandwidth, r.iops[Write], r.latency[Write])
+	}
+	if r.opCounts[Delete] > 0 {
+		s.Ops[opName(Delete)] = newOpSummary(r.opCounts[Delete], 0, elapsed, nil, r.iops[Delete], r.latency[Delete])
+	}
+
+	r.lock.Lock()
+	for _, p := range r.phases {
+		s.Phases = append(s.Phases, p.summary(r.startTime))
+	}
+	r.lock.Unlock()
+
+	return s
+}
+
+// CaptureVerify counts the outcome of verifying an object read back.
+func (r *Reporter) CaptureVerify(result *VerifyResult) {
+	atomic.AddInt64(&r.verifyCounts[result.Status], 1)
+}
+
+func (r *Reporter) reportVerify() {
+	total := int64(0)
+	for i := range r.verifyCounts {
+		total += atomic.LoadInt64(&r.verifyCounts[i])
+	}
+
+	if total == 0 {
+		return
+	}
+
+	r.Infof("verified objects: %d", total)
+
+	for status := VerifyIntact; status < verifyStatusCount; status++ {
+		if count := atomic.LoadInt64(&r.verifyCounts[status]); count > 0 {
+			r.Infof("  %s: %d", status, count)
+		}
+	}
+}
+
+// CaptureError counts a failed op. Unlike samples, errors are counted
+// even during warm-up and after PreStop so the final breakdown is complete.
+func (r *Reporter) CaptureError(op int, e error) {
+	key := errorKey{op, errnoName(e)}
+
+	r.errorLock.Lock()
+	r.errorCounts[key]++
+	r.errorLock.Unlock()
+}
+
+func (r *Reporter) reportErrors() {
+	r.errorLock.Lock()
+	defer r.errorLock.Unlock()
+
+	if len(r.errorCounts) == 0 {
+		return
+	}
+
+	keys := make([]errorKey, 0, len(r.errorCounts))
+	total := int64(0)
+
+	for key, count := range r.errorCounts {
+		keys = append(keys, key)
+		total += count
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].op != keys[j].op {
+			return keys[i].op < keys[j].op
+		}
+		return keys[i].errno < keys[j].errno
+	})
+
+	r.Infof("errors: %d total", total)
+
+	for _, key := range keys {
+		r.Infof("  %s %s: %d", opName(key.op), key.errno, r.errorCounts[key])
+	}
+}
+
+// SetJobs sets the jobs being run, whose syncers are reported on and whose
+// results are reported separately as well as in aggregate (if there's more
+// than one). With phases, each phase has its own jobs.
+func (r *Reporter) SetJobs(jobs []*Job) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.jobs = nil
+	r.syncers = make([]Syncer, len(jobs))
+	r.jobNames = make([]string, len(jobs))
+
+	for i, job := range jobs {
+		r.syncers[i] = job.Syncer
+		r.jobNames[i] = job.Name
+	}
+
+	if len(jobs) > 1 {
+		r.jobs = make([]*opTotals, len(jobs))
+		for i, job := range jobs {
+			r.jobs[i] = &opTotals{name: job.Name}
+		}
+	}
+
+	if len(r.phases) > 0 {
+		r.phases[len(r.phases)-1].jobs = r.jobs
+	}
+}
+
+// BeginPhase finishes the current phase, if any, logging its results, and
+// starts counting for the next. The returned channel is closed when the
+// phase has read and written limitBytes or done limitOps ops (if not 0).
+func (r *Reporter) BeginPhase(name string, limitBytes, limitOps int64) <-chan struct{} {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	now := time.Now()
+
+	if n := len(r.phases); n > 0 {
+		p := r.phases[n-1]
+		p.finish = now
+		p.report(r, n-1)
+	}
+
+	p := &phaseTotals{
+		opTotals:   opTotals{name: name},
+		limitBytes: limitBytes,
+		limitOps:   limitOps,
+		start:      now,
+		done:       make(chan struct{}),
+	}
+
+	for op := range p.latency {
+		p.latency[op] = NewLatencyTracker()
+	}
+
+	r.phases = append(r.phases, p)
+
+	if r.bwlog != nil {
+		elapsed := 0.0
+		if !r.startTime.IsZero() {
+			elapsed = now.Sub(r.startTime).Seconds()
+		}
+		fmt.Fprintf(r.bwlog, "# phase, %.3f, %s\n", elapsed, csvField(name))
+	}
+
+	return p.done
+}
+
+// csvField returns s as a CSV field, quoted if it has to be, so a phase
+// name with a comma or quote doesn't break the bandwidth log.
+func csvField(s string) string {
+	var b strings.Builder
+	w := csv.NewWriter(&b)
+	_ = w.Write([]string{s})
+	w.Flush()
+	return strings.TrimSuffix(b.String(), "\n")
 }
 
 func (r *Reporter) GetSample() *Sample {
 	s := r.samplePool.Get().(*Sample)
 	s.Start = time.Now()
+	s.Job = -1
+	s.Path = ""
 	return s
 }
 
@@ -214,6 +525,12 @@ func (r *Reporter) CaptureSample(s *Sample, size int, op int) {
 	r.samples <- s
 }
 
+// DiscardSample returns a sample from GetSample that turned out not to
+// time an op.
+func (r *Reporter) DiscardSample(s *Sample) {
+	r.samplePool.Put(s)
+}
+
 func (r *Reporter) Run(ctx context.Context) {
 	defer r.closeFiles()
 
@@ -226,9 +543,23 @@ func (r *Reporter) Run(ctx context.Context) {
 	r.Infof("reporter running")
 	intervalReadBytes := int64(0)
 	intervalWriteBytes := int64(0)
+	intervalDeletes := int64(0)
 	startTime := time.Now()
 	lastReportTime := startTime
 
+	r.lock.Lock()
+	r.startTime = startTime
+	r.lock.Unlock()
+
+	// The paths exist by now, since the runners' stores have been created
+	var system *SystemMonitor
+	if len(r.config.SystemPaths) > 0 {
+		var e error
+		if system, e = NewSystemMonitor("/proc", r.config.SystemPaths); e != nil {
+			r.Infof("not sampling system stats: %s", e)
+		}
+	}
+
 	t := time.NewTicker(r.config.Interval)
 	t2 := time.NewTicker(time.Second * 10)
 
@@ -247,10 +578,35 @@ func (r *Reporter) Run(ctx context.Context) {
 			case Write:
 				intervalWriteBytes += int64(sample.Size)
 				r.writeTotal += int64(sample.Size)
+			case Delete:
+				intervalDeletes++
+				r.deleteTotal++
 			default:
 				r.Errorf("unknown op: %d", sample.Op)
 			}
 
+			if sample.Op >= Read && sample.Op <= Delete {
+				r.opCounts[sample.Op]++
+				r.intervalOps[sample.Op]++
+				r.latency[sample.Op].Add(sample.Finish.Sub(sample.Start))
+			}
+
+			r.lock.Lock()
+
+			if sample.Job >= 0 && sample.Job < len(r.jobs) {
+				r.jobs[sample.Job].add(sample)
+			}
+
+			if len(r.phases) > 0 {
+				r.phases[len(r.phases)-1].add(sample)
+			}
+
+			r.lock.Unlock()
+
+			if r.dashboard != nil && len(sample.Path) > 0 {
+				r.pathTotals(sample.Path).add(sample)
+			}
+
 			if r.latlog != nil && !r.preStop && sample.Size > 0 {
 				fmt.Fprintf(r.latlog, "%.3f, %.6f, %d, %d\n",
 					sample.Finish.Sub(startTime).Seconds(),
@@ -281,24 +637,286 @@ func (r *Reporter) Run(ctx context.Context) {
 					r.Infof("write bandwidth: %s/sec", SprintSize(writeBandwidth))
 				}
 
+				if intervalDeletes > 0 {
+					r.Infof("delete rate:     %.0f/sec", float64(intervalDeletes)/interval)
+				}
+
+				for op := range r.iops {
+					r.iops[op] = append(r.iops[op], float64(r.intervalOps[op])/interval)
+				}
+
+				r.lock.Lock()
+
 				if r.bwlog != nil {
 					fmt.Fprintf(r.bwlog, "%.3f, %d, %d\n", tick.Sub(startTime).Seconds(), Read, readBandwidth)
 					fmt.Fprintf(r.bwlog, "%.3f, %d, %d\n", tick.Sub(startTime).Seconds(), Write, writeBandwidth)
 				}
+
+				for _, j := range r.jobs {
+					j.interval(r, interval, "job "+j.name)
+				}
+
+				if len(r.phases) > 0 {
+					r.phases[len(r.phases)-1].interval(r, interval, r.intervalOps)
+				}
+
+				r.lock.Unlock()
+
+				if system != nil {
+					if s, e := system.Sample(tick); e != nil {
+						r.Warnf("cannot sample system stats: %s; stopping", e)
+						system = nil
+					} else {
+						r.logSystem(s)
+					}
+				}
+
+				if r.dashboard != nil {
+					r.dashboard.Update(r.dashboardStats(interval))
+				}
+			}
+
+			if r.preStop {
+				r.lock.Lock()
+				for _, j := range r.jobs {
+					j.resetInterval()
+				}
+				r.lock.Unlock()
 			}
 
 			lastReportTime = tick
+			r.intervalOps = [3]int64{}
 			intervalWriteBytes = int64(0)
 			intervalReadBytes = int64(0)
+			intervalDeletes = int64(0)
 
 		case <-t2.C:
 			if !r.preStop {
-				global.Syncer.Report()
+				r.lock.Lock()
+				syncers := r.syncers
+				r.lock.Unlock()
+
+				for _, s := range syncers {
+					s.Report()
+				}
 			}
 		}
 	}
 }
 
+// logSystem logs what the kernel saw over the interval: each device's
+// throughput, utilization and queue depth, then CPU and page cache.
+func (r *Reporter) logSystem(s *SystemStats) {
+	for _, d := range s.Devices {
+		r.Infof("device %s: read %s/sec, write %s/sec, %.0f iops, %.0f%% util, queue %.1f",
+			d.Name, SprintSize(d.ReadBandwidth), SprintSize(d.WriteBandwidth),
+			d.ReadIOPS+d.WriteIOPS, d.Utilization, d.QueueDepth)
+	}
+
+	r.Infof("cpu: %.0f%% user, %.0f%% system, %.0f%% iowait; dirty %s, writeback %s",
+		s.CPU.User, s.CPU.System, s.CPU.IOWait, SprintSize(s.Memory.Dirty), SprintSize(s.Memory.Writeback))
+}
+
+// ShowOn sends the stats for each interval to a dashboard. It must be
+// called before the run starts.
+func (r *Reporter) ShowOn(d *Dashboard) {
+	r.dashboard = d
+}
+
+func (r *Reporter) pathTotals(path string) *opTotals {
+	p := r.paths[path]
+
+	if p == nil {
+		p = &opTotals{name: path}
+		r.paths[path] = p
+		r.pathNames = append(r.pathNames, path)
+	}
+
+	return p
+}
+
+// dashboardStats collects the stats for the interval just recorded, and
+// starts the next interval for each path.
+func (r *Reporter) dashboardStats(interval float64) *DashboardStats {
+	s := &DashboardStats{}
+	last := len(r.readBandwidth) - 1
+
+	s.Ops[Read].Bandwidth = r.readBandwidth[last]
+	s.Ops[Read].MeanBandwidth = Mean(r.readBandwidth)
+	s.Ops[Write].Bandwidth = r.writeBandwidth[last]
+	s.Ops[Write].MeanBandwidth = Mean(r.writeBandwidth)
+
+	for op := range s.Ops {
+		o := &s.Ops[op]
+		o.Count = r.opCounts[op]
+		o.IOPS = r.iops[op][last]
+		o.MeanIOPS, _ = meanVariance(r.iops[op])
+		o.MaxLatency = r.latency[op].Max()
+
+		for _, p := range Percentiles {
+			o.Latency = append(o.Latency, r.latency[op].Percentile(p))
+		}
+	}
+
+	for _, name := range r.pathNames {
+		p := r.paths[name]
+		s.Paths = append(s.Paths, DashboardPath{
+			Path:  name,
+			Read:  int64(float64(p.intervalRead) / interval),
+			Write: int64(float64(p.intervalWrite) / interval),
+			IOPS:  float64(p.intervalOps) / interval,
+		})
+		p.resetInterval()
+	}
+
+	r.lock.Lock()
+
+	if n := len(r.phases); n > 0 {
+		s.Phase = fmt.Sprintf("phase %d (%s)", n, r.phases[n-1].name)
+	}
+
+	for i, syncer := range r.syncers {
+		if b, ok := syncer.(*SyncBatcher); ok {
+			s.Syncers = append(s.Syncers, DashboardSyncer{Job: r.jobNames[i], Queued: b.QueueDepth()})
+		}
+	}
+
+	r.lock.Unlock()
+
+	r.errorLock.Lock()
+	for _, count := range r.errorCounts {
+		s.Errors += count
+	}
+	r.errorLock.Unlock()
+
+	return s
+}
+
+func (j *opTotals) add(s *Sample) {
+	j.opTotal++
+	j.intervalOps++
+
+	switch s.Op {
+	case Read:
+		j.intervalRead += int64(s.Size)
+		j.readTotal += int64(s.Size)
+	case Write:
+		j.intervalWrite += int64(s.Size)
+		j.writeTotal += int64(s.Size)
+	case Delete:
+		j.deleteTotal++
+	}
+}
+
+// interval records the bandwidth for an interval, logging it with label
+// unless that's empty.
+func (j *opTotals) interval(r *Reporter, interval float64, label string) {
+	readBandwidth := int64(float64(j.intervalRead) / interval)
+	writeBandwidth := int64(float64(j.intervalWrite) / interval)
+	j.readBandwidth = append(j.readBandwidth, readBandwidth)
+	j.writeBandwidth = append(j.writeBandwidth, writeBandwidth)
+
+	if len(label) > 0 && j.intervalOps > 0 {
+		r.Infof("%s: read %s/sec, write %s/sec, %.0f ops/sec", label,
+			SprintSize(readBandwidth), SprintSize(writeBandwidth), float64(j.intervalOps)/interval)
+	}
+
+	j.resetInterval()
+}
+
+func (j *opTotals) resetInterval() {
+	j.intervalRead, j.intervalWrite, j.intervalOps = 0, 0, 0
+}
+
+func (j *opTotals) report(r *Reporter, prefix string) {
+	r.Infof("%s%s: %d ops", prefix, j.name, j.opTotal)
+	j.reportBandwidth(r, "  ")
+}
+
+func (j *opTotals) reportBandwidth(r *Reporter, indent string) {
+	if j.readTotal > 0 {
+		r.Infof("%sread bandwidth (median): %s/sec, (mean): %s/sec, total: %s", indent,
+			SprintSize(Median(j.readBandwidth)), SprintSize(Mean(j.readBandwidth)), SprintSize(j.readTotal))
+	}
+
+	if j.writeTotal > 0 {
+		r.Infof("%swrite bandwidth (median): %s/sec, (mean): %s/sec, total: %s", indent,
+			SprintSize(Median(j.writeBandwidth)), SprintSize(Mean(j.writeBandwidth)), SprintSize(j.writeTotal))
+	}
+
+	if j.deleteTotal > 0 {
+		r.Infof("%sdeleted: %d objects", indent, j.deleteTotal)
+	}
+}
+
+func (p *phaseTotals) add(s *Sample) {
+	p.opTotals.add(s)
+
+	if s.Op >= Read && s.Op <= Delete {
+		p.opCounts[s.Op]++
+		p.latency[s.Op].Add(s.Finish.Sub(s.Start))
+	}
+
+	if p.reached {
+		return
+	}
+
+	if (p.limitBytes > 0 && p.readTotal+p.writeTotal >= p.limitBytes) || (p.limitOps > 0 && p.opTotal >= p.limitOps) {
+		p.reached = true
+		close(p.done)
+	}
+}
+
+// interval records the phase's bandwidth and the IOPS of each op for an
+// interval; ops is the number of each op in it.
+func (p *phaseTotals) interval(r *Reporter, interval float64, ops [3]int64) {
+	p.opTotals.interval(r, interval, "")
+
+	for op := range p.iops {
+		p.iops[op] = append(p.iops[op], float64(ops[op])/interval)
+	}
+}
+
+// summary returns the phase's results, for the run summary. runStart is
+// when the reporter started, which phase starts are relative to.
+func (p *phaseTotals) summary(runStart time.Time) PhaseSummary {
+	elapsed := p.finish.Sub(p.start)
+
+	s := PhaseSummary{
+		Name:     p.name,
+		Duration: elapsed.Seconds(),
+		Ops:      make(map[string]*OpSummary),
+	}
+
+	if !runStart.IsZero() {
+		s.Start = p.start.Sub(runStart).Seconds()
+	}
+
+	if p.opCounts[Read] > 0 {
+		s.Ops[opName(Read)] = newOpSummary(p.opCounts[Read], p.readTotal, elapsed, p.readBandwidth, p.iops[Read], p.latency[Read])
+	}
+	if p.opCounts[Write] > 0 {
+		s.Ops[opName(Write)] = newOpSummary(p.opCounts[Write], p.writeTotal, elapsed, p.writeBandwidth, p.iops[Write], p.latency[Write])
+	}
+	if p.opCounts[Delete] > 0 {
+		s.Ops[opName(Delete)] = newOpSummary(p.opCounts[Delete], 0, elapsed, nil, p.iops[Delete], p.latency[Delete])
+	}
+
+	return s
+}
+
+// report logs the phase's results: the same as for the whole run, but
+// with each job indented beneath it.
+func (p *phaseTotals) report(r *Reporter, i int) {
+	r.Infof("phase %d (%s): %.1f sec, %d ops", i+1, p.name, p.finish.Sub(p.start).Seconds(), p.opTotal)
+	p.reportBandwidth(r, "  ")
+
+	for _, j := range p.jobs {
+		r.Infof("  job %s: %d ops", j.name, j.opTotal)
+		j.reportBandwidth(r, "    ")
+	}
+}
+
 // warmUp simply delays reporting until the warm-up time is complete, giving runners some time to get to speed.
 func (r *Reporter) warmUp(ctx context.Context) error {
 	warmUp := r.config.WarmUp
@@ -2,33 +2,104 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"go.uber.org/zap"
 	"io"
 	"math/rand"
+	"sync/atomic"
+	"syscall"
+	"time"
 )
 
+// RunnerState is what a runner is doing, as shown on the dashboard.
+type RunnerState int32
+
+const (
+	RunnerWaiting   RunnerState = iota // for the run to start
+	RunnerRunning                      // doing ops
+	RunnerThrottled                    // waiting for its job's rate limit
+	RunnerSyncing                      // waiting for a sync
+	RunnerBackoff                      // waiting to retry after an error
+	RunnerIdle                         // its path is full, or nothing to read yet
+	RunnerStopped
+	runnerStateCount
+)
+
+func (s RunnerState) String() string {
+	switch s {
+	case RunnerWaiting:
+		return "waiting"
+	case RunnerRunning:
+		return "running"
+	case RunnerThrottled:
+		return "throttled"
+	case RunnerSyncing:
+		return "syncing"
+	case RunnerBackoff:
+		return "backoff"
+	case RunnerIdle:
+		return "idle"
+	case RunnerStopped:
+		return "stopped"
+	default:
+		return fmt.Sprintf("state %d", int(s))
+	}
+}
+
 type Runner struct {
 	*zap.SugaredLogger
+	job          *Job
 	objectStore  ObjectStore
 	objectVendor *ObjectVendor
+	generator    *ObjectGenerator
 	reporter     *Reporter
 	syncer       Syncer
 	syncWhen     SyncWhen
 	iosize       int64
+	errorPolicy  *ErrorPolicy
 	errchan      chan error
+	fill         *FillPath // non-nil in fill mode
+	verifyMode   VerifyMode
+	verifier     *ObjectVerifier
+	ops          *rand.Rand
+	placement    *rand.Rand
+	pick         *rand.Rand
+	trace        *TraceBuffer // nil unless recording a trace
+	path         string       // the store's, for per-path stats
+	state        int32        // a RunnerState
 }
 
-func NewRunner(os ObjectStore, n int) (*Runner, error) {
+// noObjectsWait is how long a read-only runner waits for objects to read
+// before trying again.
+const noObjectsWait = 100 * time.Millisecond
+
+// NewRunner creates runner n (unique across all jobs) for a job.
+func NewRunner(job *Job, os ObjectStore, n int) (*Runner, error) {
 	r := &Runner{
-		SugaredLogger: Logger().With(zap.Int("id", n)),
+		SugaredLogger: job.With(zap.Int("id", n)),
+		job:           job,
 		objectStore:   os,
-		objectVendor:  global.ObjectVendor,
+		objectVendor:  job.ObjectVendor,
+		generator:     job.ObjectVendor.NewGenerator(n),
 		reporter:      global.Reporter,
-		syncer:        global.Syncer,
-		syncWhen:      global.SyncWhen,
-		iosize:        global.IoSize,
+		syncer:        job.Syncer,
+		syncWhen:      job.SyncWhen,
+		iosize:        job.IoSize,
+		errorPolicy:   global.ErrorPolicy,
 		errchan:       global.RunnerError,
+		verifyMode:    global.VerifyMode,
+		ops:           newStreamRand(global.Seed, n, seedStreamOps),
+		placement:     newStreamRand(global.Seed, n, seedStreamPlacement),
+		pick:          newStreamRand(global.Seed, n, seedStreamPick),
+	}
+
+	if r.verifyMode != VerifyOff {
+		r.verifier = NewObjectVerifier()
+	}
+
+	if global.Recorder != nil {
+		r.trace = global.Recorder.NewBuffer(n)
 	}
 
 	r.Infof("creating runner")
@@ -37,9 +108,15 @@ func NewRunner(os ObjectStore, n int) (*Runner, error) {
 }
 
 func (r *Runner) Run(ctx context.Context) {
+	defer r.setState(RunnerStopped)
+
 	<-global.Start
 
 	r.Infof("running")
+	r.setState(RunnerRunning)
+	defer r.trace.Flush()
+	failures := 0
+	waiting := false // for objects to read
 
 	for {
 		select {
@@ -47,40 +124,115 @@ func (r *Runner) Run(ctx context.Context) {
 			return
 
 		default:
-			if err := r.Op(ctx); err != nil {
+			if r.fill != nil && r.fill.Full() {
+				r.Infof("path full, runner idle")
+				r.setState(RunnerIdle)
+				<-ctx.Done()
+				return
+			}
+
+			op, err := r.Op(ctx)
+
+			if errors.Is(err, errNoObjects) {
+				// A read-only job before anything has been written to
+				// its path: not an error, but nothing to do yet
+				if !waiting {
+					r.Warnf("no objects to read yet; waiting")
+					waiting = true
+				}
+				r.setState(RunnerIdle)
+				select {
+				case <-ctx.Done():
+				case <-time.After(noObjectsWait):
+				}
+				r.setState(RunnerRunning)
+				continue
+			}
+
+			r.errorPolicy.CountOp()
+
+			if err == nil {
+				failures = 0
+				continue
+			}
+
+			if ctx.Err() != nil {
+				return // error caused by shutdown
+			}
+
+			if r.fill != nil && errors.Is(err, syscall.ENOSPC) {
+				r.fill.OutOfSpace() // expected in fill mode, not an error
+				continue
+			}
+
+			failures++
+			r.reporter.CaptureError(op, err)
+
+			fatal := err
+			if !isVerifyError(err) {
+				// Verify errors are only returned in abort mode, so always stop.
+				r.setState(RunnerBackoff)
+				fatal = r.errorPolicy.Handle(ctx, err, failures)
+				r.setState(RunnerRunning)
+			}
+
+			if fatal != nil {
+				// Block until the error is taken; main will stop the run.
 				select {
-				case r.errchan <- err:
-					// error sent
-				default:
-					// error chan was full, discard
+				case r.errchan <- fatal:
+				case <-ctx.Done():
 				}
+				return
 			}
+
+			r.Warnf("%s error (%s, continuing): %s", opName(op), errnoName(err), err)
 		}
 	}
 }
 
-func (r *Runner) Op(ctx context.Context) error {
-	if global.ReadPercent == 0 {
-		return r.WriteObject(ctx)
-	} else if global.ReadPercent == 100 {
-		return r.ReadObject(ctx)
-	} else {
-		if rand.Intn(100) < global.ReadPercent {
-			return r.ReadObject(ctx)
-		} else {
-			return r.WriteObject(ctx)
+// Op performs a single read or write, returning which op was attempted
+// along with any error.
+func (r *Runner) Op(ctx context.Context) (int, error) {
+	if r.fill != nil && r.fill.Churning() {
+		// With nothing to delete (e.g. the store was empty when it got
+		// full enough to churn), just write
+		if e := r.DeleteObject(ctx); e != nil && !errors.Is(e, errNoObjects) {
+			return Delete, e
+		}
+		return Write, r.WriteObject(ctx)
+	}
+
+	if r.chooseOp() == Read {
+		// With nothing to read yet, write, unless the job only reads
+		if e := r.ReadObject(ctx); !errors.Is(e, errNoObjects) || r.job.ReadPercent == 100 {
+			return Read, e
 		}
 	}
+
+	return Write, r.WriteObject(ctx)
+}
+
+// chooseOp picks read or write according to the read percent.
+func (r *Runner) chooseOp() int {
+	if r.job.ReadPercent == 0 {
+		return Write
+	} else if r.job.ReadPercent == 100 {
+		return Read
+	} else if r.ops.Intn(100) < r.job.ReadPercent {
+		return Read
+	} else {
+		return Write
+	}
 }
 
 func (r *Runner) WriteObject(ctx context.Context) (e error) {
-	blk := r.objectVendor.GetObject()
+	blk := r.generator.GetObject()
 	defer r.objectVendor.ReturnObject(blk)
 
-	wr, e := r.objectStore.GetWriter(fmt.Sprintf("%s.%s", blk.Id.String(), blk.Extension))
+	wr, e := r.objectStore.GetWriter(fmt.Sprintf("%s.%s", blk.Id.String(), blk.Extension), r.placement)
 
 	if e != nil {
-		return fmt.Errorf("cannot get block writer: %s", e)
+		return fmt.Errorf("cannot get block writer: %w", e)
 	}
 
 	defer func() {
@@ -104,9 +256,19 @@ func (r *Runner) WriteObject(ctx context.Context) (e error) {
 			iosize = remaining
 		}
 
-		sample := r.reporter.GetSample()
+		if e = r.throttle(ctx, iosize); e != nil {
+			return
+		}
+
+		sample := r.getSample()
+		start := sample.Start
 		bw, e = wr.Write(blk.Data[offset : offset+iosize])
 		r.reporter.CaptureSample(sample, bw, Write)
+		r.trace.Record(Write, wr.Object(), int64(offset), bw, start, e)
+
+		if r.fill != nil {
+			r.fill.AddBytes(bw)
+		}
 
 		remaining -= bw
 		offset += iosize
@@ -123,7 +285,7 @@ func (r *Runner) WriteObject(ctx context.Context) (e error) {
 		}
 
 		if r.syncWhen == SyncOnWrite {
-			if e = r.syncer.Sync(wr); e != nil {
+			if e = r.sync(wr); e != nil {
 				r.Errorf("sync: %s", e)
 				return
 			}
@@ -131,7 +293,7 @@ func (r *Runner) WriteObject(ctx context.Context) (e error) {
 	}
 
 	if r.syncWhen == SyncOnClose {
-		e = r.syncer.Sync(wr)
+		e = r.sync(wr)
 	}
 
 	// r.Infof("wrote block '%s'", blk.Id)
@@ -139,8 +301,33 @@ func (r *Runner) WriteObject(ctx context.Context) (e error) {
 	return
 }
 
+func (r *Runner) DeleteObject(ctx context.Context) (e error) {
+	if e = r.throttle(ctx, 0); e != nil {
+		return
+	}
+
+	sample := r.getSample()
+	start := sample.Start
+	name, e := r.objectStore.DeleteRandomObject(r.pick)
+	if errors.Is(e, errNoObjects) {
+		return e // nothing was deleted, so it's not counted as an op
+	}
+
+	r.reporter.CaptureSample(sample, 0, Delete)
+
+	if len(name) > 0 {
+		r.trace.Record(Delete, name, 0, 0, start, e)
+	}
+
+	if e != nil {
+		return fmt.Errorf("cannot delete object: %w", e)
+	}
+
+	return nil
+}
+
 func (r *Runner) ReadObject(ctx context.Context) (e error) {
-	name, e := r.objectStore.RandomExistingObjectName()
+	name, e := r.objectStore.RandomExistingObjectName(r.pick)
 
 	if e != nil {
 		return e
@@ -149,7 +336,7 @@ func (r *Runner) ReadObject(ctx context.Context) (e error) {
 	rr, e := r.objectStore.GetReader(name)
 
 	if e != nil {
-		return fmt.Errorf("cannot get block reader: %s", e)
+		return fmt.Errorf("cannot get block reader: %w", e)
 	}
 
 	defer func() {
@@ -162,12 +349,49 @@ func (r *Runner) ReadObject(ctx context.Context) (e error) {
 
 	buf := make([]byte, int(r.iosize))
 
+	if r.verifier != nil {
+		r.verifier.Reset()
+
+		// Objects written by this run always have a header
+		if !r.objectStore.Scanned(name) {
+			r.verifier.ExpectHeader()
+		}
+	}
+
+	offset := int64(0)
+
 	for len(ctx.Done()) == 0 {
 		var br int
 
-		sample := r.reporter.GetSample()
+		// The size of a read isn't known until it's done, so it's charged
+		// to the byte limit afterwards.
+		if e = r.throttle(ctx, 0); e != nil {
+			return
+		}
+
+		sample := r.getSample()
+		start := sample.Start
 		br, e = rr.Read(buf)
-		r.reporter.CaptureSample(sample, br, Read)
+
+		// Finding the end of the object isn't another read
+		if br == 0 && e == io.EOF {
+			r.reporter.DiscardSample(sample)
+		} else {
+			r.reporter.CaptureSample(sample, br, Read)
+		}
+
+		if le := r.job.ByteLimit.Wait(ctx, br); le != nil {
+			return le
+		}
+
+		if br > 0 || (e != nil && e != io.EOF) {
+			r.trace.Record(Read, name, offset, br, start, e)
+			offset += int64(br)
+		}
+
+		if r.verifier != nil && br > 0 {
+			_, _ = r.verifier.Write(buf[:br])
+		}
 
 		if e == io.EOF {
 			e = nil
@@ -179,5 +403,68 @@ func (r *Runner) ReadObject(ctx context.Context) (e error) {
 		}
 	}
 
+	if r.verifier != nil && len(ctx.Done()) == 0 {
+		return r.verifyObject(name)
+	}
+
+	return nil
+}
+
+// getSample starts timing an op for this runner's job and path.
+func (r *Runner) getSample() *Sample {
+	s := r.reporter.GetSample()
+	s.Job = r.job.Id
+	s.Path = r.path
+	return s
+}
+
+// State returns what the runner is doing.
+func (r *Runner) State() RunnerState {
+	return RunnerState(atomic.LoadInt32(&r.state))
+}
+
+func (r *Runner) setState(s RunnerState) {
+	atomic.StoreInt32(&r.state, int32(s))
+}
+
+// throttle waits until the job's rate limits allow another op of size
+// bytes.
+func (r *Runner) throttle(ctx context.Context, size int) error {
+	if r.job.OpLimit == nil && r.job.ByteLimit == nil {
+		return nil
+	}
+
+	r.setState(RunnerThrottled)
+	defer r.setState(RunnerRunning)
+
+	if e := r.job.OpLimit.Wait(ctx, 1); e != nil {
+		return e
+	}
+	return r.job.ByteLimit.Wait(ctx, size)
+}
+
+func (r *Runner) sync(wr ObjectWriter) error {
+	r.setState(RunnerSyncing)
+	defer r.setState(RunnerRunning)
+
+	return r.syncer.Sync(wr)
+}
+
+// verifyObject checks the result of verifying the object just read. A
+// mismatch is only returned as an error in abort mode.
+func (r *Runner) verifyObject(name string) error {
+	result := r.verifier.Finish()
+	r.reporter.CaptureVerify(&result)
+
+	switch result.Status {
+	case VerifyTruncated, VerifyCorrupted:
+		ve := &VerifyError{Name: name, Result: result}
+		r.Errorf("%s", ve)
+
+		if r.verifyMode == VerifyAbort {
+			return ve
+		}
+	}
+
 	return nil
 }
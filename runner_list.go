@@ -2,46 +2,123 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"go.uber.org/zap"
 	"sync"
 )
 
+// Runnable is anything a RunnerList can run, e.g. a Runner or Replayer.
+// Run should wait for global.Start before doing any work.
+type Runnable interface {
+	Run(ctx context.Context)
+}
+
+// preparer is implemented by Runnables with work to do before the run
+// starts (after the setup command), which isn't timed.
+type preparer interface {
+	Prepare() error
+}
+
+// stateful is implemented by Runnables that report what they're doing.
+type stateful interface {
+	State() RunnerState
+}
+
 type RunnerList struct {
 	*zap.SugaredLogger
-	runners     []*Runner
-	stores      []ObjectStore
-	setupCmd    string
-	teardownCmd string
+	lock        sync.Mutex // guards runners, which change between phases
+	runners     []Runnable
+	stores      map[string]ObjectStore // by path
+	setupCmd    *Command               // nil if none
+	teardownCmd *Command
 	stop        func()
 }
 
-func NewRunnerList(setupCmd, teardownCmd string) *RunnerList {
+func NewRunnerList(setupCmd, teardownCmd *Command) *RunnerList {
 	return &RunnerList{
 		SugaredLogger: Logger(),
-		runners:       make([]*Runner, 0),
-		stores:        make([]ObjectStore, 0),
+		runners:       make([]Runnable, 0),
+		stores:        make(map[string]ObjectStore),
 		setupCmd:      setupCmd,
 		teardownCmd:   teardownCmd,
 	}
 }
 
-func (rl *RunnerList) AddRunner(r *Runner) {
+func (rl *RunnerList) AddRunner(r Runnable) {
+	rl.lock.Lock()
 	rl.runners = append(rl.runners, r)
+	rl.lock.Unlock()
+}
+
+// States counts the current runners by state. Runners that don't report
+// their state count as running.
+func (rl *RunnerList) States() [runnerStateCount]int {
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+
+	var counts [runnerStateCount]int
+
+	for _, r := range rl.runners {
+		if s, ok := r.(stateful); ok {
+			counts[s.State()]++
+		} else {
+			counts[RunnerRunning]++
+		}
+	}
+
+	return counts
+}
+
+// AddStore adds the store for a path, which runners added later (e.g. in
+// later phases) can find with Store.
+func (rl *RunnerList) AddStore(path string, s ObjectStore) {
+	rl.stores[path] = s
 }
 
-func (rl *RunnerList) AddStore(s ObjectStore) {
-	rl.stores = append(rl.stores, s)
+// Store returns the store for a path, or nil if there isn't one yet.
+func (rl *RunnerList) Store(path string) ObjectStore {
+	return rl.stores[path]
 }
 
 func (rl *RunnerList) Start() error {
-	if len(rl.setupCmd) > 0 {
-		rl.Infof("running: %s", rl.setupCmd)
-		if out, e := RunCmd(rl.setupCmd); e != nil {
-			rl.Errorf("setup: %s", out)
+	if rl.setupCmd != nil {
+		if e := rl.runCmd("setup", rl.setupCmd); e != nil {
 			return e
 		}
 	}
 
+	return rl.launch()
+}
+
+// NextPhase stops the current runners and clears the list, so the next
+// phase's runners can be added and then started with Resume. Stores are
+// kept, and the setup and teardown commands aren't run.
+func (rl *RunnerList) NextPhase() {
+	rl.stopRunners()
+
+	rl.lock.Lock()
+	rl.runners = nil
+	rl.lock.Unlock()
+}
+
+// Resume starts the runners added since NextPhase.
+func (rl *RunnerList) Resume() error {
+	return rl.launch()
+}
+
+func (rl *RunnerList) launch() error {
+	rl.lock.Lock()
+	runners := rl.runners
+	rl.lock.Unlock()
+
+	for _, runner := range runners {
+		if p, ok := runner.(preparer); ok {
+			if e := p.Prepare(); e != nil {
+				return e
+			}
+		}
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	var wg sync.WaitGroup
 	rl.stop = func() {
@@ -49,9 +126,9 @@ func (rl *RunnerList) Start() error {
 		wg.Wait()
 	}
 
-	for _, runner := range rl.runners {
+	for _, runner := range runners {
 		wg.Add(1)
-		go func(r *Runner) {
+		go func(r Runnable) {
 			r.Run(ctx)
 			wg.Done()
 		}(runner)
@@ -62,17 +139,37 @@ func (rl *RunnerList) Start() error {
 }
 
 func (rl *RunnerList) Stop() {
+	rl.stopRunners()
+
+	if rl.teardownCmd != nil {
+		if e := rl.runCmd("teardown", rl.teardownCmd); e != nil {
+			rl.Errorf(e.Error())
+		}
+	}
+}
+
+// runCmd runs the setup or teardown command, saving its output in the run
+// directory as setup.stdout, setup.stderr and so on.
+func (rl *RunnerList) runCmd(phase string, c *Command) error {
+	rl.Infof("running %s: %s", phase, c)
+
+	stdout, stderr, e := c.Run(context.Background(), phase)
+
+	if se := saveCommandOutput(phase, stdout, stderr); se != nil {
+		rl.Warnf(se.Error())
+	}
+
+	if e != nil {
+		return fmt.Errorf("%s: %s", phase, e)
+	}
+
+	return nil
+}
+
+func (rl *RunnerList) stopRunners() {
 	if rl.stop != nil {
 		rl.stop()
 		rl.stop = nil
 		rl.Infof("stopped")
 	}
-
-	if len(rl.teardownCmd) > 0 {
-		rl.Infof("running: %s", rl.teardownCmd)
-
-		if out, e := RunCmd(rl.teardownCmd); e != nil {
-			rl.Errorf("teardown: %s", out)
-		}
-	}
 }
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/oklog/ulid/v2"
+)
+
+func TestRunner_ReproducibleOps(t *testing.T) {
+	vendor, err := NewObjectVendor("4KB/30:64KB/30:1MB/40", DataConfig{Compressibility: 50}, 42)
+	AbortOnError(t, err)
+
+	defer func(seed uint64) {
+		global.Seed = seed
+	}(global.Seed)
+
+	global.Seed = 42
+	job := &Job{SugaredLogger: Logger(), Name: "test", ObjectVendor: vendor, ReadPercent: 50}
+
+	a, err := NewRunner(job, nil, 3)
+	AbortOnError(t, err)
+	b, err := NewRunner(job, nil, 3)
+	AbortOnError(t, err)
+	other, err := NewRunner(job, nil, 4)
+	AbortOnError(t, err)
+
+	same := 0
+
+	for i := 0; i < 1000; i++ {
+		op := a.chooseOp()
+		ExpectEqual(t, op, b.chooseOp())
+
+		if op == other.chooseOp() {
+			same++
+		}
+	}
+
+	if same == 1000 {
+		t.Errorf("runners 3 and 4 chose identical op sequences")
+	}
+
+	for i := 0; i < 50; i++ {
+		blkA := a.generator.GetObject()
+		blkB := b.generator.GetObject()
+
+		ExpectEqual(t, len(blkA.Data), len(blkB.Data))
+		ExpectEqual(t, crc32.ChecksumIEEE(blkA.Data), crc32.ChecksumIEEE(blkB.Data))
+
+		vendor.ReturnObject(blkA)
+		vendor.ReturnObject(blkB)
+	}
+
+	ExpectEqual(t, a.placement.Int63(), b.placement.Int63())
+	ExpectEqual(t, a.pick.Int63(), b.pick.Int63())
+}
+
+func TestRunner_ReadObject(t *testing.T) {
+	vendor, err := NewObjectVendor("4KB", DataConfig{Compressibility: 50}, 42)
+	AbortOnError(t, err)
+
+	defer func(r *Reporter) { global.Reporter = r }(global.Reporter)
+	global.Reporter = &Reporter{
+		SugaredLogger: Logger(),
+		samples:       make(chan *Sample, 10),
+		samplePool:    sync.Pool{New: func() interface{} { return &Sample{} }},
+	}
+
+	root := t.TempDir()
+	AbortOnError(t, os.WriteFile(filepath.Join(root, "a.dat"), make([]byte, 3000), 0644))
+	store := &FileObjectStore{root: root, index: make(map[string]int)}
+	store.addObject("a.dat")
+
+	// The whole object in one read, then EOF, which isn't an op
+	job := &Job{SugaredLogger: Logger(), Name: "test", ObjectVendor: vendor, ReadPercent: 100, IoSize: 4096}
+	r, err := NewRunner(job, store, 1)
+	AbortOnError(t, err)
+	AbortOnError(t, r.ReadObject(context.Background()))
+
+	ExpectEqual(t, 1, len(global.Reporter.samples))
+	s := <-global.Reporter.samples
+	ExpectEqual(t, Read, s.Op)
+	ExpectEqual(t, 3000, s.Size)
+
+	// Smaller reads each count
+	job.IoSize = 1024
+	r, err = NewRunner(job, store, 2)
+	AbortOnError(t, err)
+	AbortOnError(t, r.ReadObject(context.Background()))
+	ExpectEqual(t, 3, len(global.Reporter.samples))
+}
+
+func TestRunner_VerifyNoHeader(t *testing.T) {
+	vendor, err := NewObjectVendor("4KB", DataConfig{Compressibility: 50}, 42)
+	AbortOnError(t, err)
+
+	defer func(r *Reporter, mode VerifyMode) {
+		global.Reporter, global.VerifyMode = r, mode
+	}(global.Reporter, global.VerifyMode)
+	global.VerifyMode = VerifyAbort
+	global.Reporter = &Reporter{
+		SugaredLogger: Logger(),
+		samples:       make(chan *Sample, 10),
+		samplePool:    sync.Pool{New: func() interface{} { return &Sample{} }},
+	}
+
+	// One object from before the run, and one it wrote, both zeroed
+	root := t.TempDir()
+	old, written := ulid.Make().String()+".dat", ulid.Make().String()+".dat"
+	AbortOnError(t, os.WriteFile(filepath.Join(root, old), make([]byte, 4096), 0644))
+	store, err := NewFileObjectStore(root, 0, true)
+	AbortOnError(t, err)
+	AbortOnError(t, os.WriteFile(filepath.Join(root, written), make([]byte, 4096), 0644))
+	store.(*FileObjectStore).addObject(written)
+
+	ExpectEqual(t, true, store.Scanned(old))
+	ExpectEqual(t, false, store.Scanned(written))
+
+	job := &Job{SugaredLogger: Logger(), Name: "test", ObjectVendor: vendor, ReadPercent: 100, IoSize: 4096}
+	r, err := NewRunner(job, store, 1)
+	AbortOnError(t, err)
+
+	// Reads pick objects at random, so read until both have been seen
+	var errs []error
+	for i := 0; i < 100 && (global.Reporter.verifyCounts[VerifyUnverifiable] == 0 || len(errs) == 0); i++ {
+		if err := r.ReadObject(context.Background()); err != nil {
+			errs = append(errs, err)
+		}
+		for len(global.Reporter.samples) > 0 {
+			<-global.Reporter.samples
+		}
+	}
+
+	ExpectEqual(t, true, global.Reporter.verifyCounts[VerifyUnverifiable] > 0)
+	ExpectEqual(t, true, len(errs) > 0)
+	for _, err := range errs {
+		ExpectEqual(t, "verify "+written+": corrupted: no object header", err.Error())
+	}
+
+	// Deleting a scanned object forgets it
+	AbortOnError(t, store.DeleteObject(old))
+	ExpectEqual(t, false, store.Scanned(old))
+}
+
+func TestRunner_NothingToRead(t *testing.T) {
+	vendor, err := NewObjectVendor("4KB", DataConfig{Compressibility: 50}, 42)
+	AbortOnError(t, err)
+	policy, err := NewErrorPolicy("continue")
+	AbortOnError(t, err)
+
+	start := make(chan struct{})
+	close(start)
+
+	defer func(r *Reporter, p *ErrorPolicy, s chan struct{}) {
+		global.Reporter, global.ErrorPolicy, global.Start = r, p, s
+	}(global.Reporter, global.ErrorPolicy, global.Start)
+	global.ErrorPolicy, global.Start = policy, start
+	global.Reporter = &Reporter{
+		SugaredLogger: Logger(),
+		samples:       make(chan *Sample, 10),
+		samplePool:    sync.Pool{New: func() interface{} { return &Sample{} }},
+		errorCounts:   make(map[errorKey]int64),
+	}
+
+	store, err := NewFileObjectStore(t.TempDir(), 0, false)
+	AbortOnError(t, err)
+
+	// A mixed job writes instead
+	job := &Job{SugaredLogger: Logger(), Name: "test", ObjectVendor: vendor, ReadPercent: 99, IoSize: 4096}
+	r, err := NewRunner(job, store, 1)
+	AbortOnError(t, err)
+
+	op, err := r.Op(context.Background())
+	AbortOnError(t, err)
+	ExpectEqual(t, Write, op)
+	_, err = store.RandomExistingObjectName(r.pick)
+	AbortOnError(t, err)
+
+	// A read-only job waits, without counting errors
+	store, err = NewFileObjectStore(t.TempDir(), 0, false)
+	AbortOnError(t, err)
+	job.ReadPercent = 100
+	r, err = NewRunner(job, store, 2)
+	AbortOnError(t, err)
+
+	op, err = r.Op(context.Background())
+	ExpectEqual(t, Read, op)
+	ExpectEqual(t, true, errors.Is(err, errNoObjects))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*noObjectsWait)
+	defer cancel()
+	r.Run(ctx)
+
+	ExpectEqual(t, RunnerStopped, r.State())
+	ExpectEqual(t, 0, len(global.Reporter.errorCounts))
+	ExpectEqual(t, int64(0), policy.ops)
+}
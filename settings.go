@@ -0,0 +1,424 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// settingKind is the type of value a setting takes.
+type settingKind int
+
+const (
+	kindString   settingKind = iota
+	kindInt                  // whole number
+	kindFloat                // any number
+	kindBool                 // true or false
+	kindSize                 // bytes, e.g. 64KB
+	kindDuration             // e.g. 10s
+	kindList                 // list of strings
+	kindCommand              // shell command string, or list of program and arguments
+	kindMap                  // object with keys of its own choosing
+	kindSettings             // list of settings objects (jobs, phases)
+)
+
+// settingScope is where a setting may be given: at the top level of the
+// config, in a job, or in a phase.
+type settingScope int
+
+const (
+	inRun settingScope = 1 << iota
+	inJob
+	inPhase
+
+	inAny = inRun | inJob | inPhase
+)
+
+type settingSpec struct {
+	kind  settingKind
+	scope settingScope
+}
+
+// knownSettings are all the settings perftest reads, by lowercase name.
+// Job settings can also be given at the top level, as defaults for every
+// job, and in a phase, to override every job's.
+var knownSettings = map[string]settingSpec{
+	"name":                     {kindString, inAny},
+	"jobs":                     {kindSettings, inRun},
+	"phases":                   {kindSettings, inRun},
+	"duration":                 {kindDuration, inRun | inPhase},
+	"bytes":                    {kindSize, inPhase},
+	"ops":                      {kindInt, inPhase},
+	"runid":                    {kindString, inRun},
+	"seed":                     {kindInt, inRun},
+	"tui":                      {kindBool, inRun},
+	"subdirs":                  {kindInt, inRun},
+	"verify":                   {kindString, inRun},
+	"iosize":                   {kindSize, inAny},
+	"read":                     {kindInt, inAny},
+	"size":                     {kindString, inAny},
+	"compress_mode":            {kindString, inAny},
+	"compressibility":          {kindInt, inAny},
+	"data.pattern":             {kindString, inAny},
+	"data.repeat":              {kindString, inAny},
+	"data.corpus":              {kindString, inAny},
+	"dedupe_percent":           {kindInt, inAny},
+	"dedupe_block_size":        {kindSize, inAny},
+	"dedupe_pool":              {kindInt, inAny},
+	"file.paths":               {kindList, inAny},
+	"file.runners_per_path":    {kindInt, inAny},
+	"file.sync":                {kindString, inAny},
+	"file.sync_on":             {kindString, inAny},
+	"file.open_flags":          {kindList, inRun},
+	"file.manifest":            {kindBool, inRun},
+	"file.setup":               {kindCommand, inRun},
+	"file.setup.command":       {kindCommand, inRun},
+	"file.setup.timeout":       {kindDuration, inRun},
+	"file.teardown":            {kindCommand, inRun},
+	"file.teardown.command":    {kindCommand, inRun},
+	"file.teardown.timeout":    {kindDuration, inRun},
+	"sync_batcher.max_wait":    {kindDuration, inAny},
+	"sync_batcher.max_pending": {kindInt, inAny},
+	"rate.iops":                {kindFloat, inAny},
+	"rate.bandwidth":           {kindSize, inAny},
+	"errors.policy":            {kindString, inRun},
+	"errors.retries":           {kindInt, inRun},
+	"errors.backoff":           {kindDuration, inRun},
+	"errors.max_backoff":       {kindDuration, inRun},
+	"errors.max_errors":        {kindInt, inRun},
+	"errors.max_rate":          {kindFloat, inRun},
+	"errors.min_ops":           {kindInt, inRun},
+	"fill.enabled":             {kindBool, inRun},
+	"fill.target":              {kindFloat, inRun},
+	"fill.churn_at":            {kindFloat, inRun},
+	"fill.interval":            {kindDuration, inRun},
+	"replay.trace":             {kindString, inRun},
+	"replay.path":              {kindString, inRun},
+	"replay.timing":            {kindString, inRun},
+	"replay.speed":             {kindFloat, inRun},
+	"replay.workers":           {kindInt, inRun},
+	"replay.sync":              {kindBool, inRun},
+	"replay.prepare":           {kindBool, inRun},
+	"reporter.interval":        {kindDuration, inRun},
+	"reporter.warmup":          {kindDuration, inRun},
+	"reporter.loglatency":      {kindBool, inRun},
+	"reporter.logbandwidth":    {kindBool, inRun},
+	"reporter.logtrace":        {kindBool, inRun},
+	"reporter.logsystem":       {kindBool, inRun},
+	"reporter.capture":         {kindMap, inRun},
+	"sweep.matrix":             {kindMap, inRun},
+	"sweep.duration":           {kindDuration, inRun},
+}
+
+// checkSettings rejects settings perftest doesn't know, settings given
+// where they'd have no effect, and values that aren't the right type, any
+// of which viper would otherwise quietly ignore or read as zero.
+func checkSettings() error {
+	keys := viper.AllKeys()
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if err := checkSetting(key, viper.Get(key), inRun); err != nil {
+			return err
+		}
+	}
+
+	for _, list := range []struct {
+		key   string
+		name  string
+		scope settingScope
+	}{
+		{"jobs", "job", inJob},
+		{"phases", "phase", inPhase},
+	} {
+		entries, _ := viper.Get(list.key).([]interface{})
+
+		for i, entry := range entries {
+			settings, ok := entry.(map[string]interface{})
+			if !ok {
+				continue // jobConfigs and parsePhases say what's wrong
+			}
+
+			flat := make(map[string]interface{})
+			flattenSettings("", settings, flat)
+
+			keys := make([]string, 0, len(flat))
+			for key := range flat {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+
+			for _, key := range keys {
+				if err := checkSetting(key, flat[key], list.scope); err != nil {
+					return fmt.Errorf("%s %d: %s", list.name, i+1, err)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// flattenSettings adds settings to flat with dotted, lowercase keys, the
+// way viper names them.
+func flattenSettings(prefix string, settings map[string]interface{}, flat map[string]interface{}) {
+	for key, value := range settings {
+		key = prefix + strings.ToLower(key)
+
+		if m, ok := value.(map[string]interface{}); ok && len(m) > 0 {
+			if spec, ok := knownSettings[key]; !ok || spec.kind != kindMap {
+				flattenSettings(key+".", m, flat)
+				continue
+			}
+		}
+
+		flat[key] = value
+	}
+}
+
+// checkSetting checks one setting, given in scope.
+func checkSetting(key string, value interface{}, scope settingScope) error {
+	spec, ok := lookupSetting(key)
+
+	if !ok {
+		// An empty section, e.g. "reporter": {}
+		if m, isMap := value.(map[string]interface{}); isMap && len(m) == 0 && isSection(key) {
+			return nil
+		}
+
+		if suggestion := closestSetting(key); len(suggestion) > 0 {
+			return fmt.Errorf("unknown setting '%s' (did you mean %s?)", key, suggestion)
+		}
+		return fmt.Errorf("unknown setting '%s'", key)
+	}
+
+	if spec.scope&scope == 0 {
+		switch scope {
+		case inJob:
+			return fmt.Errorf("'%s' can't be set in a job", key)
+		case inPhase:
+			return fmt.Errorf("'%s' can't be set in a phase", key)
+		default:
+			return fmt.Errorf("'%s' can only be set in a phase", key)
+		}
+	}
+
+	if _, exact := knownSettings[key]; !exact && spec.kind == kindMap {
+		return nil // an entry in the map, e.g. a capture command
+	}
+
+	if expected := checkValue(spec.kind, value); len(expected) > 0 {
+		return fmt.Errorf("invalid %s %s: expected %s", key, formatValue(value), expected)
+	}
+
+	return nil
+}
+
+// lookupSetting finds the spec for key, which may be an entry in one of
+// the settings that's a map.
+func lookupSetting(key string) (settingSpec, bool) {
+	if spec, ok := knownSettings[key]; ok {
+		return spec, true
+	}
+
+	for name, spec := range knownSettings {
+		if spec.kind == kindMap && strings.HasPrefix(key, name+".") {
+			return spec, true
+		}
+	}
+
+	return settingSpec{}, false
+}
+
+// isSection returns whether key is the start of known settings, e.g.
+// "reporter".
+func isSection(key string) bool {
+	for name := range knownSettings {
+		if strings.HasPrefix(name, key+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// checkValue returns what was expected if value isn't of the given kind,
+// or an empty string if it is. Like viper, it accepts strings that convert.
+func checkValue(kind settingKind, value interface{}) string {
+	s, isString := value.(string)
+
+	switch kind {
+	case kindString:
+		switch value.(type) {
+		case string, bool, int, int32, int64, uint64, float64:
+			return ""
+		}
+		return "a string"
+
+	case kindInt:
+		if f, ok := toFloat(value); ok && f == math.Trunc(f) {
+			return ""
+		}
+		if _, e := strconv.ParseInt(strings.TrimSpace(s), 10, 64); isString && e == nil {
+			return ""
+		}
+		return "a whole number"
+
+	case kindFloat:
+		if _, ok := toFloat(value); ok {
+			return ""
+		}
+		if _, e := strconv.ParseFloat(strings.TrimSpace(s), 64); isString && e == nil {
+			return ""
+		}
+		return "a number"
+
+	case kindBool:
+		if _, ok := value.(bool); ok {
+			return ""
+		}
+		if _, e := strconv.ParseBool(s); isString && e == nil {
+			return ""
+		}
+		return "true or false"
+
+	case kindSize:
+		if f, ok := toFloat(value); ok && f == math.Trunc(f) {
+			return ""
+		}
+		if _, e := parseSizeInBytes(s); isString && e == nil {
+			return ""
+		}
+		return "a size such as 64KB"
+
+	case kindDuration:
+		if f, ok := toFloat(value); ok && f == math.Trunc(f) {
+			return "" // nanoseconds, as viper reads them
+		}
+		if _, e := time.ParseDuration(s); isString && e == nil {
+			return ""
+		}
+		return "a duration such as 10s"
+
+	case kindList:
+		if isString {
+			return "" // viper splits it on spaces
+		}
+		if list, ok := value.([]interface{}); ok {
+			for _, entry := range list {
+				if _, ok := entry.(string); !ok {
+					return "a list of strings"
+				}
+			}
+			return ""
+		}
+		if _, ok := value.([]string); ok {
+			return ""
+		}
+		return "a list of strings"
+
+	case kindCommand:
+		if isString || len(checkValue(kindList, value)) == 0 {
+			return ""
+		}
+		return "a command string or a list of strings"
+
+	case kindMap:
+		if _, ok := value.(map[string]interface{}); ok {
+			return ""
+		}
+		return "an object"
+	}
+
+	return "" // kindSettings: jobConfigs and parsePhases check these
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+// formatValue quotes a value for an error message.
+func formatValue(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return "'" + s + "'"
+	}
+	if b, e := json.Marshal(value); e == nil {
+		return string(b)
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// closestSetting suggests known settings for a misspelled or misplaced
+// key, or returns an empty string if none is close.
+func closestSetting(key string) string {
+	names := make([]string, 0, len(knownSettings))
+	for name := range knownSettings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// e.g. "sync" for "file.sync"
+	var sections []string
+	for _, name := range names {
+		if strings.HasSuffix(name, "."+key) {
+			sections = append(sections, "'"+name+"'")
+		}
+	}
+
+	if len(sections) > 0 {
+		return strings.Join(sections, " or ")
+	}
+
+	best, bestDistance := "", len(key)/3+1
+
+	for _, name := range names {
+		if d := editDistance(key, name); d < bestDistance {
+			best, bestDistance = "'"+name+"'", d
+		}
+	}
+
+	return best
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+
+		prev, cur = cur, prev
+	}
+
+	return prev[len(b)]
+}
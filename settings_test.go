@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestCheckSettings(t *testing.T) {
+	defer viper.Reset()
+
+	for _, c := range []struct {
+		config   string
+		expected string // the error, or empty if valid
+	}{
+		{`{"iosize": "64KB", "reporter": {"interval": "1s", "capture": {"df.txt": "df -h"}}}`, ""},
+		{`{"reporter": {}, "file": {"paths": "/mnt/a /mnt/b", "open_flags": ["sync"]}}`, ""},
+		{`{"read": "30", "rate": {"iops": 2.5}, "fill": {"enabled": "true"}, "duration": 1000000000}`, ""},
+		{`{"jobs": [{"name": "a", "file": {"sync": "batch"}}], "phases": [{"bytes": "1GB", "ops": 10}]}`, ""},
+		{`{"sweep": {"matrix": {"iosize": ["4KB", "1MB"]}}}`, ""},
+		{`{"file": {"setup": ["mount", "/mnt"], "teardown": {"command": "umount /mnt", "timeout": "1m"}}}`, ""},
+		{`{"file": {"setup": {"comand": "mount /mnt"}}}`, "unknown setting 'file.setup.comand' (did you mean 'file.setup.command'?)"},
+		{`{"file": {"teardown": 12}}`, "invalid file.teardown 12: expected a command string or a list of strings"},
+		{`{"file": {"snyc": "batch"}}`, "unknown setting 'file.snyc' (did you mean 'file.sync'?)"},
+		{`{"interval": "1s"}`, "unknown setting 'interval' (did you mean 'fill.interval' or 'reporter.interval'?)"},
+		{`{"frobnicate": true}`, "unknown setting 'frobnicate'"},
+		{`{"jobs": [{"reporter": {}, "bogus": {}}]}`, "job 1: unknown setting 'bogus'"},
+		{`{"bytes": "1GB"}`, "'bytes' can only be set in a phase"},
+		{`{"jobs": [{"name": "a"}, {"duration": "1s"}]}`, "job 2: 'duration' can't be set in a job"},
+		{`{"phases": [{"errors": {"policy": "continue"}}]}`, "phase 1: 'errors.policy' can't be set in a phase"},
+		{`{"phases": [{"Read": 50, "file": {"sinc": "inline"}}]}`, "phase 1: unknown setting 'file.sinc' (did you mean 'file.sync'?)"},
+		{`{"iosize": "64KiB"}`, "invalid iosize '64KiB': expected a size such as 64KB"},
+		{`{"read": 12.5}`, "invalid read 12.5: expected a whole number"},
+		{`{"rate": {"iops": "lots"}}`, "invalid rate.iops 'lots': expected a number"},
+		{`{"tui": "yes please"}`, "invalid tui 'yes please': expected true or false"},
+		{`{"duration": "10 minutes"}`, "invalid duration '10 minutes': expected a duration such as 10s"},
+		{`{"file": {"paths": [1, 2]}}`, "invalid file.paths [1,2]: expected a list of strings"},
+		{`{"file": {"paths": {"a": "b"}}}`, "unknown setting 'file.paths.a' (did you mean 'file.paths'?)"},
+		{`{"size": ["4MB"]}`, `invalid size ["4MB"]: expected a string`},
+		{`{"reporter": {"capture": "df -h"}}`, "invalid reporter.capture 'df -h': expected an object"},
+	} {
+		viper.Reset()
+		readTestConfig(t, c.config)
+
+		err := checkSettings()
+
+		if len(c.expected) == 0 {
+			AbortOnErrorf(t, err, "%s", c.config)
+		} else if err == nil || err.Error() != c.expected {
+			t.Errorf("%s: expected %q, got %v", c.config, c.expected, err)
+		}
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	ExpectEqual(t, 0, editDistance("sync", "sync"))
+	ExpectEqual(t, 2, editDistance("snyc", "sync"))
+	ExpectEqual(t, 1, editDistance("iosiz", "iosize"))
+	ExpectEqual(t, 4, editDistance("", "read"))
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// SizeDist is a distribution of object sizes, one per size spec entry.
+type SizeDist interface {
+	Sample(rng *rand.Rand) int
+	Max() int // largest size Sample can return
+	String() string
+}
+
+// parseSizeDist parses the size part of a size spec entry:
+//
+//	4MB                       fixed size
+//	4KB-1MB                   uniform between the two, inclusive
+//	lognormal(median,sigma)   log-normal with the given median and sigma (of the log)
+//	pareto(min,alpha)         Pareto with the given minimum and shape
+//	exponential(mean)         exponential with the given mean
+//	file(path)                read from a file (see parseSizeFile)
+//
+// The named distributions take an optional last argument giving the largest
+// size to generate; samples above it are drawn again. By default it's far
+// enough out in the tail (e.g. median*e^(4*sigma)) to make little practical
+// difference, but no more than defaultMaxSize: a runner needs a buffer as
+// big as the largest object it draws.
+func parseSizeDist(spec string) (SizeDist, error) {
+	if open := strings.IndexByte(spec, '('); open >= 0 {
+		if !strings.HasSuffix(spec, ")") {
+			return nil, fmt.Errorf("malformed distribution '%s'; should be name(args)", spec)
+		}
+
+		name := strings.ToLower(strings.TrimSpace(spec[:open]))
+		args := strings.Split(spec[open+1:len(spec)-1], ",")
+
+		switch name {
+		case "lognormal":
+			return parseLognormal(spec, args)
+		case "pareto":
+			return parsePareto(spec, args)
+		case "exponential", "exp":
+			return parseExponential(spec, args)
+		case "file":
+			return parseSizeFile(spec, args)
+		default:
+			return nil, fmt.Errorf("unknown distribution '%s'; use lognormal, pareto, exponential, or file", name)
+		}
+	}
+
+	if dash := strings.IndexByte(spec, '-'); dash > 0 {
+		min, err := parseDistSize(spec[:dash])
+		if err != nil {
+			return nil, err
+		}
+
+		max, err := parseDistSize(spec[dash+1:])
+		if err != nil {
+			return nil, err
+		}
+
+		if max < min {
+			return nil, fmt.Errorf("size range '%s' ends before it starts", spec)
+		}
+
+		return uniformSize{min, max}, nil
+	}
+
+	size, err := parseDistSize(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	return fixedSize(size), nil
+}
+
+// parseDistSize parses a size, which must be above 0.
+func parseDistSize(s string) (int, error) {
+	size, err := parseSizeInBytes(s)
+
+	if err != nil {
+		return 0, fmt.Errorf("cannot parse block size spec: %s", err)
+	} else if size <= 0 {
+		return 0, fmt.Errorf("block size '%s' must be above 0", strings.TrimSpace(s))
+	}
+
+	return int(size), nil
+}
+
+// parseDistArgs checks a distribution has between min and max arguments.
+func parseDistArgs(spec string, args []string, min, max int) error {
+	if len(args) < min || len(args) > max || (len(args) == 1 && len(strings.TrimSpace(args[0])) == 0) {
+		return fmt.Errorf("wrong number of arguments in '%s'", spec)
+	}
+	return nil
+}
+
+func parseDistParam(spec, name, s string) (float64, error) {
+	v, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+
+	if err != nil || v <= 0 || math.IsInf(v, 0) {
+		return 0, fmt.Errorf("%s in '%s' must be a number above 0", name, spec)
+	}
+
+	return v, nil
+}
+
+// defaultMaxSize is the largest size a named distribution or size file
+// generates unless it's given a maximum of its own.
+const defaultMaxSize = 1 << 30
+
+// parseDistMax parses the optional maximum size argument, or returns
+// defaultMax (up to defaultMaxSize) if there isn't one.
+func parseDistMax(spec string, args []string, n int, min int, defaultMax float64) (int, error) {
+	if len(args) <= n {
+		max := math.Min(math.Ceil(defaultMax), defaultMaxSize)
+		if max < float64(min) {
+			max = float64(min)
+		}
+		return int(max), nil
+	}
+
+	max, err := parseDistSize(args[n])
+	if err != nil {
+		return 0, err
+	}
+
+	if max < min {
+		return 0, fmt.Errorf("maximum size in '%s' is below the minimum", spec)
+	}
+
+	return max, nil
+}
+
+func parseLognormal(spec string, args []string) (SizeDist, error) {
+	if err := parseDistArgs(spec, args, 2, 3); err != nil {
+		return nil, err
+	}
+
+	median, err := parseDistSize(args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	sigma, err := parseDistParam(spec, "sigma", args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	max, err := parseDistMax(spec, args, 2, 1, float64(median)*math.Exp(4*sigma))
+	if err != nil {
+		return nil, err
+	}
+
+	return lognormalSize{mu: math.Log(float64(median)), sigma: sigma, max: max}, nil
+}
+
+func parsePareto(spec string, args []string) (SizeDist, error) {
+	if err := parseDistArgs(spec, args, 2, 3); err != nil {
+		return nil, err
+	}
+
+	min, err := parseDistSize(args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	alpha, err := parseDistParam(spec, "alpha", args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	// By default, cut off the rarest 0.01%
+	max, err := parseDistMax(spec, args, 2, min, float64(min)*math.Pow(10000, 1/alpha))
+	if err != nil {
+		return nil, err
+	}
+
+	return paretoSize{min: min, alpha: alpha, max: max}, nil
+}
+
+func parseExponential(spec string, args []string) (SizeDist, error) {
+	if err := parseDistArgs(spec, args, 1, 2); err != nil {
+		return nil, err
+	}
+
+	mean, err := parseDistSize(args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	max, err := parseDistMax(spec, args, 1, 1, float64(mean)*10)
+	if err != nil {
+		return nil, err
+	}
+
+	return exponentialSize{mean: float64(mean), max: max}, nil
+}
+
+type fixedSize int
+
+func (d fixedSize) Sample(rng *rand.Rand) int { return int(d) }
+func (d fixedSize) Max() int                  { return int(d) }
+func (d fixedSize) String() string            { return SprintSize(int64(d)) }
+
+type uniformSize struct {
+	min, max int
+}
+
+func (d uniformSize) Sample(rng *rand.Rand) int {
+	return d.min + int(rng.Int63n(int64(d.max-d.min)+1))
+}
+
+func (d uniformSize) Max() int { return d.max }
+
+func (d uniformSize) String() string {
+	return fmt.Sprintf("%s-%s", SprintSize(int64(d.min)), SprintSize(int64(d.max)))
+}
+
+// sampleTruncated draws from sample until the result is between min and
+// max. If that takes too long (the range is far out in a tail), it settles
+// for clamping.
+func sampleTruncated(min, max int, sample func() float64) int {
+	var x float64
+
+	for try := 0; try < 100; try++ {
+		x = math.Round(sample())
+		if x >= float64(min) && x <= float64(max) {
+			return int(x)
+		}
+	}
+
+	return int(math.Max(float64(min), math.Min(x, float64(max))))
+}
+
+type lognormalSize struct {
+	mu, sigma float64
+	max       int
+}
+
+func (d lognormalSize) Sample(rng *rand.Rand) int {
+	return sampleTruncated(1, d.max, func() float64 {
+		return math.Exp(d.mu + d.sigma*rng.NormFloat64())
+	})
+}
+
+func (d lognormalSize) Max() int { return d.max }
+
+func (d lognormalSize) String() string {
+	return fmt.Sprintf("lognormal(median %s, sigma %g, max %s)",
+		SprintSize(int64(math.Exp(d.mu))), d.sigma, SprintSize(int64(d.max)))
+}
+
+type paretoSize struct {
+	min   int
+	alpha float64
+	max   int
+}
+
+func (d paretoSize) Sample(rng *rand.Rand) int {
+	return sampleTruncated(d.min, d.max, func() float64 {
+		// Inverse CDF; 1-Float64() is in (0, 1] so never divides by zero
+		return float64(d.min) / math.Pow(1-rng.Float64(), 1/d.alpha)
+	})
+}
+
+func (d paretoSize) Max() int { return d.max }
+
+func (d paretoSize) String() string {
+	return fmt.Sprintf("pareto(min %s, alpha %g, max %s)",
+		SprintSize(int64(d.min)), d.alpha, SprintSize(int64(d.max)))
+}
+
+type exponentialSize struct {
+	mean float64
+	max  int
+}
+
+func (d exponentialSize) Sample(rng *rand.Rand) int {
+	return sampleTruncated(1, d.max, func() float64 {
+		return rng.ExpFloat64() * d.mean
+	})
+}
+
+func (d exponentialSize) Max() int { return d.max }
+
+func (d exponentialSize) String() string {
+	return fmt.Sprintf("exponential(mean %s, max %s)", SprintSize(int64(d.mean)), SprintSize(int64(d.max)))
+}
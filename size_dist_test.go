@@ -0,0 +1,166 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+const distSamples = 200_000
+
+func sampleDist(t *testing.T, spec string) []int {
+	dist, err := parseSizeDist(spec)
+	AbortOnErrorf(t, err, "parse '%s'", spec)
+
+	rng := rand.New(rand.NewSource(1))
+	samples := make([]int, distSamples)
+
+	for i := range samples {
+		samples[i] = dist.Sample(rng)
+
+		if samples[i] < 1 || samples[i] > dist.Max() {
+			t.Fatalf("%s: sample %d outside 1-%d", spec, samples[i], dist.Max())
+		}
+	}
+
+	sort.Ints(samples)
+	return samples
+}
+
+// fractionBelow returns the fraction of sorted samples below x.
+func fractionBelow(samples []int, x float64) float64 {
+	return float64(sort.SearchInts(samples, int(math.Ceil(x)))) / float64(len(samples))
+}
+
+func expectNear(t *testing.T, what string, want, got, tolerance float64) {
+	t.Helper()
+	if math.Abs(want-got) > tolerance {
+		t.Errorf("%s: expected %.4f ±%.4f, got %.4f", what, want, tolerance, got)
+	}
+}
+
+func TestSizeDist_Fixed(t *testing.T) {
+	samples := sampleDist(t, "64KB")
+	ExpectEqual(t, 65536, samples[0])
+	ExpectEqual(t, 65536, samples[len(samples)-1])
+}
+
+func TestSizeDist_Uniform(t *testing.T) {
+	min, max := 4096, 1<<20
+	samples := sampleDist(t, "4KB-1MB")
+
+	// Each tenth of the range should hold a tenth of the samples.
+	for i := 1; i < 10; i++ {
+		x := float64(min) + float64(max-min)*float64(i)/10
+		expectNear(t, "uniform CDF", float64(i)/10, fractionBelow(samples, x), 0.005)
+	}
+
+	if samples[0] < min || samples[len(samples)-1] > max {
+		t.Errorf("uniform: samples outside range")
+	}
+}
+
+func TestSizeDist_Lognormal(t *testing.T) {
+	median, sigma := 65536.0, 1.5
+	samples := sampleDist(t, "lognormal(64KB,1.5)")
+
+	// Standard normal CDF at -2..2 sigma
+	for _, z := range []float64{-2, -1, 0, 1, 2} {
+		want := 0.5 * math.Erfc(-z/math.Sqrt2)
+		expectNear(t, "lognormal CDF", want, fractionBelow(samples, median*math.Exp(z*sigma)), 0.005)
+	}
+
+	dist, _ := parseSizeDist("lognormal(64KB,1.5,1MB)")
+	ExpectEqual(t, 1<<20, dist.Max())
+
+	dist, _ = parseSizeDist("lognormal(64KB,1.5)")
+	ExpectEqual(t, int(math.Ceil(median*math.Exp(4*sigma))), dist.Max())
+}
+
+func TestSizeDist_DefaultMax(t *testing.T) {
+	for _, c := range []struct {
+		spec string
+		max  int
+	}{
+		{"lognormal(1MB,2)", defaultMaxSize},   // e^8 MB would be 2.9GB
+		{"pareto(4KB,0.5)", defaultMaxSize},    // 10000^2 x 4KB would be 400GB
+		{"exponential(512MB)", defaultMaxSize}, // 5GB
+		{"pareto(2GB,1.5)", 2 << 30},           // the minimum is above the default
+		{"lognormal(1MB,2,4GB)", 4 << 30},
+		{"pareto(4KB,0.5,64GB)", 64 << 30},
+		{"exponential(1MB)", 10 << 20},
+	} {
+		dist, err := parseSizeDist(c.spec)
+		AbortOnErrorf(t, err, "%s", c.spec)
+		ExpectEqual(t, c.max, dist.Max())
+	}
+}
+
+func TestSizeDist_Pareto(t *testing.T) {
+	min, alpha := 4096.0, 1.2
+	samples := sampleDist(t, "pareto(4KB,1.2)")
+
+	ExpectEqual(t, 4096, samples[0])
+
+	for _, k := range []float64{1.5, 2, 4, 16} {
+		want := 1 - math.Pow(1/k, alpha)
+		expectNear(t, "pareto CDF", want, fractionBelow(samples, min*k), 0.005)
+	}
+}
+
+func TestSizeDist_Exponential(t *testing.T) {
+	mean := 262144.0
+	samples := sampleDist(t, "exponential(256KB)")
+
+	for _, k := range []float64{0.25, 0.5, 1, 2, 4} {
+		want := 1 - math.Exp(-k)
+		expectNear(t, "exponential CDF", want, fractionBelow(samples, mean*k), 0.005)
+	}
+}
+
+func TestSizeDist_InvalidInput(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"0",
+		"1MB-4KB",
+		"4KB-",
+		"lognormal(64KB)",
+		"lognormal(64KB,0)",
+		"lognormal(64KB,1.5,1KB,2KB)",
+		"lognormal(64KB,1.5",
+		"pareto(4KB,-1)",
+		"pareto(4KB,1.2,1KB)",
+		"exponential()",
+		"exponential(foo)",
+		"normal(4KB,1)",
+	} {
+		_, err := parseSizeDist(spec)
+		ExpectErrorf(t, err, "spec '%s'", spec)
+	}
+}
+
+func TestParseSizeSpec_Weights(t *testing.T) {
+	config, err := parseSizeSpec("4KB/0.5:8KB/33.3:lognormal(16KB,1)/66.2/log")
+	AbortOnErrorf(t, err, "parse")
+	ExpectEqual(t, 3, len(config.Entries))
+	ExpectEqual(t, "log", config.Entries[2].Extension)
+
+	rng := rand.New(rand.NewSource(1))
+	counts := make(map[*SizeEntry]int)
+
+	for i := 0; i < distSamples; i++ {
+		counts[config.pick(rng)]++
+	}
+
+	for i := range config.Entries {
+		e := &config.Entries[i]
+		expectNear(t, "entry weight", e.Weight/100, float64(counts[e])/distSamples, 0.003)
+	}
+
+	_, err = parseSizeSpec("4KB/33.33:8KB/33.33:16KB/33.33")
+	AbortOnErrorf(t, err, "thirds")
+
+	_, err = parseSizeSpec("4KB/50.5:8KB/50")
+	ExpectErrorf(t, err, "over 100")
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// sizeBucket is a range of sizes (min == max for a single size) and its
+// relative weight.
+type sizeBucket struct {
+	min, max int
+	weight   float64
+}
+
+// tableSize is a size distribution read from a file, sampled with the alias
+// method so that picking a bucket takes constant time however many there
+// are (a size list from a production filer can have millions of distinct
+// sizes).
+type tableSize struct {
+	path    string
+	buckets []sizeBucket
+	alias   *aliasTable
+	max     int
+	ignored int // lines dropped for being empty files or above the maximum
+}
+
+// parseSizeFile reads a size distribution file, as in "file(path[,max])".
+// Each line of the file is either a size (e.g. the output of
+// "find -printf '%s\n'"), or a bucket and weight separated by a comma or
+// whitespace, where the bucket is a size or a range such as 4096-8191
+// (sizes within a range are uniform). Sizes may have suffixes like "KB".
+// Blank lines and '#' comments are skipped, as is a header line at the top.
+// Sizes of zero, and above max (defaultMaxSize unless given), are ignored.
+func parseSizeFile(spec string, args []string) (SizeDist, error) {
+	if err := parseDistArgs(spec, args, 1, 2); err != nil {
+		return nil, err
+	}
+
+	d := &tableSize{path: strings.TrimSpace(args[0]), max: defaultMaxSize}
+
+	if len(args) > 1 {
+		max, err := parseDistSize(args[1])
+		if err != nil {
+			return nil, err
+		}
+		d.max = max
+	}
+
+	f, err := os.Open(d.path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read size file: %s", err)
+	}
+
+	defer f.Close()
+
+	sizes := make(map[int]float64) // single sizes, merged
+	scanner := bufio.NewScanner(f)
+	line, lines := 0, 0
+
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+
+		if len(text) == 0 || text[0] == '#' {
+			continue
+		}
+
+		lines++
+		b, err := parseSizeBucket(text)
+
+		if err != nil {
+			if lines == 1 {
+				continue // header
+			}
+			return nil, fmt.Errorf("%s:%d: %s", d.path, line, err)
+		}
+
+		if b.weight == 0 {
+			continue
+		}
+
+		if b.max == 0 || b.min > d.max {
+			d.ignored++
+			continue
+		}
+
+		if b.min == 0 {
+			b.min = 1
+		}
+
+		if b.max > d.max {
+			b.max = d.max
+		}
+
+		if b.min == b.max {
+			sizes[b.min] += b.weight
+		} else {
+			d.buckets = append(d.buckets, b)
+		}
+	}
+
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read size file: %s", err)
+	}
+
+	for size, weight := range sizes {
+		d.buckets = append(d.buckets, sizeBucket{size, size, weight})
+	}
+
+	if len(d.buckets) == 0 {
+		return nil, fmt.Errorf("size file %s has no usable sizes", d.path)
+	}
+
+	// Order matters to the alias table, so make it repeatable.
+	sort.SliceStable(d.buckets, func(i, j int) bool {
+		a, b := d.buckets[i], d.buckets[j]
+		return a.min < b.min || (a.min == b.min && a.max < b.max)
+	})
+
+	weights := make([]float64, len(d.buckets))
+	d.max = 0
+
+	for i, b := range d.buckets {
+		weights[i] = b.weight
+		if b.max > d.max {
+			d.max = b.max
+		}
+	}
+
+	d.alias = newAliasTable(weights)
+	return d, nil
+}
+
+func parseSizeBucket(text string) (sizeBucket, error) {
+	fields := strings.FieldsFunc(text, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t'
+	})
+
+	b := sizeBucket{weight: 1}
+	var err error
+
+	switch len(fields) {
+	case 1:
+	case 2:
+		if b.weight, err = strconv.ParseFloat(fields[1], 64); err != nil || b.weight < 0 || math.IsInf(b.weight, 0) {
+			return b, fmt.Errorf("cannot parse weight '%s'", fields[1])
+		}
+	default:
+		return b, fmt.Errorf("expected a size, or a size and weight")
+	}
+
+	min, max := fields[0], fields[0]
+	if dash := strings.IndexByte(fields[0], '-'); dash > 0 {
+		min, max = fields[0][:dash], fields[0][dash+1:]
+	}
+
+	if b.min, err = parseBucketSize(min); err != nil {
+		return b, err
+	}
+
+	if b.max, err = parseBucketSize(max); err != nil {
+		return b, err
+	}
+
+	if b.max < b.min {
+		return b, fmt.Errorf("size range '%s' ends before it starts", fields[0])
+	}
+
+	return b, nil
+}
+
+func parseBucketSize(s string) (int, error) {
+	if len(s) == 0 || (s[0] < '0' || s[0] > '9') {
+		return 0, fmt.Errorf("cannot parse size '%s'", s)
+	}
+
+	size, err := parseSizeInBytes(s)
+	if err != nil {
+		return 0, fmt.Errorf("cannot parse size '%s'", s)
+	}
+
+	return int(size), nil
+}
+
+func (d *tableSize) Sample(rng *rand.Rand) int {
+	b := &d.buckets[d.alias.Sample(rng)]
+
+	if b.min == b.max {
+		return b.min
+	}
+
+	return b.min + int(rng.Int63n(int64(b.max-b.min)+1))
+}
+
+func (d *tableSize) Max() int { return d.max }
+
+func (d *tableSize) String() string {
+	return fmt.Sprintf("file(%s: %d buckets, max %s)", d.path, len(d.buckets), SprintSize(int64(d.max)))
+}
+
+// Report describes the distribution: percentiles and a histogram with a
+// bin per power of two, taking sizes within a bucket to be uniform.
+func (d *tableSize) Report() []string {
+	total, mean := 0.0, 0.0
+	for _, b := range d.buckets {
+		total += b.weight
+		mean += b.weight * float64(b.min+b.max) / 2
+	}
+	mean /= total
+
+	lines := []string{
+		fmt.Sprintf("%s: %d buckets, mean %s", d.path, len(d.buckets), SprintSize(int64(mean))),
+	}
+
+	if d.ignored > 0 {
+		lines = append(lines, fmt.Sprintf("ignored %d entries that were empty or above the maximum", d.ignored))
+	}
+
+	percentiles := ""
+	for _, p := range []float64{0, 10, 50, 90, 99, 100} {
+		percentiles += fmt.Sprintf(" p%g=%s", p, SprintSize(int64(d.percentile(p, total))))
+	}
+	lines = append(lines, "percentiles:"+percentiles)
+
+	bins := make(map[int]float64)
+	for _, b := range d.buckets {
+		// Spread the weight over the bins the bucket covers
+		for lo := b.min; lo <= b.max; {
+			bin := log2Floor(lo)
+			hi := 1<<(bin+1) - 1
+			if hi > b.max {
+				hi = b.max
+			}
+			bins[bin] += b.weight * float64(hi-lo+1) / float64(b.max-b.min+1)
+			lo = hi + 1
+		}
+	}
+
+	for bin := log2Floor(d.buckets[0].min); bin <= log2Floor(d.max); bin++ {
+		if bins[bin] > 0 {
+			lines = append(lines, fmt.Sprintf("%10s - %-10s %6.2f%%",
+				SprintSize(1<<bin), SprintSize(1<<(bin+1)-1), bins[bin]*100/total))
+		}
+	}
+
+	return lines
+}
+
+// percentile returns the size at or below which p percent of the weight
+// falls.
+func (d *tableSize) percentile(p float64, total float64) float64 {
+	target := total * p / 100
+	sum := 0.0
+
+	for _, b := range d.buckets {
+		if sum+b.weight >= target {
+			return float64(b.min) + float64(b.max-b.min)*(target-sum)/b.weight
+		}
+		sum += b.weight
+	}
+
+	return float64(d.max)
+}
+
+func log2Floor(n int) int {
+	bin := 0
+	for n > 1 {
+		n >>= 1
+		bin++
+	}
+	return bin
+}
+
+// aliasTable picks from weighted choices in constant time, using Vose's
+// alias method.
+type aliasTable struct {
+	prob  []float64
+	alias []int
+}
+
+func newAliasTable(weights []float64) *aliasTable {
+	n := len(weights)
+	t := &aliasTable{prob: make([]float64, n), alias: make([]int, n)}
+
+	total := 0.0
+	for _, w := range weights {
+		total += w
+	}
+
+	// Scale so the average is 1, then pair each choice under 1 with one
+	// over 1 that makes up the difference.
+	scaled := make([]float64, n)
+	var small, large []int
+
+	for i, w := range weights {
+		scaled[i] = w * float64(n) / total
+		if scaled[i] < 1 {
+			small = append(small, i)
+		} else {
+			large = append(large, i)
+		}
+	}
+
+	for len(small) > 0 && len(large) > 0 {
+		s, l := small[len(small)-1], large[len(large)-1]
+		small = small[:len(small)-1]
+
+		t.prob[s] = scaled[s]
+		t.alias[s] = l
+		scaled[l] -= 1 - scaled[s]
+
+		if scaled[l] < 1 {
+			large = large[:len(large)-1]
+			small = append(small, l)
+		}
+	}
+
+	// Whatever's left is 1, give or take rounding.
+	for _, i := range append(small, large...) {
+		t.prob[i] = 1
+		t.alias[i] = i
+	}
+
+	return t
+}
+
+func (t *aliasTable) Sample(rng *rand.Rand) int {
+	i := rng.Intn(len(t.prob))
+
+	if rng.Float64() < t.prob[i] {
+		return i
+	}
+
+	return t.alias[i]
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeSizeFile(t *testing.T, contents string) string {
+	path := filepath.Join(t.TempDir(), "sizes")
+	AbortOnError(t, os.WriteFile(path, []byte(contents), 0644))
+	return path
+}
+
+func TestAliasTable(t *testing.T) {
+	weights := []float64{1, 0, 5, 0.5, 20, 3.5}
+	total := 30.0
+	table := newAliasTable(weights)
+	rng := rand.New(rand.NewSource(1))
+	counts := make([]int, len(weights))
+
+	for i := 0; i < distSamples; i++ {
+		counts[table.Sample(rng)]++
+	}
+
+	for i, w := range weights {
+		expectNear(t, "alias weight", w/total, float64(counts[i])/distSamples, 0.004)
+	}
+}
+
+func TestSizeFile_List(t *testing.T) {
+	// As from find -printf '%s\n': duplicates merge, empty files are ignored
+	path := writeSizeFile(t, "100\n200\n0\n100\n\n# comment\n4KB\n100\n")
+	dist, err := parseSizeDist("file(" + path + ")")
+	AbortOnError(t, err)
+
+	d := dist.(*tableSize)
+	ExpectEqual(t, 3, len(d.buckets))
+	ExpectEqual(t, 1, d.ignored)
+	ExpectEqual(t, 4096, d.Max())
+
+	rng := rand.New(rand.NewSource(1))
+	counts := make(map[int]int)
+
+	for i := 0; i < distSamples; i++ {
+		counts[dist.Sample(rng)]++
+	}
+
+	ExpectEqual(t, 3, len(counts))
+	expectNear(t, "100 bytes", 0.6, float64(counts[100])/distSamples, 0.005)
+	expectNear(t, "200 bytes", 0.2, float64(counts[200])/distSamples, 0.005)
+	expectNear(t, "4KB", 0.2, float64(counts[4096])/distSamples, 0.005)
+}
+
+func TestSizeFile_Buckets(t *testing.T) {
+	path := writeSizeFile(t, "size,count\n0,50\n1-4095,100\n4096-65535,300\n65536\t50\n1MB 0\n16MB,10\n")
+	dist, err := parseSizeDist("file(" + path + ",1MB)")
+	AbortOnError(t, err)
+
+	// 16MB is over the maximum; 1MB has no weight
+	ExpectEqual(t, 65536, dist.Max())
+
+	samples := sampleDist(t, "file("+path+",1MB)")
+	expectNear(t, "below 4KB", 100.0/450, fractionBelow(samples, 4096), 0.005)
+	expectNear(t, "below 16KB", 100.0/450+300.0/450*(16384-4096)/61440, fractionBelow(samples, 16384), 0.005)
+	expectNear(t, "below 64KB", 400.0/450, fractionBelow(samples, 65536), 0.005)
+	ExpectEqual(t, 65536, samples[len(samples)-1])
+
+	lines := dist.(*tableSize).Report()
+	if len(lines) < 4 {
+		t.Errorf("expected a distribution report, got %v", lines)
+	}
+}
+
+func TestSizeFile_Outlier(t *testing.T) {
+	// As from find, with one huge file among many small ones
+	path := writeSizeFile(t, strings.Repeat("4096\n", 500)+strings.Repeat("8192\n", 499)+"53687091200\n")
+
+	dist, err := parseSizeDist("file(" + path + ")")
+	AbortOnError(t, err)
+	ExpectEqual(t, 1, dist.(*tableSize).ignored)
+	ExpectEqual(t, 8192, dist.Max())
+
+	// Ranges crossing the default maximum are cut off there
+	path = writeSizeFile(t, "4096,100\n512MB-4GB,1\n")
+	dist, err = parseSizeDist("file(" + path + ")")
+	AbortOnError(t, err)
+	ExpectEqual(t, defaultMaxSize, dist.Max())
+
+	// Given a larger maximum, the outlier is kept, but only costs memory
+	// when it's drawn
+	path = writeSizeFile(t, "4096,1000000\n8192,1000000\n53687091200,0.000001\n")
+	vendor, err := NewObjectVendor("file("+path+",64GB)", DataConfig{}, defaultSeed)
+	AbortOnError(t, err)
+	ExpectEqual(t, 50<<30, vendor.config.MaxSize)
+
+	g := vendor.NewGenerator(1)
+	for i := 0; i < 100; i++ {
+		blk := g.GetObject()
+		if cap(blk.dataBuf) > 8192 {
+			t.Fatalf("object %d: %d byte buffer for a %d byte object", i, cap(blk.dataBuf), len(blk.Data))
+		}
+		vendor.ReturnObject(blk)
+	}
+}
+
+func TestSizeFile_InvalidInput(t *testing.T) {
+	for _, contents := range []string{
+		"",
+		"0\n0\n",
+		"size\nfoo\n",
+		"100\n200,x\n",
+		"100\n200,1,2\n",
+		"100\n8191-4096,1\n",
+	} {
+		path := writeSizeFile(t, contents)
+		_, err := parseSizeDist("file(" + path + ")")
+		ExpectErrorf(t, err, "contents %q", contents)
+	}
+
+	_, err := parseSizeDist("file(/nonexistent/sizes)")
+	ExpectErrorf(t, err, "missing file")
+}
+
+func TestParseSizeSpec_File(t *testing.T) {
+	path := writeSizeFile(t, "100\n200\n")
+	config, err := parseSizeSpec("file(" + path + ")/60/log/text:4KB/40")
+	AbortOnError(t, err)
+	ExpectEqual(t, 2, len(config.Entries))
+	ExpectEqual(t, "log", config.Entries[0].Extension)
+	ExpectEqual(t, 4096, config.MaxSize)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"math"
+)
+
+// meanVariance returns the mean and (sample) variance of data.
+func meanVariance(data []float64) (mean, variance float64) {
+	if len(data) == 0 {
+		return 0, 0
+	}
+
+	for _, d := range data {
+		mean += d
+	}
+	mean /= float64(len(data))
+
+	if len(data) < 2 {
+		return mean, 0
+	}
+
+	for _, d := range data {
+		variance += (d - mean) * (d - mean)
+	}
+	variance /= float64(len(data) - 1)
+
+	return mean, variance
+}
+
+// welchTTest tests whether a and b have different means, without assuming
+// they have the same variance, returning the two-sided p-value: the chance
+// of a difference at least this large if the means were the same. It
+// returns false if there aren't enough samples to tell.
+func welchTTest(a, b []float64) (p float64, ok bool) {
+	if len(a) < 2 || len(b) < 2 {
+		return 0, false
+	}
+
+	meanA, varA := meanVariance(a)
+	meanB, varB := meanVariance(b)
+	sa := varA / float64(len(a))
+	sb := varB / float64(len(b))
+
+	if sa+sb == 0 {
+		// No variation at all, so any difference is real
+		if meanA == meanB {
+			return 1, true
+		}
+		return 0, true
+	}
+
+	t := (meanA - meanB) / math.Sqrt(sa+sb)
+	df := (sa + sb) * (sa + sb) / (sa*sa/float64(len(a)-1) + sb*sb/float64(len(b)-1))
+
+	return incompleteBeta(df/2, 0.5, df/(df+t*t)), true
+}
+
+// incompleteBeta is the regularized incomplete beta function I_x(a, b),
+// evaluated with its continued fraction (as in Numerical Recipes).
+func incompleteBeta(a, b, x float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 1
+	}
+
+	la, _ := math.Lgamma(a)
+	lb, _ := math.Lgamma(b)
+	lab, _ := math.Lgamma(a + b)
+	front := math.Exp(lab - la - lb + a*math.Log(x) + b*math.Log(1-x))
+
+	// The continued fraction converges quickly only on this side
+	if x > (a+1)/(a+b+2) {
+		return 1 - front*betaFraction(b, a, 1-x)/b
+	}
+
+	return front * betaFraction(a, b, x) / a
+}
+
+func betaFraction(a, b, x float64) float64 {
+	const tiny = 1e-300
+	const epsilon = 1e-14
+
+	c := 1.0
+	d := 1 - (a+b)*x/(a+1)
+	if math.Abs(d) < tiny {
+		d = tiny
+	}
+	d = 1 / d
+	h := d
+
+	for m := 1; m <= 300; m++ {
+		fm := float64(m)
+
+		// Even step
+		n := fm * (b - fm) * x / ((a + 2*fm - 1) * (a + 2*fm))
+		d = 1 + n*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + n/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		h *= d * c
+
+		// Odd step
+		n = -(a + fm) * (a + b + fm) * x / ((a + 2*fm) * (a + 2*fm + 1))
+		d = 1 + n*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + n/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		delta := d * c
+		h *= delta
+
+		if math.Abs(delta-1) < epsilon {
+			break
+		}
+	}
+
+	return h
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestIncompleteBeta(t *testing.T) {
+	// Two-sided p-values of Student's t, which have closed forms for 1 and
+	// 2 degrees of freedom
+	tp := func(tv, df float64) float64 { return incompleteBeta(df/2, 0.5, df/(df+tv*tv)) }
+
+	expectNear(t, "t=1, df=1", 0.5, tp(1, 1), 1e-9)
+	expectNear(t, "t=3, df=1", 1-2*math.Atan(3)/math.Pi, tp(3, 1), 1e-9)
+	expectNear(t, "t=2, df=2", 1-2/math.Sqrt(6), tp(2, 2), 1e-9)
+	expectNear(t, "t=0", 1, tp(0, 10), 1e-9)
+	expectNear(t, "x=0", 0, incompleteBeta(2, 3, 0), 0)
+	expectNear(t, "x=1", 1, incompleteBeta(2, 3, 1), 0)
+
+	// I_x(a, 1) = x^a
+	expectNear(t, "x^a", math.Pow(0.3, 2.5), incompleteBeta(2.5, 1, 0.3), 1e-9)
+	expectNear(t, "x^a, other side", math.Pow(0.9, 2.5), incompleteBeta(2.5, 1, 0.9), 1e-9)
+}
+
+func TestWelchTTest(t *testing.T) {
+	a := []float64{27.5, 21.0, 19.0, 23.6, 17.0, 17.9, 16.9, 20.1, 21.9, 22.6, 23.1, 19.6, 19.0, 21.7, 21.4}
+	b := []float64{27.1, 22.0, 20.8, 23.4, 23.4, 23.5, 25.8, 22.0, 24.8, 20.2, 21.9, 22.1, 22.9, 20.5, 24.4}
+
+	p, ok := welchTTest(a, b)
+	ExpectEqual(t, true, ok)
+	expectNear(t, "p", 0.021, p, 0.001)
+
+	// Order doesn't matter
+	p2, _ := welchTTest(b, a)
+	expectNear(t, "p reversed", p, p2, 1e-12)
+
+	p, ok = welchTTest([]float64{5, 5, 5}, []float64{5, 5})
+	ExpectEqual(t, true, ok)
+	ExpectEqual(t, 1.0, p)
+
+	p, _ = welchTTest([]float64{5, 5, 5}, []float64{6, 6})
+	ExpectEqual(t, 0.0, p)
+
+	_, ok = welchTTest([]float64{1}, []float64{1, 2, 3})
+	ExpectEqual(t, false, ok)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// RunSummary is the machine-readable result of a run, written to
+// summary.json in the run directory for tools that compare runs.
+type RunSummary struct {
+	RunId    string                `json:"run_id"`
+	Seed     uint64                `json:"seed"`
+	Duration float64               `json:"duration"` // seconds
+	End      string                `json:"end"`      // why the run ended
+	Error    string                `json:"error,omitempty"`
+	Ops      map[string]*OpSummary `json:"ops"` // by op name
+	Phases   []PhaseSummary        `json:"phases,omitempty"`
+}
+
+// PhaseSummary is the result of one phase of a phased run. Start is in
+// seconds from the start of the run, as in the bandwidth log.
+type PhaseSummary struct {
+	Name     string                `json:"name"`
+	Start    float64               `json:"start"`    // seconds
+	Duration float64               `json:"duration"` // seconds
+	Ops      map[string]*OpSummary `json:"ops"`      // by op name
+}
+
+// OpSummary is the result for one kind of op. Bandwidth is bytes/sec and
+// latencies are seconds, as in the CSV logs. The bandwidth and IOPS of
+// each reporter interval are kept too, so runs can be compared.
+type OpSummary struct {
+	Ops                int64              `json:"ops"`
+	Bytes              int64              `json:"bytes"`
+	IOPS               float64            `json:"iops"`
+	BandwidthMean      int64              `json:"bandwidth_mean"`
+	BandwidthMedian    int64              `json:"bandwidth_median"`
+	LatencyMean        float64            `json:"latency_mean"`
+	LatencyMax         float64            `json:"latency_max"`
+	Latency            map[string]float64 `json:"latency"` // by percentile, e.g. "p99"
+	LatencyCurve       []LatencyPoint     `json:"latency_curve,omitempty"`
+	BandwidthIntervals []int64            `json:"bandwidth_intervals,omitempty"`
+	IOPSIntervals      []float64          `json:"iops_intervals,omitempty"`
+}
+
+// LatencyPoint is one point of an op's latency curve: the latency (in
+// seconds) that Percentile percent of ops took no longer than.
+type LatencyPoint struct {
+	Percentile float64 `json:"percentile"`
+	Latency    float64 `json:"latency"`
+}
+
+// curvePercentiles are the points on each op's latency curve, closer
+// together in the tail where latencies change fastest.
+var curvePercentiles = []float64{1, 5, 10, 25, 50, 75, 90, 95, 98, 99, 99.5, 99.8, 99.9, 99.95, 99.98, 99.99, 99.995, 99.999}
+
+func newOpSummary(ops, bytes int64, elapsed time.Duration, bandwidth []int64, iops []float64, latency *LatencyTracker) *OpSummary {
+	s := &OpSummary{
+		Ops:                ops,
+		Bytes:              bytes,
+		BandwidthMean:      Mean(bandwidth),
+		BandwidthMedian:    Median(bandwidth),
+		LatencyMean:        latency.Mean().Seconds(),
+		LatencyMax:         latency.Max().Seconds(),
+		Latency:            make(map[string]float64),
+		BandwidthIntervals: bandwidth,
+		IOPSIntervals:      iops,
+	}
+
+	if elapsed > 0 {
+		s.IOPS = float64(ops) / elapsed.Seconds()
+	}
+
+	for _, p := range Percentiles {
+		s.Latency[percentileName(p)] = latency.Percentile(p).Seconds()
+	}
+
+	if latency.Count() > 0 {
+		for _, p := range curvePercentiles {
+			s.LatencyCurve = append(s.LatencyCurve, LatencyPoint{p, latency.Percentile(p).Seconds()})
+		}
+	}
+
+	return s
+}
+
+// percentileName is how a percentile is named in summaries, e.g. "p99.9".
+func percentileName(p float64) string {
+	return fmt.Sprintf("p%g", p)
+}
+
+func (s *RunSummary) Write(path string) error {
+	data, e := json.MarshalIndent(s, "", "  ")
+	if e != nil {
+		return e
+	}
+
+	if e = os.WriteFile(path, append(data, '\n'), 0664); e != nil {
+		return fmt.Errorf("cannot write summary: %s", e)
+	}
+
+	return nil
+}
+
+func ReadRunSummary(path string) (*RunSummary, error) {
+	data, e := os.ReadFile(path)
+	if e != nil {
+		return nil, fmt.Errorf("cannot read summary: %s", e)
+	}
+
+	s := &RunSummary{}
+	if e = json.Unmarshal(data, s); e != nil {
+		return nil, fmt.Errorf("cannot parse %s: %s", path, e)
+	}
+
+	return s, nil
+}
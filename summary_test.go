@@ -0,0 +1,72 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReporter_PhaseSummary(t *testing.T) {
+	r := &Reporter{SugaredLogger: Logger()}
+	for op := range r.latency {
+		r.latency[op] = NewLatencyTracker()
+	}
+
+	start := time.Now()
+	r.startTime = start.Add(-10 * time.Second)
+
+	sample := func(op, size int, latency time.Duration) {
+		r.phases[len(r.phases)-1].add(&Sample{Op: op, Size: size, Start: start, Finish: start.Add(latency)})
+	}
+
+	r.BeginPhase("fill", 0, 0)
+	sample(Write, 1000, time.Millisecond)
+	sample(Write, 3000, 3*time.Millisecond)
+	r.phases[0].interval(r, 2, [3]int64{0, 2, 0})
+
+	r.BeginPhase("mixed", 0, 0)
+	sample(Read, 500, 2*time.Millisecond)
+	sample(Delete, 0, time.Millisecond)
+	r.phases[1].interval(r, 1, [3]int64{1, 0, 1})
+
+	// As Stop does
+	r.phases[0].start, r.phases[0].finish = start, start.Add(2*time.Second)
+	r.phases[1].start, r.phases[1].finish = start.Add(2*time.Second), start.Add(3*time.Second)
+
+	path := filepath.Join(t.TempDir(), "summary.json")
+	AbortOnError(t, r.Summary().Write(path))
+	s, err := ReadRunSummary(path)
+	AbortOnError(t, err)
+
+	ExpectEqual(t, 2, len(s.Phases))
+
+	fill := s.Phases[0]
+	ExpectEqual(t, "fill", fill.Name)
+	ExpectEqual(t, 10.0, fill.Start)
+	ExpectEqual(t, 2.0, fill.Duration)
+	ExpectEqual(t, 1, len(fill.Ops))
+
+	w := fill.Ops["write"]
+	ExpectEqual(t, int64(2), w.Ops)
+	ExpectEqual(t, int64(4000), w.Bytes)
+	ExpectEqual(t, 1.0, w.IOPS)
+	ExpectEqual(t, int64(2000), w.BandwidthMean)
+	ExpectEqual(t, 1, len(w.IOPSIntervals))
+	ExpectEqual(t, 1.0, w.IOPSIntervals[0])
+	ExpectEqual(t, 0.002, w.LatencyMean)
+	ExpectEqual(t, 0.003, w.LatencyMax)
+
+	mixed := s.Phases[1]
+	ExpectEqual(t, "mixed", mixed.Name)
+	ExpectEqual(t, 12.0, mixed.Start)
+	ExpectEqual(t, 1.0, mixed.Duration)
+	ExpectEqual(t, 2, len(mixed.Ops))
+	ExpectEqual(t, int64(500), mixed.Ops["read"].Bytes)
+	ExpectEqual(t, int64(500), mixed.Ops["read"].BandwidthMedian)
+	ExpectEqual(t, int64(1), mixed.Ops["delete"].Ops)
+	ExpectEqual(t, 1.0, mixed.Ops["delete"].IOPS)
+
+	// Runs without phases leave them out
+	r.phases = nil
+	ExpectEqual(t, 0, len(r.Summary().Phases))
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"math"
+	"strings"
+)
+
+// chartColors are used for series in order.
+var chartColors = []string{"#1f77b4", "#d62728", "#2ca02c", "#ff7f0e", "#9467bd", "#8c564b", "#e377c2", "#7f7f7f"}
+
+const (
+	chartWidth   = 860
+	chartHeight  = 300
+	chartLeft    = 80 // room for y tick labels
+	chartRight   = 20
+	chartTop     = 30
+	chartBottom  = 45 // room for x tick labels and the axis label
+	chartLegendW = 150
+)
+
+type chartSeries struct {
+	Name string
+	X, Y []float64
+}
+
+// chartMarker is a labelled vertical line, e.g. the start of a phase.
+type chartMarker struct {
+	X     float64
+	Label string
+}
+
+// lineChart is an SVG line chart. Axes are linear; for a log scale, give
+// the logs and format ticks accordingly.
+type lineChart struct {
+	Title   string
+	XLabel  string
+	Series  []chartSeries
+	Markers []chartMarker
+	XTicks  []float64 // nil to pick evenly spaced ones
+	YTicks  []float64
+	XFormat func(float64) string
+	YFormat func(float64) string
+	YZero   bool // start the y axis at 0
+}
+
+func (c *lineChart) SVG() string {
+	var b strings.Builder
+
+	minX, maxX, minY, maxY := math.Inf(1), math.Inf(-1), math.Inf(1), math.Inf(-1)
+	for _, s := range c.Series {
+		for i := range s.X {
+			minX, maxX = math.Min(minX, s.X[i]), math.Max(maxX, s.X[i])
+			minY, maxY = math.Min(minY, s.Y[i]), math.Max(maxY, s.Y[i])
+		}
+	}
+
+	if math.IsInf(minX, 1) {
+		return ""
+	}
+
+	for _, m := range c.Markers {
+		minX, maxX = math.Min(minX, m.X), math.Max(maxX, m.X)
+	}
+
+	if c.YZero {
+		minY = math.Min(minY, 0)
+	}
+
+	xTicks, yTicks := c.XTicks, c.YTicks
+	if xTicks == nil {
+		xTicks = niceTicks(minX, maxX)
+	}
+	if yTicks == nil {
+		yTicks = niceTicks(minY, maxY)
+	}
+
+	minX, maxX = math.Min(minX, xTicks[0]), math.Max(maxX, xTicks[len(xTicks)-1])
+	minY, maxY = math.Min(minY, yTicks[0]), math.Max(maxY, yTicks[len(yTicks)-1])
+
+	if maxX == minX {
+		maxX = minX + 1
+	}
+	if maxY == minY {
+		maxY = minY + 1
+	}
+
+	plotW := float64(chartWidth - chartLeft - chartRight - chartLegendW)
+	plotH := float64(chartHeight - chartTop - chartBottom)
+	px := func(x float64) float64 { return chartLeft + (x-minX)/(maxX-minX)*plotW }
+	py := func(y float64) float64 { return chartTop + plotH - (y-minY)/(maxY-minY)*plotH }
+
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-family="sans-serif" font-size="11">`,
+		chartWidth, chartHeight)
+	fmt.Fprintf(&b, `<text x="%d" y="18" font-size="14" font-weight="bold">%s</text>`, chartLeft, html.EscapeString(c.Title))
+
+	for _, t := range yTicks {
+		y := py(t)
+		fmt.Fprintf(&b, `<line x1="%d" y1="%.1f" x2="%.1f" y2="%.1f" stroke="#ddd"/>`, chartLeft, y, chartLeft+plotW, y)
+		fmt.Fprintf(&b, `<text x="%d" y="%.1f" text-anchor="end">%s</text>`, chartLeft-6, y+4, html.EscapeString(formatTick(c.YFormat, t)))
+	}
+
+	for _, t := range xTicks {
+		x := px(t)
+		fmt.Fprintf(&b, `<line x1="%.1f" y1="%d" x2="%.1f" y2="%.1f" stroke="#eee"/>`, x, chartTop, x, chartTop+plotH)
+		fmt.Fprintf(&b, `<text x="%.1f" y="%.1f" text-anchor="middle">%s</text>`, x, chartTop+plotH+15, html.EscapeString(formatTick(c.XFormat, t)))
+	}
+
+	fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%.1f" height="%.1f" fill="none" stroke="#888"/>`, chartLeft, chartTop, plotW, plotH)
+	fmt.Fprintf(&b, `<text x="%.1f" y="%d" text-anchor="middle">%s</text>`, chartLeft+plotW/2, chartHeight-6, html.EscapeString(c.XLabel))
+
+	for _, m := range c.Markers {
+		x := px(m.X)
+		fmt.Fprintf(&b, `<line x1="%.1f" y1="%d" x2="%.1f" y2="%.1f" stroke="#555" stroke-dasharray="4,3"/>`, x, chartTop, x, chartTop+plotH)
+		fmt.Fprintf(&b, `<text x="%.1f" y="%d" fill="#555">%s</text>`, x+3, chartTop+12, html.EscapeString(m.Label))
+	}
+
+	for i, s := range c.Series {
+		color := chartColors[i%len(chartColors)]
+		points := make([]string, len(s.X))
+
+		for j := range s.X {
+			points[j] = fmt.Sprintf("%.1f,%.1f", px(s.X[j]), py(s.Y[j]))
+		}
+
+		fmt.Fprintf(&b, `<polyline fill="none" stroke="%s" stroke-width="1.5" points="%s"/>`, color, strings.Join(points, " "))
+
+		if len(s.X) == 1 {
+			fmt.Fprintf(&b, `<circle cx="%.1f" cy="%.1f" r="3" fill="%s"/>`, px(s.X[0]), py(s.Y[0]), color)
+		}
+
+		legendY := chartTop + 10 + i*16
+		fmt.Fprintf(&b, `<rect x="%.1f" y="%d" width="12" height="3" fill="%s"/>`, chartLeft+plotW+12, legendY-4, color)
+		fmt.Fprintf(&b, `<text x="%.1f" y="%d">%s</text>`, chartLeft+plotW+30, legendY, html.EscapeString(s.Name))
+	}
+
+	b.WriteString("</svg>")
+	return b.String()
+}
+
+// barChart is an SVG chart of counts in named buckets, with a group of
+// bars per bucket, one for each series.
+type barChart struct {
+	Title   string
+	Buckets []string
+	Series  []chartSeries // only Y is used, one per bucket
+}
+
+func (c *barChart) SVG() string {
+	var b strings.Builder
+
+	maxY := 0.0
+	for _, s := range c.Series {
+		for _, y := range s.Y {
+			maxY = math.Max(maxY, y)
+		}
+	}
+
+	yTicks := niceTicks(0, math.Max(maxY, 1))
+	maxY = yTicks[len(yTicks)-1]
+
+	plotW := float64(chartWidth - chartLeft - chartRight - chartLegendW)
+	plotH := float64(chartHeight - chartTop - chartBottom)
+	py := func(y float64) float64 { return chartTop + plotH - y/maxY*plotH }
+	groupW := plotW / float64(len(c.Buckets))
+	barW := groupW * 0.8 / float64(len(c.Series))
+
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-family="sans-serif" font-size="11">`,
+		chartWidth, chartHeight)
+	fmt.Fprintf(&b, `<text x="%d" y="18" font-size="14" font-weight="bold">%s</text>`, chartLeft, html.EscapeString(c.Title))
+
+	for _, t := range yTicks {
+		y := py(t)
+		fmt.Fprintf(&b, `<line x1="%d" y1="%.1f" x2="%.1f" y2="%.1f" stroke="#ddd"/>`, chartLeft, y, chartLeft+plotW, y)
+		fmt.Fprintf(&b, `<text x="%d" y="%.1f" text-anchor="end">%s</text>`, chartLeft-6, y+4, formatTick(nil, t))
+	}
+
+	for i, bucket := range c.Buckets {
+		x := chartLeft + groupW*float64(i)
+		fmt.Fprintf(&b, `<text x="%.1f" y="%.1f" text-anchor="middle">%s</text>`, x+groupW/2, chartTop+plotH+15, html.EscapeString(bucket))
+
+		for j, s := range c.Series {
+			if i >= len(s.Y) || s.Y[i] == 0 {
+				continue
+			}
+			fmt.Fprintf(&b, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s"><title>%s: %.0f</title></rect>`,
+				x+groupW*0.1+barW*float64(j), py(s.Y[i]), barW, plotH-(py(s.Y[i])-chartTop),
+				chartColors[j%len(chartColors)], html.EscapeString(s.Name), s.Y[i])
+		}
+	}
+
+	fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%.1f" height="%.1f" fill="none" stroke="#888"/>`, chartLeft, chartTop, plotW, plotH)
+
+	for i, s := range c.Series {
+		legendY := chartTop + 10 + i*16
+		fmt.Fprintf(&b, `<rect x="%.1f" y="%d" width="12" height="8" fill="%s"/>`, chartLeft+plotW+12, legendY-7, chartColors[i%len(chartColors)])
+		fmt.Fprintf(&b, `<text x="%.1f" y="%d">%s</text>`, chartLeft+plotW+30, legendY, html.EscapeString(s.Name))
+	}
+
+	b.WriteString("</svg>")
+	return b.String()
+}
+
+// niceTicks returns about five round tick values covering min to max.
+func niceTicks(min, max float64) []float64 {
+	if max <= min {
+		max = min + 1
+	}
+
+	raw := (max - min) / 5
+	step := math.Pow(10, math.Floor(math.Log10(raw)))
+
+	for _, m := range []float64{1, 2, 2.5, 5, 10} {
+		if step*m >= raw {
+			step *= m
+			break
+		}
+	}
+
+	var ticks []float64
+	for t := math.Floor(min/step) * step; ; t += step {
+		ticks = append(ticks, t)
+		if t >= max-step*1e-9 {
+			break
+		}
+	}
+
+	return ticks
+}
+
+func formatTick(format func(float64) string, t float64) string {
+	if format != nil {
+		return format(t)
+	}
+	return fmt.Sprintf("%g", math.Round(t*1000)/1000)
+}
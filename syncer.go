@@ -32,13 +32,15 @@ func (s *SyncNone) Stop() {
 
 type SyncInline struct {
 	*zap.SugaredLogger
-	timings *Histogram
+	timings  *Histogram
+	manifest *DurabilityManifest // may be nil
 }
 
-func NewSyncInline() *SyncInline {
+func NewSyncInline(manifest *DurabilityManifest) *SyncInline {
 	return &SyncInline{
 		Logger(),
 		NewHistogram(),
+		manifest,
 	}
 }
 
@@ -48,6 +50,10 @@ func (s *SyncInline) Sync(bw ObjectWriter) (e error) {
 	elapsed := time.Now().Sub(start)
 	s.timings.Add(elapsed)
 
+	if e == nil && s.manifest != nil {
+		e = s.manifest.Append(bw)
+	}
+
 	return e
 }
 
@@ -73,12 +79,14 @@ type SyncBatcher struct {
 	pending    chan *SyncRequest
 	maxWait    time.Duration
 	maxPending int
-	syncTime   *Histogram // time waiting for sync only to complete
-	totalTime  *Histogram // total time waiting (batch delay + sync)
+	syncTime   *Histogram          // time waiting for sync only to complete
+	totalTime  *Histogram          // total time waiting (batch delay + sync)
+	manifest   *DurabilityManifest // may be nil
+	synced     []*SyncRequest      // successful syncs in the current batch
 	stop       func()
 }
 
-func NewSyncBatcher(maxWait time.Duration, maxPending int) *SyncBatcher {
+func NewSyncBatcher(maxWait time.Duration, maxPending int, manifest *DurabilityManifest) *SyncBatcher {
 	ctx, cancel := context.WithCancel(context.Background())
 	var wg sync.WaitGroup
 
@@ -90,6 +98,7 @@ func NewSyncBatcher(maxWait time.Duration, maxPending int) *SyncBatcher {
 		maxPending:    maxPending,
 		syncTime:      NewHistogram(),
 		totalTime:     NewHistogram(),
+		manifest:      manifest,
 		stop: func() {
 			cancel()
 			wg.Wait()
@@ -117,6 +126,11 @@ func (s *SyncBatcher) Sync(bw ObjectWriter) (e error) {
 	return e
 }
 
+// QueueDepth returns how many syncs are waiting to be batched.
+func (s *SyncBatcher) QueueDepth() int {
+	return len(s.incoming) + len(s.pending)
+}
+
 func (s *SyncBatcher) Stop() {
 	s.stop()
 	s.Infof("stopped")
@@ -167,7 +181,9 @@ func (s *SyncBatcher) Run(ctx context.Context) {
 	}
 }
 
-// SyncPending will sync what's in the pending queue.
+// SyncPending will sync what's in the pending queue. With a manifest, the
+// successfully synced objects are recorded in one append after the whole
+// batch, and their runners aren't released until that's durable.
 func (s *SyncBatcher) SyncPending() {
 	pending := len(s.pending)
 	if pending == 0 {
@@ -176,6 +192,8 @@ func (s *SyncBatcher) SyncPending() {
 
 	// s.Infof("sync'ing %d pending writers", pending)
 
+	s.synced = s.synced[:0]
+
 	for i := 0; i < pending; i++ {
 		req := <-s.pending
 
@@ -185,6 +203,25 @@ func (s *SyncBatcher) SyncPending() {
 		e := req.bw.Sync()
 		s.syncTime.Add(time.Now().Sub(start))
 
+		if e == nil && s.manifest != nil {
+			s.synced = append(s.synced, req)
+		} else {
+			req.e <- e
+		}
+	}
+
+	if len(s.synced) == 0 {
+		return
+	}
+
+	writers := make([]ObjectWriter, len(s.synced))
+	for i, req := range s.synced {
+		writers[i] = req.bw
+	}
+
+	e := s.manifest.Append(writers...)
+
+	for _, req := range s.synced {
 		req.e <- e
 	}
 }
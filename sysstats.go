@@ -0,0 +1,414 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// DiskStats are a block device's counters from /proc/diskstats, since
+// boot.
+type DiskStats struct {
+	Major, Minor uint32
+	Name         string
+	Reads        uint64 // completed
+	ReadSectors  uint64 // of 512 bytes, whatever the device's sector size
+	Writes       uint64
+	WriteSectors uint64
+	InFlight     uint64 // I/Os in progress right now
+	IoTicks      uint64 // ms with I/O in progress
+	QueueTicks   uint64 // ms with I/O in progress, weighted by the number in progress
+}
+
+// MemInfo is the page cache's state from /proc/meminfo, in bytes.
+type MemInfo struct {
+	Dirty     int64 // waiting to be written back
+	Writeback int64 // being written back
+}
+
+// CPUTimes are the times for all CPUs from /proc/stat, in clock ticks.
+type CPUTimes struct {
+	User, Nice, System, Idle, IOWait, IRQ, SoftIRQ, Steal uint64
+}
+
+func (c CPUTimes) total() uint64 {
+	return c.User + c.Nice + c.System + c.Idle + c.IOWait + c.IRQ + c.SoftIRQ + c.Steal
+}
+
+// DeviceStats are a block device's rates over an interval.
+type DeviceStats struct {
+	Name           string
+	Paths          []string // the run's paths on the device
+	ReadBandwidth  int64    // bytes/sec
+	WriteBandwidth int64
+	ReadIOPS       float64
+	WriteIOPS      float64
+	Utilization    float64 // percent of the interval with I/O in progress
+	QueueDepth     float64 // mean I/Os in progress
+}
+
+// CPUUsage is the percent of all CPUs' time spent in each state over an
+// interval.
+type CPUUsage struct {
+	User, System, IOWait, Idle float64
+}
+
+// SystemStats are what the kernel saw over an interval, alongside
+// perftest's own stats.
+type SystemStats struct {
+	Devices []DeviceStats
+	CPU     CPUUsage
+	Memory  MemInfo
+}
+
+// diskSectorSize is the unit of the sector counts in /proc/diskstats.
+const diskSectorSize = 512
+
+// SystemMonitor samples the kernel's stats for the block devices under the
+// run's paths, the page cache and the CPUs. It's Linux only, as it reads
+// them from /proc.
+type SystemMonitor struct {
+	procDir string
+	devices []*monitoredDevice
+	cpu     CPUTimes
+	last    time.Time
+}
+
+type monitoredDevice struct {
+	major, minor uint32
+	paths        []string
+	last         DiskStats
+}
+
+// NewSystemMonitor finds the block devices holding paths, and takes the
+// first sample. Paths that aren't on a block device (e.g. on tmpfs) are
+// left out, as are devices it can't find in procDir's diskstats.
+func NewSystemMonitor(procDir string, paths []string) (*SystemMonitor, error) {
+	m := &SystemMonitor{procDir: procDir}
+
+	disks, err := m.readDiskStats()
+	if err != nil {
+		return nil, err
+	}
+
+	logger := Logger()
+
+	for _, path := range paths {
+		major, minor, e := deviceNumber(path)
+		if e != nil {
+			logger.Infof("cannot find device for %s: %s", path, e)
+			continue
+		}
+
+		d := m.device(major, minor)
+
+		if d == nil {
+			stats := findDisk(disks, major, minor)
+			if stats == nil {
+				logger.Infof("%s isn't on a block device (%d:%d); not sampling its device", path, major, minor)
+				continue
+			}
+
+			d = &monitoredDevice{major: major, minor: minor, last: *stats}
+			m.devices = append(m.devices, d)
+			logger.Infof("sampling device %s for %s", stats.Name, path)
+		}
+
+		d.paths = append(d.paths, path)
+	}
+
+	if m.cpu, err = m.readCPUTimes(); err != nil {
+		return nil, err
+	}
+
+	m.last = time.Now()
+	return m, nil
+}
+
+func (m *SystemMonitor) device(major, minor uint32) *monitoredDevice {
+	for _, d := range m.devices {
+		if d.major == major && d.minor == minor {
+			return d
+		}
+	}
+	return nil
+}
+
+// Sample returns the stats since the last sample.
+func (m *SystemMonitor) Sample(now time.Time) (*SystemStats, error) {
+	disks, err := m.readDiskStats()
+	if err != nil {
+		return nil, err
+	}
+
+	cpu, err := m.readCPUTimes()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &SystemStats{CPU: cpuUsage(m.cpu, cpu)}
+	interval := now.Sub(m.last)
+
+	if s.Memory, err = m.readMemInfo(); err != nil {
+		return nil, err
+	}
+
+	for _, d := range m.devices {
+		stats := findDisk(disks, d.major, d.minor)
+		if stats == nil {
+			continue // removed, perhaps
+		}
+
+		rates := diskRates(d.last, *stats, interval)
+		rates.Paths = d.paths
+		s.Devices = append(s.Devices, rates)
+		d.last = *stats
+	}
+
+	m.cpu, m.last = cpu, now
+	return s, nil
+}
+
+func (m *SystemMonitor) readDiskStats() ([]DiskStats, error) {
+	f, err := os.Open(filepath.Join(m.procDir, "diskstats"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseDiskStats(f)
+}
+
+func (m *SystemMonitor) readMemInfo() (MemInfo, error) {
+	f, err := os.Open(filepath.Join(m.procDir, "meminfo"))
+	if err != nil {
+		return MemInfo{}, err
+	}
+	defer f.Close()
+	return parseMemInfo(f)
+}
+
+func (m *SystemMonitor) readCPUTimes() (CPUTimes, error) {
+	f, err := os.Open(filepath.Join(m.procDir, "stat"))
+	if err != nil {
+		return CPUTimes{}, err
+	}
+	defer f.Close()
+	return parseCPUTimes(f)
+}
+
+func findDisk(disks []DiskStats, major, minor uint32) *DiskStats {
+	for i := range disks {
+		if disks[i].Major == major && disks[i].Minor == minor {
+			return &disks[i]
+		}
+	}
+	return nil
+}
+
+// deviceNumber returns the major and minor numbers of the device holding
+// path.
+func deviceNumber(path string) (major, minor uint32, err error) {
+	var st unix.Stat_t
+
+	if err = unix.Stat(path, &st); err != nil {
+		return 0, 0, err
+	}
+
+	return unix.Major(uint64(st.Dev)), unix.Minor(uint64(st.Dev)), nil
+}
+
+// parseDiskStats parses /proc/diskstats: major, minor and name, then (for
+// the fields used here) reads completed, reads merged, sectors read, ms
+// reading, writes completed, writes merged, sectors written, ms writing,
+// I/Os in progress, ms doing I/O and weighted ms doing I/O. Newer kernels
+// add discard and flush fields after these.
+func parseDiskStats(r io.Reader) ([]DiskStats, error) {
+	var disks []DiskStats
+	scanner := bufio.NewScanner(r)
+
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 14 {
+			return nil, fmt.Errorf("diskstats line %d: expected at least 14 fields, got %d", line, len(fields))
+		}
+
+		var n [14]uint64
+		for i := range n {
+			if i == 2 {
+				continue // the name
+			}
+
+			v, e := strconv.ParseUint(fields[i], 10, 64)
+			if e != nil {
+				return nil, fmt.Errorf("diskstats line %d: invalid field %d '%s'", line, i+1, fields[i])
+			}
+			n[i] = v
+		}
+
+		disks = append(disks, DiskStats{
+			Major:        uint32(n[0]),
+			Minor:        uint32(n[1]),
+			Name:         fields[2],
+			Reads:        n[3],
+			ReadSectors:  n[5],
+			Writes:       n[7],
+			WriteSectors: n[9],
+			InFlight:     n[11],
+			IoTicks:      n[12],
+			QueueTicks:   n[13],
+		})
+	}
+
+	return disks, scanner.Err()
+}
+
+// parseMemInfo parses the dirty and writeback sizes from /proc/meminfo.
+func parseMemInfo(r io.Reader) (MemInfo, error) {
+	var m MemInfo
+	found := 0
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+
+		var field *int64
+		switch key {
+		case "Dirty":
+			field = &m.Dirty
+		case "Writeback":
+			field = &m.Writeback
+		default:
+			continue
+		}
+
+		fields := strings.Fields(value)
+		if len(fields) != 2 || fields[1] != "kB" {
+			return m, fmt.Errorf("meminfo: invalid %s '%s'", key, strings.TrimSpace(value))
+		}
+
+		kb, e := strconv.ParseInt(fields[0], 10, 64)
+		if e != nil {
+			return m, fmt.Errorf("meminfo: invalid %s '%s'", key, strings.TrimSpace(value))
+		}
+
+		*field = kb * 1024
+		found++
+	}
+
+	if e := scanner.Err(); e != nil {
+		return m, e
+	}
+
+	if found < 2 {
+		return m, fmt.Errorf("meminfo: no Dirty and Writeback")
+	}
+
+	return m, nil
+}
+
+// parseCPUTimes parses the "cpu" line, the total for all CPUs, from
+// /proc/stat. Older kernels may leave out the later fields.
+func parseCPUTimes(r io.Reader) (CPUTimes, error) {
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || fields[0] != "cpu" {
+			continue
+		}
+
+		var c CPUTimes
+		times := []*uint64{&c.User, &c.Nice, &c.System, &c.Idle, &c.IOWait, &c.IRQ, &c.SoftIRQ, &c.Steal}
+
+		if len(fields) < 5 {
+			return c, fmt.Errorf("stat: expected at least 4 cpu times, got %d", len(fields)-1)
+		}
+
+		for i, t := range times {
+			if i+1 >= len(fields) {
+				break
+			}
+
+			v, e := strconv.ParseUint(fields[i+1], 10, 64)
+			if e != nil {
+				return c, fmt.Errorf("stat: invalid cpu time '%s'", fields[i+1])
+			}
+			*t = v
+		}
+
+		return c, nil
+	}
+
+	if e := scanner.Err(); e != nil {
+		return CPUTimes{}, e
+	}
+
+	return CPUTimes{}, fmt.Errorf("stat: no cpu line")
+}
+
+// diskRates works out a device's rates between two samples.
+func diskRates(prev, cur DiskStats, interval time.Duration) DeviceStats {
+	d := DeviceStats{Name: cur.Name}
+	sec := interval.Seconds()
+	ms := sec * 1000
+
+	if sec <= 0 {
+		return d
+	}
+
+	d.ReadBandwidth = int64(float64(counterDelta(prev.ReadSectors, cur.ReadSectors)*diskSectorSize) / sec)
+	d.WriteBandwidth = int64(float64(counterDelta(prev.WriteSectors, cur.WriteSectors)*diskSectorSize) / sec)
+	d.ReadIOPS = float64(counterDelta(prev.Reads, cur.Reads)) / sec
+	d.WriteIOPS = float64(counterDelta(prev.Writes, cur.Writes)) / sec
+	d.Utilization = float64(counterDelta(prev.IoTicks, cur.IoTicks)) * 100 / ms
+	d.QueueDepth = float64(counterDelta(prev.QueueTicks, cur.QueueTicks)) / ms
+
+	if d.Utilization > 100 {
+		d.Utilization = 100 // ticks and the interval are measured separately
+	}
+
+	return d
+}
+
+// counterDelta is how much a counter went up, allowing for it having
+// wrapped (some are 32 bits on 32-bit kernels) or been reset.
+func counterDelta(prev, cur uint64) uint64 {
+	if cur < prev {
+		return 0
+	}
+	return cur - prev
+}
+
+// cpuUsage works out the CPU usage between two samples. Nice time counts
+// as user and interrupt time as system.
+func cpuUsage(prev, cur CPUTimes) CPUUsage {
+	total := float64(counterDelta(prev.total(), cur.total()))
+
+	if total == 0 {
+		return CPUUsage{}
+	}
+
+	percent := func(prev, cur uint64) float64 {
+		return float64(counterDelta(prev, cur)) * 100 / total
+	}
+
+	return CPUUsage{
+		User:   percent(prev.User+prev.Nice, cur.User+cur.Nice),
+		System: percent(prev.System+prev.IRQ+prev.SoftIRQ, cur.System+cur.IRQ+cur.SoftIRQ),
+		IOWait: percent(prev.IOWait, cur.IOWait),
+		Idle:   percent(prev.Idle, cur.Idle),
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseDiskStats(t *testing.T) {
+	f, err := os.Open("testdata/proc/diskstats")
+	AbortOnError(t, err)
+	defer f.Close()
+
+	disks, err := parseDiskStats(f)
+	AbortOnError(t, err)
+	ExpectEqual(t, 5, len(disks))
+
+	nvme := disks[1]
+	ExpectEqual(t, uint32(259), nvme.Major)
+	ExpectEqual(t, uint32(0), nvme.Minor)
+	ExpectEqual(t, "nvme0n1", nvme.Name)
+	ExpectEqual(t, uint64(843027), nvme.Reads)
+	ExpectEqual(t, uint64(61238174), nvme.ReadSectors)
+	ExpectEqual(t, uint64(2745198), nvme.Writes)
+	ExpectEqual(t, uint64(421775688), nvme.WriteSectors)
+	ExpectEqual(t, uint64(3), nvme.InFlight)
+	ExpectEqual(t, uint64(2210456), nvme.IoTicks)
+	ExpectEqual(t, uint64(6289040), nvme.QueueTicks)
+
+	// Kernels before 4.18 have no discard fields
+	sdb := disks[3]
+	ExpectEqual(t, "sdb", sdb.Name)
+	ExpectEqual(t, uint64(5110), sdb.IoTicks)
+	ExpectEqual(t, uint64(6310), sdb.QueueTicks)
+
+	ExpectEqual(t, "dm-0", findDisk(disks, 253, 0).Name)
+	ExpectEqual(t, (*DiskStats)(nil), findDisk(disks, 8, 0))
+
+	for _, c := range []struct {
+		input    string
+		expected string
+	}{
+		{"   8       0 sda 1 2 3\n", "diskstats line 1: expected at least 14 fields, got 6"},
+		{"\n   8       0 sda 1 2 3 4 5 6 x 8 9 10 11\n", "diskstats line 2: invalid field 10 'x'"},
+	} {
+		_, err := parseDiskStats(strings.NewReader(c.input))
+		if err == nil || err.Error() != c.expected {
+			t.Errorf("expected %q, got %v", c.expected, err)
+		}
+	}
+}
+
+func TestParseMemInfo(t *testing.T) {
+	f, err := os.Open("testdata/proc/meminfo")
+	AbortOnError(t, err)
+	defer f.Close()
+
+	m, err := parseMemInfo(f)
+	AbortOnError(t, err)
+	ExpectEqual(t, int64(512<<20), m.Dirty)
+	ExpectEqual(t, int64(16<<20), m.Writeback)
+
+	for _, c := range []struct {
+		input    string
+		expected string
+	}{
+		{"MemTotal: 1 kB\nDirty: 1 kB\n", "meminfo: no Dirty and Writeback"},
+		{"Dirty: 1 MB\nWriteback: 0 kB\n", "meminfo: invalid Dirty '1 MB'"},
+		{"Dirty: 1 kB\nWriteback: lots kB\n", "meminfo: invalid Writeback 'lots kB'"},
+	} {
+		_, err := parseMemInfo(strings.NewReader(c.input))
+		if err == nil || err.Error() != c.expected {
+			t.Errorf("expected %q, got %v", c.expected, err)
+		}
+	}
+}
+
+func TestParseCPUTimes(t *testing.T) {
+	f, err := os.Open("testdata/proc/stat")
+	AbortOnError(t, err)
+	defer f.Close()
+
+	c, err := parseCPUTimes(f)
+	AbortOnError(t, err)
+	ExpectEqual(t, CPUTimes{User: 2255341, Nice: 1034, System: 640127, Idle: 58834291, IOWait: 128304, SoftIRQ: 21567}, c)
+
+	// Old kernels have fewer fields
+	c, err = parseCPUTimes(strings.NewReader("cpu  10 20 30 40\n"))
+	AbortOnError(t, err)
+	ExpectEqual(t, CPUTimes{User: 10, Nice: 20, System: 30, Idle: 40}, c)
+
+	for _, c := range []struct {
+		input    string
+		expected string
+	}{
+		{"cpu0 1 2 3 4\nintr 1\n", "stat: no cpu line"},
+		{"cpu 1 2 3\n", "stat: expected at least 4 cpu times, got 3"},
+		{"cpu 1 2 -3 4\n", "stat: invalid cpu time '-3'"},
+	} {
+		_, err := parseCPUTimes(strings.NewReader(c.input))
+		if err == nil || err.Error() != c.expected {
+			t.Errorf("expected %q, got %v", c.expected, err)
+		}
+	}
+}
+
+func TestDiskRates(t *testing.T) {
+	prev := DiskStats{Name: "sda", Reads: 100, ReadSectors: 2000, Writes: 50, WriteSectors: 4000, IoTicks: 1000, QueueTicks: 5000}
+	cur := DiskStats{Name: "sda", Reads: 300, ReadSectors: 6096, Writes: 250, WriteSectors: 8096, IoTicks: 1500, QueueTicks: 7000}
+
+	d := diskRates(prev, cur, 2*time.Second)
+	ExpectEqual(t, "sda", d.Name)
+	ExpectEqual(t, int64(1<<20), d.ReadBandwidth)
+	ExpectEqual(t, int64(1<<20), d.WriteBandwidth)
+	ExpectEqual(t, 100.0, d.ReadIOPS)
+	ExpectEqual(t, 100.0, d.WriteIOPS)
+	ExpectEqual(t, 25.0, d.Utilization)
+	ExpectEqual(t, 1.0, d.QueueDepth)
+
+	// Counters that went backwards count as no change
+	d = diskRates(cur, prev, time.Second)
+	ExpectEqual(t, int64(0), d.WriteBandwidth)
+	ExpectEqual(t, 0.0, d.Utilization)
+}
+
+func TestCPUUsage(t *testing.T) {
+	prev := CPUTimes{User: 100, Nice: 0, System: 50, Idle: 800, IOWait: 50}
+	cur := CPUTimes{User: 140, Nice: 10, System: 70, Idle: 1000, IOWait: 70, IRQ: 5, SoftIRQ: 5}
+
+	u := cpuUsage(prev, cur)
+	ExpectEqual(t, 16.666666666666668, u.User)
+	ExpectEqual(t, 10.0, u.System)
+	ExpectEqual(t, 6.666666666666667, u.IOWait)
+	ExpectEqual(t, 66.66666666666667, u.Idle)
+
+	ExpectEqual(t, CPUUsage{}, cpuUsage(cur, cur))
+}
+
+func TestSystemMonitor(t *testing.T) {
+	dir := t.TempDir()
+	major, minor, err := deviceNumber(dir)
+	AbortOnError(t, err)
+
+	proc := filepath.Join(dir, "proc")
+	AbortOnError(t, os.Mkdir(proc, 0755))
+
+	write := func(name, content string) {
+		AbortOnError(t, os.WriteFile(filepath.Join(proc, name), []byte(content), 0644))
+	}
+
+	write("meminfo", "Dirty: 2048 kB\nWriteback: 1024 kB\n")
+	write("stat", "cpu  100 0 100 800 0 0 0 0\n")
+	write("diskstats", fmt.Sprintf("%d %d disk0 0 0 0 0 0 0 0 0 0 0 0\n", major, minor))
+
+	m, err := NewSystemMonitor(proc, []string{dir, proc, filepath.Join(dir, "missing")})
+	AbortOnError(t, err)
+
+	write("stat", "cpu  200 0 200 1600 0 0 0 0\n")
+	write("diskstats", fmt.Sprintf("%d %d disk0 10 0 2048 0 20 0 4096 0 1 500 1000\n", major, minor))
+
+	s, err := m.Sample(m.last.Add(time.Second))
+	AbortOnError(t, err)
+
+	ExpectEqual(t, 1, len(s.Devices))
+	d := s.Devices[0]
+	ExpectEqual(t, "disk0", d.Name)
+	ExpectEqual(t, 2, len(d.Paths)) // dir and proc, on the same device
+	ExpectEqual(t, int64(1<<20), d.ReadBandwidth)
+	ExpectEqual(t, int64(2<<20), d.WriteBandwidth)
+	ExpectEqual(t, 30.0, d.ReadIOPS+d.WriteIOPS)
+	ExpectEqual(t, 50.0, d.Utilization)
+	ExpectEqual(t, 1.0, d.QueueDepth)
+	ExpectEqual(t, CPUUsage{User: 10, System: 10, Idle: 80}, s.CPU)
+	ExpectEqual(t, MemInfo{Dirty: 2 << 20, Writeback: 1 << 20}, s.Memory)
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// TraceRecord is one operation in a workload trace. Traces are either CSV,
+// with columns in the order below, or JSON lines with these field names:
+//
+//	timestamp  seconds (any origin; only differences matter)
+//	op         read, write, or delete
+//	object     object name, relative to the store
+//	offset     byte offset of a read or write
+//	length     bytes read or written
+//
+// Other JSON fields are ignored, and CSV lines may have extra columns. In
+// CSV, a header line, blank lines and lines starting with '#' are skipped.
+type TraceRecord struct {
+	Timestamp float64
+	Op        int
+	Object    string
+	Offset    int64
+	Length    int64
+}
+
+// traceJSON is the JSON form of a trace record. Traces recorded by
+// TraceRecorder have the extra fields, which replay ignores.
+type traceJSON struct {
+	Timestamp float64 `json:"timestamp"`
+	Op        string  `json:"op"`
+	Object    string  `json:"object"`
+	Offset    int64   `json:"offset"`
+	Length    int64   `json:"length"`
+	Runner    int     `json:"runner,omitempty"`
+	Duration  float64 `json:"duration,omitempty"` // seconds
+	Error     string  `json:"error,omitempty"`
+}
+
+func parseTraceOp(op string) (int, error) {
+	switch strings.ToLower(strings.TrimSpace(op)) {
+	case "read", "r":
+		return Read, nil
+	case "write", "w":
+		return Write, nil
+	case "delete", "d", "unlink", "trim":
+		return Delete, nil
+	default:
+		return 0, fmt.Errorf("unknown op '%s'; use read, write, or delete", op)
+	}
+}
+
+func (tr *TraceRecord) validate() error {
+	if len(tr.Object) == 0 {
+		return fmt.Errorf("no object name")
+	}
+
+	if tr.Offset < 0 || tr.Length < 0 {
+		return fmt.Errorf("negative offset or length")
+	}
+
+	return nil
+}
+
+// ReadTrace reads a whole trace file, in CSV or JSON lines format (decided
+// by the first character), returning its records in timestamp order.
+func ReadTrace(path string) ([]TraceRecord, error) {
+	f, e := os.Open(path)
+
+	if e != nil {
+		return nil, fmt.Errorf("cannot read trace: %s", e)
+	}
+
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var records []TraceRecord
+
+	if isJSONLines(r) {
+		records, e = readTraceJSON(path, r)
+	} else {
+		records, e = readTraceCSV(path, r)
+	}
+
+	if e != nil {
+		return nil, e
+	}
+
+	// Recorded traces are written in batches per runner, so they're only
+	// roughly in order.
+	sort.SliceStable(records, func(i, j int) bool { return records[i].Timestamp < records[j].Timestamp })
+
+	return records, nil
+}
+
+// isJSONLines peeks at the first non-space byte to see if it's a JSON object.
+func isJSONLines(r *bufio.Reader) bool {
+	for n := 1; ; n++ {
+		buf, e := r.Peek(n)
+		if e != nil {
+			return false
+		}
+
+		switch buf[n-1] {
+		case ' ', '\t', '\r', '\n':
+			continue
+		default:
+			return buf[n-1] == '{'
+		}
+	}
+}
+
+func readTraceJSON(path string, r *bufio.Reader) ([]TraceRecord, error) {
+	var records []TraceRecord
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+
+		if len(text) == 0 {
+			continue
+		}
+
+		var j traceJSON
+		if e := json.Unmarshal([]byte(text), &j); e != nil {
+			return nil, fmt.Errorf("%s:%d: %s", path, line, e)
+		}
+
+		op, e := parseTraceOp(j.Op)
+		if e != nil {
+			return nil, fmt.Errorf("%s:%d: %s", path, line, e)
+		}
+
+		tr := TraceRecord{j.Timestamp, op, j.Object, j.Offset, j.Length}
+		if e = tr.validate(); e != nil {
+			return nil, fmt.Errorf("%s:%d: %s", path, line, e)
+		}
+
+		records = append(records, tr)
+	}
+
+	if e := scanner.Err(); e != nil {
+		return nil, fmt.Errorf("cannot read trace: %s", e)
+	}
+
+	return records, nil
+}
+
+func readTraceCSV(path string, r io.Reader) ([]TraceRecord, error) {
+	var records []TraceRecord
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	for n := 0; ; n++ {
+		fields, e := cr.Read()
+
+		if e == io.EOF {
+			break
+		} else if e != nil {
+			return nil, fmt.Errorf("%s: %s", path, e)
+		}
+
+		line, _ := cr.FieldPos(0)
+
+		if len(fields) < 5 {
+			return nil, fmt.Errorf("%s:%d: expected timestamp, op, object, offset, length", path, line)
+		}
+
+		tr, e := parseTraceFields(fields)
+		if e != nil {
+			if n == 0 {
+				continue // header
+			}
+			return nil, fmt.Errorf("%s:%d: %s", path, line, e)
+		}
+
+		records = append(records, tr)
+	}
+
+	return records, nil
+}
+
+func parseTraceFields(fields []string) (tr TraceRecord, e error) {
+	if tr.Timestamp, e = strconv.ParseFloat(fields[0], 64); e != nil {
+		return tr, fmt.Errorf("cannot parse timestamp '%s'", fields[0])
+	}
+
+	if tr.Op, e = parseTraceOp(fields[1]); e != nil {
+		return tr, e
+	}
+
+	tr.Object = fields[2]
+
+	if tr.Offset, e = strconv.ParseInt(fields[3], 10, 64); e != nil {
+		return tr, fmt.Errorf("cannot parse offset '%s'", fields[3])
+	}
+
+	if tr.Length, e = strconv.ParseInt(fields[4], 10, 64); e != nil {
+		return tr, fmt.Errorf("cannot parse length '%s'", fields[4])
+	}
+
+	return tr, tr.validate()
+}
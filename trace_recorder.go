@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// TraceRecorder logs every op the runners perform to a JSON lines trace
+// that ReadTrace can replay. Each runner collects records in its own
+// TraceBuffer and hands over whole buffers, so runners only contend for the
+// file every few hundred ops.
+type TraceRecorder struct {
+	*zap.SugaredLogger
+	lock    sync.Mutex
+	file    *os.File
+	origin  time.Time // timestamps are seconds since this
+	records int64
+	failed  bool // a write failed; further records are dropped
+}
+
+// TraceBuffer collects one runner's records. A nil buffer records nothing,
+// so runners needn't check whether tracing is on.
+type TraceBuffer struct {
+	recorder *TraceRecorder
+	runner   int
+	buf      bytes.Buffer
+	enc      *json.Encoder
+	records  int64
+	rec      traceJSON
+}
+
+// traceFlushSize is how much a TraceBuffer holds before writing it out.
+const traceFlushSize = 64 * 1024
+
+func NewTraceRecorder(path string) (*TraceRecorder, error) {
+	f, e := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0664)
+
+	if e != nil {
+		return nil, fmt.Errorf("failed creating trace log: %s", e)
+	}
+
+	t := &TraceRecorder{
+		SugaredLogger: Logger(),
+		file:          f,
+		origin:        time.Now(),
+	}
+
+	t.Infof("recording op trace in %s", path)
+	return t, nil
+}
+
+// Start resets the trace's origin to now. Call it just before closing
+// global.Start.
+func (t *TraceRecorder) Start() {
+	t.origin = time.Now()
+}
+
+func (t *TraceRecorder) NewBuffer(runner int) *TraceBuffer {
+	b := &TraceBuffer{recorder: t, runner: runner}
+	b.buf.Grow(traceFlushSize + 1024)
+	b.enc = json.NewEncoder(&b.buf)
+	return b
+}
+
+func (t *TraceRecorder) write(p []byte, records int64) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.failed {
+		return
+	}
+
+	if _, e := t.file.Write(p); e != nil {
+		t.Errorf("failed writing to trace log, no longer recording: %s", e)
+		t.failed = true
+		return
+	}
+
+	t.records += records
+}
+
+// Close closes the trace file. Runners must have flushed their buffers.
+func (t *TraceRecorder) Close() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if e := t.file.Close(); e != nil && !t.failed {
+		t.Errorf("failed closing trace log: %s", e)
+	}
+
+	t.Infof("recorded %d ops in trace", t.records)
+}
+
+// Record adds an op that started at start and has just finished. Object
+// names are relative to the store, as replay expects.
+func (b *TraceBuffer) Record(op int, object string, offset int64, size int, start time.Time, err error) {
+	if b == nil {
+		return
+	}
+
+	b.rec = traceJSON{
+		Timestamp: start.Sub(b.recorder.origin).Seconds(),
+		Op:        opName(op),
+		Object:    object,
+		Offset:    offset,
+		Length:    int64(size),
+		Runner:    b.runner,
+		Duration:  time.Since(start).Seconds(),
+	}
+
+	if err != nil {
+		b.rec.Error = err.Error()
+	}
+
+	if e := b.enc.Encode(&b.rec); e != nil {
+		return // can't happen with these types
+	}
+
+	b.records++
+
+	if b.buf.Len() >= traceFlushSize {
+		b.Flush()
+	}
+}
+
+// Flush hands buffered records to the recorder.
+func (b *TraceBuffer) Flush() {
+	if b == nil || b.buf.Len() == 0 {
+		return
+	}
+
+	b.recorder.write(b.buf.Bytes(), b.records)
+	b.buf.Reset()
+	b.records = 0
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func writeTraceFile(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "trace")
+	AbortOnError(t, os.WriteFile(path, []byte(contents), 0644))
+	return path
+}
+
+func TestReadTrace_CSV(t *testing.T) {
+	path := writeTraceFile(t, `timestamp,op,object,offset,length
+# comment
+0.5, write, a/one, 0, 4096
+
+0.25,read,a/two,8192,512,extra
+1,d,a/one,0,0
+`)
+
+	records, err := ReadTrace(path)
+	AbortOnError(t, err)
+
+	expected := []TraceRecord{
+		{0.25, Read, "a/two", 8192, 512},
+		{0.5, Write, "a/one", 0, 4096},
+		{1, Delete, "a/one", 0, 0},
+	}
+
+	ExpectEqual(t, len(expected), len(records))
+	for i := range expected {
+		ExpectEqual(t, expected[i], records[i])
+	}
+}
+
+func TestReadTrace_JSON(t *testing.T) {
+	path := writeTraceFile(t, `
+{"timestamp": 2, "op": "read", "object": "x", "offset": 10, "length": 20, "runner": 3}
+{"timestamp": 1, "op": "WRITE", "object": "x", "offset": 0, "length": 30}
+
+{"timestamp": 1, "op": "unlink", "object": "y"}
+`)
+
+	records, err := ReadTrace(path)
+	AbortOnError(t, err)
+
+	// Sorting is stable, so the two ops at 1 sec stay in file order
+	expected := []TraceRecord{
+		{1, Write, "x", 0, 30},
+		{1, Delete, "y", 0, 0},
+		{2, Read, "x", 10, 20},
+	}
+
+	ExpectEqual(t, len(expected), len(records))
+	for i := range expected {
+		ExpectEqual(t, expected[i], records[i])
+	}
+}
+
+func TestReadTrace_InvalidInput(t *testing.T) {
+	for _, contents := range []string{
+		"0,read,x,0,1\n1,read,x\n",
+		"0,read,x,0,1\n1,append,x,0,1\n",
+		"0,read,x,0,1\nsoon,read,x,0,1\n",
+		"0,read,x,0,1\n1,read,x,-1,1\n",
+		"0,read,x,0,1\n1,read,,0,1\n",
+		"0,read,x,0,1\n1,read,x,0,lots\n",
+		`{"timestamp": 0, "op": "read", "object": "x"}` + "\n{\n",
+		`{"timestamp": 0, "op": "seek", "object": "x"}`,
+		`{"timestamp": 0, "op": "read", "object": ""}`,
+	} {
+		_, err := ReadTrace(writeTraceFile(t, contents))
+		ExpectErrorf(t, err, "expected error for trace:\n%s", contents)
+	}
+
+	_, err := ReadTrace(filepath.Join(t.TempDir(), "missing"))
+	ExpectError(t, err)
+}
+
+func TestFileObjectStore_OpenObject(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileObjectStore(dir, 0, false)
+	AbortOnError(t, err)
+
+	_, err = store.OpenObject("sub/obj", false)
+	ExpectErrorf(t, err, "opened object that doesn't exist")
+
+	f, err := store.OpenObject("sub/obj", true)
+	AbortOnError(t, err)
+
+	_, err = f.WriteAt([]byte("hello"), 10)
+	AbortOnError(t, err)
+	AbortOnError(t, f.Close())
+
+	info, err := os.Stat(filepath.Join(dir, "sub", "obj"))
+	AbortOnError(t, err)
+	ExpectEqual(t, info.Size(), int64(15))
+
+	// Names can't escape the store
+	f, err = store.OpenObject("../../escaped", true)
+	AbortOnError(t, err)
+	AbortOnError(t, f.Close())
+
+	_, err = os.Stat(filepath.Join(dir, "escaped"))
+	AbortOnError(t, err)
+
+	AbortOnError(t, store.DeleteObject("sub/obj"))
+	_, err = os.Stat(filepath.Join(dir, "sub", "obj"))
+	ExpectErrorf(t, err, "object still exists after delete")
+}
+
+func TestTraceRecorder_Replayable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trace.jsonl")
+	recorder, err := NewTraceRecorder(path)
+	AbortOnError(t, err)
+	recorder.Start()
+
+	a := recorder.NewBuffer(1)
+	b := recorder.NewBuffer(2)
+	var none *TraceBuffer
+
+	start := time.Now()
+	a.Record(Write, "dir-0/a.dat", 0, 4096, start, nil)
+	b.Record(Read, "dir-1/b.dat", 8192, 100, start.Add(time.Millisecond), nil)
+	a.Record(Delete, "dir-0/a.dat", 0, 0, start.Add(2*time.Millisecond), syscall.ENOENT)
+	none.Record(Write, "ignored", 0, 1, start, nil)
+
+	// Enough to flush part way through
+	for i := 0; i < 2000; i++ {
+		b.Record(Write, "dir-1/c.dat", int64(i)*512, 512, start.Add(time.Duration(3+i)*time.Millisecond), nil)
+	}
+
+	b.Flush()
+	a.Flush()
+	none.Flush()
+	recorder.Close()
+
+	records, err := ReadTrace(path)
+	AbortOnError(t, err)
+	ExpectEqual(t, 2003, len(records))
+
+	ExpectEqual(t, Write, records[0].Op)
+	ExpectEqual(t, "dir-0/a.dat", records[0].Object)
+	ExpectEqual(t, int64(4096), records[0].Length)
+	ExpectEqual(t, Read, records[1].Op)
+	ExpectEqual(t, int64(8192), records[1].Offset)
+	ExpectEqual(t, Delete, records[2].Op)
+
+	for i := 1; i < len(records); i++ {
+		if records[i].Timestamp < records[i-1].Timestamp {
+			t.Fatalf("records out of order at %d", i)
+		}
+	}
+
+	// The extra fields are there for anyone reading the file directly
+	data, err := os.ReadFile(path)
+	AbortOnError(t, err)
+
+	if !strings.Contains(string(data), `"runner":1`) || !strings.Contains(string(data), `"error":"no such file or directory"`) {
+		t.Errorf("trace missing runner or error fields")
+	}
+}
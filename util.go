@@ -2,7 +2,6 @@ package main
 
 import (
 	"fmt"
-	"os/exec"
 	"sort"
 	"strconv"
 	"strings"
@@ -93,12 +92,15 @@ func SprintDecimalSize(size int64) string {
 	}
 }
 
+// Median returns the median of data, which is left in its original order
+// (e.g. intervals in time order).
 func Median(data []int64) int64 {
 	l := len(data)
 	if l == 0 {
 		return 0
 	}
 
+	data = append([]int64(nil), data...)
 	sort.Slice(data, func(i, j int) bool { return data[i] < data[j] })
 
 	if l%2 == 0 {
@@ -122,13 +124,3 @@ func Mean(data []int64) int64 {
 
 	return sum / int64(l)
 }
-
-func RunCmd(command string) (out []byte, e error) {
-	c := strings.Split(command, " ")
-	out, e = exec.Command(c[0], c[1:]...).Output()
-	if e != nil {
-		return nil, fmt.Errorf("running '%s': %s", command, e)
-	}
-
-	return
-}
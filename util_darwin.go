@@ -1,15 +1,42 @@
 package main
 
-import "os"
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
 
-func parseOpenFlags(flags []string) int {
+// parseOpenFlags converts file.open_flags to flags for os.OpenFile.
+func parseOpenFlags(flags []string) (int, error) {
 	openFlags := 0
 
 	for _, flag := range flags {
 		switch flag {
 		case "o_sync", "O_SYNC", "sync", "SYNC":
 			openFlags |= os.O_SYNC
+		default:
+			return 0, fmt.Errorf("unknown file.open_flags '%s'; use sync", flag)
 		}
 	}
-	return openFlags
+
+	return openFlags, nil
+}
+
+// diskUsage returns the percent of space used on the file system holding
+// path, calculated the same way as df (reserved blocks count as used).
+func diskUsage(path string) (float64, error) {
+	var st syscall.Statfs_t
+
+	if e := syscall.Statfs(path, &st); e != nil {
+		return 0, e
+	}
+
+	used := uint64(st.Blocks) - uint64(st.Bfree)
+	avail := uint64(st.Bavail)
+
+	if used+avail == 0 {
+		return 0, nil
+	}
+
+	return float64(used) * 100 / float64(used+avail), nil
 }
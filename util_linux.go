@@ -1,11 +1,13 @@
 package main
 
 import (
+	"fmt"
 	"os"
 	"syscall"
 )
 
-func parseOpenFlags(flags []string) int {
+// parseOpenFlags converts file.open_flags to flags for os.OpenFile.
+func parseOpenFlags(flags []string) (int, error) {
 	openFlags := 0
 
 	for _, flag := range flags {
@@ -14,8 +16,29 @@ func parseOpenFlags(flags []string) int {
 			openFlags |= os.O_SYNC
 		case "o_direct", "O_DIRECT", "direct", "DIRECT":
 			openFlags |= syscall.O_DIRECT
+		default:
+			return 0, fmt.Errorf("unknown file.open_flags '%s'; use sync or direct", flag)
 		}
 	}
 
-	return openFlags
+	return openFlags, nil
+}
+
+// diskUsage returns the percent of space used on the file system holding
+// path, calculated the same way as df (reserved blocks count as used).
+func diskUsage(path string) (float64, error) {
+	var st syscall.Statfs_t
+
+	if e := syscall.Statfs(path, &st); e != nil {
+		return 0, e
+	}
+
+	used := uint64(st.Blocks) - uint64(st.Bfree)
+	avail := uint64(st.Bavail)
+
+	if used+avail == 0 {
+		return 0, nil
+	}
+
+	return float64(used) * 100 / float64(used+avail), nil
 }
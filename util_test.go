@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"math"
+	"path/filepath"
 	"runtime/debug"
 	"testing"
 )
@@ -14,6 +15,10 @@ func TestMedian(t *testing.T) {
 	ExpectEqual(t, int64(20), Median([]int64{10, 20, 30}))
 	ExpectEqual(t, int64(25), Median([]int64{10, 20, 30, 40}))
 	ExpectEqual(t, int64(30), Median([]int64{10, 20, 30, 40, 50}))
+
+	data := []int64{30, 10, 20}
+	ExpectEqual(t, int64(20), Median(data))
+	ExpectEqual(t, int64(30), data[0])
 }
 
 func TestMean(t *testing.T) {
@@ -29,6 +34,18 @@ func TestSprintSize(t *testing.T) {
 	fmt.Printf("max int64: %s\n", SprintSize(math.MaxInt64))
 }
 
+func TestDiskUsage(t *testing.T) {
+	percent, err := diskUsage(t.TempDir())
+	AbortOnError(t, err)
+
+	if percent < 0 || percent > 100 {
+		t.Errorf("expected a percent between 0 and 100, got %f", percent)
+	}
+
+	_, err = diskUsage(filepath.Join(t.TempDir(), "missing"))
+	ExpectError(t, err)
+}
+
 func ExpectEqual(t *testing.T, expected, actual interface{}) {
 	t.Helper()
 	if expected != actual {
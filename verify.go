@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+type VerifyMode int
+
+const (
+	VerifyOff   VerifyMode = iota
+	VerifyLog              // count and log mismatches
+	VerifyAbort            // stop the run on the first mismatch
+)
+
+func parseVerifyMode(mode string) (VerifyMode, error) {
+	switch mode {
+	case "", "none", "off", "false":
+		return VerifyOff, nil
+	case "log", "true":
+		return VerifyLog, nil
+	case "abort":
+		return VerifyAbort, nil
+	default:
+		return VerifyOff, fmt.Errorf("unknown verify mode '%s'; use none, log, or abort", mode)
+	}
+}
+
+type VerifyStatus int
+
+const (
+	VerifyIntact       VerifyStatus = iota
+	VerifyUnverifiable              // no header (too small, or not written by this version of perftest)
+	VerifyTruncated                 // shorter than the size in its header
+	VerifyCorrupted                 // contents differ from what was written
+	VerifyMissing                   // expected but not found (standalone verify only)
+	verifyStatusCount
+)
+
+func (s VerifyStatus) String() string {
+	switch s {
+	case VerifyIntact:
+		return "intact"
+	case VerifyUnverifiable:
+		return "unverifiable"
+	case VerifyTruncated:
+		return "truncated"
+	case VerifyCorrupted:
+		return "corrupted"
+	case VerifyMissing:
+		return "missing"
+	default:
+		return fmt.Sprintf("status %d", int(s))
+	}
+}
+
+// VerifyResult describes how an object compared to its expected contents.
+type VerifyResult struct {
+	Status     VerifyStatus
+	Size       int64 // bytes actually read
+	Expected   int64 // size recorded in header (0 if no header)
+	Mismatched int64 // bytes that differ
+	Offset     int64 // offset of first mismatch
+	Want, Got  byte  // expected and actual byte at Offset
+	Detail     string
+}
+
+func (r *VerifyResult) String() string {
+	switch r.Status {
+	case VerifyCorrupted:
+		if r.Detail != "" {
+			return fmt.Sprintf("corrupted: %s", r.Detail)
+		}
+		return fmt.Sprintf("corrupted: %d bytes differ, first at offset %d (expected 0x%02x, got 0x%02x)",
+			r.Mismatched, r.Offset, r.Want, r.Got)
+	case VerifyTruncated:
+		if r.Expected == 0 {
+			return "truncated: empty"
+		}
+		return fmt.Sprintf("truncated: %d of %d bytes", r.Size, r.Expected)
+	case VerifyUnverifiable:
+		return fmt.Sprintf("unverifiable: %s", r.Detail)
+	case VerifyMissing:
+		return "missing"
+	default:
+		return r.Status.String()
+	}
+}
+
+// VerifyError is returned from a read that found an object whose contents
+// don't match what was written.
+type VerifyError struct {
+	Name   string
+	Result VerifyResult
+}
+
+func (e *VerifyError) Error() string {
+	return fmt.Sprintf("verify %s: %s", e.Name, e.Result.String())
+}
+
+func isVerifyError(e error) bool {
+	var ve *VerifyError
+	return errors.As(e, &ve)
+}
+
+// ObjectVerifier checks an object's contents as it's read. Write the data
+// in order as it's read (it's an io.Writer, so io.Copy works), then call
+// Finish. The header at the start of the object is used to regenerate the
+// expected contents. A verifier may be reused after Reset, which keeps its
+// buffers.
+type ObjectVerifier struct {
+	seq      *ByteSequence
+	pool     *dedupePool // last dedupe pool used, kept since objects usually share one
+	head     []byte      // start of object, until the header has been parsed
+	header   *ObjectHeader
+	expected []byte
+	result   VerifyResult
+	written  bool // written with a header, so one must be there
+}
+
+func NewObjectVerifier() *ObjectVerifier {
+	v := &ObjectVerifier{
+		seq:  NewByteSequence(0),
+		head: make([]byte, 0, ObjectHeaderSize),
+	}
+	v.Reset()
+	return v
+}
+
+func (v *ObjectVerifier) Reset() {
+	v.head = v.head[:0]
+	v.header = nil
+	v.expected = v.expected[:0]
+	v.result = VerifyResult{Status: VerifyIntact, Offset: -1}
+	v.written = false
+}
+
+// ExpectHeader says the object being verified was written with a header,
+// e.g. by this run, so one that's missing means it's corrupted rather
+// than that it predates the header. It lasts until Reset.
+func (v *ObjectVerifier) ExpectHeader() {
+	v.written = true
+}
+
+func (v *ObjectVerifier) Write(p []byte) (int, error) {
+	n := len(p)
+
+	if v.header == nil && v.result.Detail == "" {
+		// Still gathering the header
+		take := ObjectHeaderSize - len(v.head)
+		if take > len(p) {
+			take = len(p)
+		}
+
+		v.head = append(v.head, p[:take]...)
+		v.result.Size += int64(take)
+		p = p[take:]
+
+		if len(v.head) < ObjectHeaderSize {
+			return n, nil
+		}
+
+		if e := v.parseHeader(); e != nil {
+			v.result.Size += int64(len(p))
+			return n, nil
+		}
+	}
+
+	if v.header == nil {
+		// No usable header; just count what's there.
+		v.result.Size += int64(len(p))
+		return n, nil
+	}
+
+	v.compare(p)
+	return n, nil
+}
+
+func (v *ObjectVerifier) parseHeader() error {
+	h, e := ParseObjectHeader(v.head)
+
+	if e != nil {
+		v.result.Detail = e.Error()
+		if e == errNoHeader && !v.written {
+			v.result.Status = VerifyUnverifiable
+		} else {
+			v.result.Status = VerifyCorrupted
+		}
+		return e
+	}
+
+	if DataPattern(h.Pattern).needsSource() && lookupPatternSource(h.PatternSource) == nil {
+		v.result.Status = VerifyUnverifiable
+		v.result.Detail = fmt.Sprintf("%s data source %08x not available", DataPattern(h.Pattern), h.PatternSource)
+		return errors.New(v.result.Detail)
+	}
+
+	v.header = h
+	v.result.Expected = int64(h.Size)
+
+	if cap(v.expected) < int(h.Size) {
+		v.expected = make([]byte, h.Size)
+	}
+	v.expected = v.expected[:h.Size]
+
+	if h.DedupePercent > 0 && !v.pool.matches(h) {
+		v.pool = newDedupePool(h)
+	}
+
+	fillObject(h, v.expected, v.seq, v.pool)
+
+	return nil
+}
+
+func (v *ObjectVerifier) compare(p []byte) {
+	offset := v.result.Size
+	v.result.Size += int64(len(p))
+
+	if v.result.Size > int64(len(v.expected)) {
+		v.result.Detail = fmt.Sprintf("object is longer than the %d bytes written", len(v.expected))
+		v.result.Status = VerifyCorrupted
+
+		if offset >= int64(len(v.expected)) {
+			return
+		}
+		p = p[:int64(len(v.expected))-offset]
+	}
+
+	if bytes.Equal(p, v.expected[offset:offset+int64(len(p))]) {
+		return
+	}
+
+	for i, got := range p {
+		pos := offset + int64(i)
+
+		if want := v.expected[pos]; got != want {
+			if v.result.Mismatched == 0 {
+				v.result.Offset = pos
+				v.result.Want = want
+				v.result.Got = got
+			}
+			v.result.Mismatched++
+			v.result.Status = VerifyCorrupted
+		}
+	}
+}
+
+// Finish returns the result once all of the object has been written.
+func (v *ObjectVerifier) Finish() VerifyResult {
+	if v.header == nil && v.result.Detail == "" {
+		if v.result.Size == 0 {
+			v.result.Status = VerifyTruncated
+		} else {
+			v.result.Status = VerifyUnverifiable
+			v.result.Detail = "too small for an object header"
+		}
+	}
+
+	if v.header != nil && v.result.Status == VerifyIntact && v.result.Size < v.result.Expected {
+		v.result.Status = VerifyTruncated
+	}
+
+	return v.result
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestObjectVerifier(t *testing.T) {
+	vendor, err := NewObjectVendor("256KB", DataConfig{Compressibility: 50}, 7)
+	AbortOnError(t, err)
+
+	blk := vendor.NewGenerator(1).GetObject()
+	defer vendor.ReturnObject(blk)
+
+	data := blk.Data
+	v := NewObjectVerifier()
+
+	// Intact, written in uneven pieces
+	for offset := 0; offset < len(data); offset += 10_000 {
+		end := offset + 10_000
+		if end > len(data) {
+			end = len(data)
+		}
+		_, _ = v.Write(data[offset:end])
+	}
+	result := v.Finish()
+	ExpectEqual(t, VerifyIntact, result.Status)
+
+	// Truncated
+	v.Reset()
+	_, _ = v.Write(data[:len(data)/2])
+	result = v.Finish()
+	ExpectEqual(t, VerifyTruncated, result.Status)
+	ExpectEqual(t, int64(len(data)), result.Expected)
+
+	// Corrupted
+	corrupt := append([]byte{}, data...)
+	corrupt[100_000] ^= 0xff
+	corrupt[100_001] ^= 0xff
+	v.Reset()
+	_, _ = v.Write(corrupt)
+	result = v.Finish()
+	ExpectEqual(t, VerifyCorrupted, result.Status)
+	ExpectEqual(t, int64(100_000), result.Offset)
+	ExpectEqual(t, int64(2), result.Mismatched)
+	ExpectEqual(t, data[100_000], result.Want)
+
+	// Damaged header
+	corrupt = append([]byte{}, data...)
+	corrupt[20] ^= 0xff
+	v.Reset()
+	_, _ = v.Write(corrupt)
+	ExpectEqual(t, VerifyCorrupted, v.Finish().Status)
+
+	// Too long
+	v.Reset()
+	_, _ = v.Write(append(append([]byte{}, data...), 1, 2, 3))
+	ExpectEqual(t, VerifyCorrupted, v.Finish().Status)
+
+	// No header at all
+	v.Reset()
+	_, _ = v.Write(make([]byte, 4096))
+	ExpectEqual(t, VerifyUnverifiable, v.Finish().Status)
+
+	// ...which is corruption if the object was written with one
+	v.Reset()
+	v.ExpectHeader()
+	_, _ = v.Write(make([]byte, 4096))
+	result = v.Finish()
+	ExpectEqual(t, VerifyCorrupted, result.Status)
+	ExpectEqual(t, "corrupted: no object header", result.String())
+
+	// Empty
+	v.Reset()
+	ExpectEqual(t, VerifyTruncated, v.Finish().Status)
+}
+
+func TestObjectVerifier_Dedupe(t *testing.T) {
+	data := DataConfig{Compressibility: 25, DedupePercent: 50, DedupeBlockSize: 8192, DedupePool: 16}
+	vendor, err := NewObjectVendor("1MB", data, 7)
+	AbortOnError(t, err)
+
+	g := vendor.NewGenerator(1)
+	v := NewObjectVerifier()
+
+	for i := 0; i < 5; i++ {
+		blk := g.GetObject()
+		v.Reset()
+		_, _ = v.Write(blk.Data)
+		ExpectEqual(t, VerifyIntact, v.Finish().Status)
+		vendor.ReturnObject(blk)
+	}
+}
+
+func TestObjectVerifier_Patterns(t *testing.T) {
+	corpus := filepath.Join(t.TempDir(), "corpus.txt")
+	AbortOnError(t, os.WriteFile(corpus, []byte("the quick brown fox jumps over the lazy dog\n"), 0644))
+
+	data := DataConfig{Pattern: PatternText, Repeat: "0123456789", Corpus: corpus}
+	vendor, err := NewObjectVendor("64KB/25/txt:128KB/25/a/zeros:96KB/25/b/repeat:100KB/25/c/corpus", data, 7)
+	AbortOnError(t, err)
+
+	g := vendor.NewGenerator(1)
+	v := NewObjectVerifier()
+	seen := make(map[DataPattern]bool)
+
+	for i := 0; i < 40; i++ {
+		blk := g.GetObject()
+		h, err := ParseObjectHeader(blk.Data)
+		AbortOnError(t, err)
+		seen[DataPattern(h.Pattern)] = true
+
+		v.Reset()
+		_, _ = v.Write(blk.Data)
+		result := v.Finish()
+		ExpectEqual(t, VerifyIntact, result.Status)
+
+		vendor.ReturnObject(blk)
+	}
+
+	ExpectEqual(t, 4, len(seen))
+
+	// Objects whose source isn't registered can't be checked.
+	h := &ObjectHeader{Version: generatorVersion, Size: 4096, Pattern: uint8(PatternCorpus), PatternSource: 1}
+	buf := make([]byte, 4096)
+	h.Marshal(buf)
+	v.Reset()
+	_, _ = v.Write(buf)
+	ExpectEqual(t, VerifyUnverifiable, v.Finish().Status)
+}